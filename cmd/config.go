@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/relab/snarl-mw21/config"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/spf13/cobra"
+)
+
+var configPath, profileName, placementName string
+
+// cfg holds the settings of the running command. Flags take precedence over environment
+// variables, which take precedence over the profile of the configuration file.
+var cfg = config.Default()
+
+// loadConfig resolves cfg for cmd. The lattice parameters of the flags only take effect through
+// cfg.Lattice, which commands pass down instead of reading the flags.
+func loadConfig(cmd *cobra.Command) error {
+	c, err := loadProfile()
+	if err != nil {
+		return err
+	}
+	if err := c.ApplyEnv(os.LookupEnv); err != nil {
+		return err
+	}
+
+	flags := cmd.Flags()
+	if flags.Changed("chunkdbpath") {
+		c.ChunkDBPath = ChunkDBPath
+	}
+	if flags.Changed("snarldbpath") {
+		c.SnarlDBPath = SnarlDBPath
+	}
+	if flags.Changed("bzzkey") {
+		c.BzzKey = bzzKey
+	}
+	if flags.Changed("ipcpath") {
+		c.IPCPath = ipcPath
+	}
+	if flags.Changed("numPeers") {
+		c.NumPeers = minNumPeers
+	}
+	if flags.Changed("alpha") {
+		c.Alpha = alpha
+	}
+	if flags.Changed("s") {
+		c.S = s
+	}
+	if flags.Changed("p") {
+		c.P = p
+	}
+	if flags.Changed("placement") {
+		c.Placement = placementName
+	}
+	if _, err := swarmconnector.ParsePlacement(c.Placement); err != nil {
+		return err
+	}
+	cfg = c
+	return nil
+}
+
+// loadProfile returns the selected profile of the configuration file, or the defaults if there is
+// no configuration file.
+func loadProfile() (config.Config, error) {
+	path, explicit := configPath, true
+	if path == "" {
+		path = os.Getenv("SNARL_CONFIG")
+	}
+	if path == "" {
+		path, explicit = config.DefaultPath(), false
+	}
+	name := profileName
+	if name == "" {
+		name = os.Getenv("SNARL_PROFILE")
+	}
+
+	f, err := config.Load(path)
+	if os.IsNotExist(err) && !explicit {
+		if name != "" {
+			return config.Config{}, fmt.Errorf("profile %q given without a configuration file", name)
+		}
+		return config.Default(), nil
+	} else if err != nil {
+		return config.Config{}, fmt.Errorf("configuration file %v: %v", path, err)
+	}
+	return f.Profile(name)
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/relab/snarl-mw21/daemon"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/spf13/cobra"
+)
+
+var registryPath, statusAddr string
+var daemonConfig daemon.Config
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Monitor and heal a set of entangled files",
+	Long: "Keeps a registry of entangled files. While running, it samples the availability of their chunks " +
+		"at an interval and repairs a file when its recoverability margin drops below the threshold.",
+}
+
+var daemonRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run the daemon",
+	Run: func(cmd *cobra.Command, args []string) {
+		registry, err := daemon.OpenRegistry(registryPath)
+		if err != nil {
+			fail(err)
+		}
+		defer registry.Close()
+
+		sc := swarmconnector.NewSwarmConnectorConfig(cfg.Connection)
+		if err := waitConnectionToPeers(cfg.Connection); err != nil {
+			fail(err)
+		}
+		store := func(chunks []chunk.Chunk) error {
+			return sc.PutLocal(chunks, pinContent)
+		}
+		d := daemon.New(registry, sc.Getter, sc.Getter, store, daemonConfig)
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+		listener, err := net.Listen("tcp", statusAddr)
+		if err != nil {
+			fail(err)
+		}
+
+		// An error of the status endpoint stops the daemon between checks, and is returned by Run.
+		server := &http.Server{Handler: d}
+		serveErr := make(chan error, 1)
+		go func() {
+			if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+				serveErr <- err
+				cancel()
+			}
+		}()
+		printf("Status endpoint listening at http://%v/. Sampling seed: %d\n", listener.Addr(), daemonConfig.Seed)
+		result.Listen = listener.Addr().String()
+		printResult(nil)
+
+		err = d.Run(ctx)
+		server.Shutdown(context.Background())
+		select {
+		case err = <-serveErr:
+		default:
+		}
+		if err != nil {
+			fail(err)
+		}
+	},
+}
+
+var daemonAddCmd = &cobra.Command{
+	Use:   "add [swarm hashes]",
+	Short: "Register an entangled file or collection with the daemon",
+	Long: "Registers an entangled file or every file of a collection. The daemon must not be running. " +
+		"The swarm hashes are the size in hex, the data root and the parity roots, separated by commas.",
+	Run: func(cmd *cobra.Command, args []string) {
+		files, err := entangledFiles(args)
+		if err != nil {
+			fail(err)
+		}
+		registry, err := daemon.OpenRegistry(registryPath)
+		if err != nil {
+			fail(err)
+		}
+		defer registry.Close()
+		if err := registry.AddCollection(&entangler.Collection{Alpha: cfg.Alpha, S: cfg.S, P: cfg.P, Files: files}); err != nil {
+			fail(err)
+		}
+		printf("Registered %d files.\n", len(files))
+		for _, file := range files {
+			result.Files = append(result.Files, &fileResult{EntangledFile: file})
+		}
+		printResult(nil)
+	},
+}
+
+var daemonRemoveCmd = &cobra.Command{
+	Use:   "remove [data root]",
+	Short: "Remove a file from the daemon",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		registry, err := daemon.OpenRegistry(registryPath)
+		if err != nil {
+			fail(err)
+		}
+		defer registry.Close()
+		if err := registry.Remove(args[0]); err != nil {
+			fail(err)
+		}
+		printResult(nil)
+	},
+}
+
+var daemonListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the files of the daemon and the result of their last check",
+	Run: func(cmd *cobra.Command, args []string) {
+		registry, err := daemon.OpenRegistry(registryPath)
+		if err != nil {
+			fail(err)
+		}
+		defer registry.Close()
+		entries, err := registry.List()
+		if err != nil {
+			fail(err)
+		}
+		for _, e := range entries {
+			status := "not checked"
+			if e.Health != nil {
+				status = fmt.Sprintf("margin %d, recoverable %t", e.Health.Margin, e.Health.FullyRecoverable())
+			}
+			printf("%v %v: %v, %d repairs\n", e.ID(), e.File.Path, status, e.Repairs)
+		}
+		result.Registry = entries
+		printResult(nil)
+	},
+}
+
+func init() {
+	defaultRegistry := filepath.Join(os.TempDir(), "snarl-registry")
+	daemonCmd.PersistentFlags().StringVarP(&registryPath, "registry", "", defaultRegistry, "Location of the registry database.")
+
+	daemonRunCmd.Flags().DurationVarP(&daemonConfig.Interval, "interval", "", 10*time.Minute, "Time between checks of every file.")
+	daemonRunCmd.Flags().Float64VarP(&daemonConfig.Intensity, "intensity", "", 0.1, "Fraction of the chunks probed in each check.")
+	daemonRunCmd.Flags().IntVarP(&daemonConfig.Threshold, "threshold", "", 3, "Repair a file when its recoverability margin is below this.")
+	daemonRunCmd.Flags().Int64VarP(&daemonConfig.Seed, "seed", "", 1, "Seed of the sampling, which makes the chunks probed in each check reproducible.")
+	daemonRunCmd.Flags().StringVarP(&statusAddr, "listen", "", "localhost:8600", "Address of the HTTP status endpoint.")
+	daemonRunCmd.Flags().BoolVarP(&pinContent, "pin", "", false, "Pin the repaired chunks, so they are never garbage collected.")
+
+	daemonAddCmd.Flags().IntVarP(&alpha, "alpha", "a", 3, "Parities per data block.")
+	daemonAddCmd.Flags().IntVarP(&p, "p", "p", 5, "Helical strands.")
+	daemonAddCmd.Flags().IntVarP(&s, "s", "s", 5, "Horizontal strands.")
+	daemonAddCmd.Flags().StringVarP(&collectionPath, "collection", "", "", "Collection index written by entangle. Registers every file.")
+	daemonAddCmd.Flags().StringVarP(&placementName, "placement", "", "", "Placement policy of the data blocks in the lattice: window (default), spread, subtree or random:seed.")
+	daemonAddCmd.Flags().IntVarP(&chunkSize, "chunksize", "", 0, "File was chunked into chunks of this many bytes instead of the Swarm chunk size.")
+
+	daemonCmd.AddCommand(daemonRunCmd, daemonAddCmd, daemonRemoveCmd, daemonListCmd)
+	rootCmd.AddCommand(daemonCmd)
+}
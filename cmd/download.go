@@ -3,18 +3,22 @@ package cmd
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethersphere/swarm/api"
-	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/config"
 	"github.com/relab/snarl-mw21/entangler"
 	"github.com/relab/snarl-mw21/swarmconnector"
 	"github.com/relab/snarl-mw21/utils"
@@ -22,18 +26,53 @@ import (
 )
 
 var doRepair bool
+var byteRange string
+var crossCheck bool
+var recordPath, replayPath string
+var dumpLatticePath string
+var snapshotPath, resumePath string
+var snapshotData bool
+var resume *entangler.Snapshot
 
 var downloadCmd = &cobra.Command{
 	Use:   "download [swarm hashes]",
 	Short: "Download and repair a file from Swarm",
 	Long:  "Downloads and if neccessary repairs and uploads the file to Swarm",
 	Run: func(cmd *cobra.Command, args []string) {
+		if resumePath != "" {
+			var err error
+			if resume, err = entangler.ReadSnapshot(resumePath); err != nil {
+				fail(err)
+			}
+		}
+		if replayPath != "" {
+			if err := replayDownload(replayPath); err != nil {
+				fail(err)
+			}
+			printResult(nil)
+			return
+		}
+		if collectionPath != "" {
+			if err := downloadCollection(collectionPath); err != nil {
+				fail(err)
+			}
+			printResult(nil)
+			return
+		}
 		if len(args) != 1 {
-			log.Fatalf("Must specify swarm hash.")
+			fail(errors.New("must specify swarm hash"))
 		}
 		swarmhashes := strings.Split(args[0], ",")
+		if byteRange != "" && len(swarmhashes) < 3 {
+			fail(errors.New("a range download must specify the size, the data hash and the parity hashes"))
+		}
+		result.Alpha, result.S, result.P, result.Placement = cfg.Alpha, cfg.S, cfg.P, cfg.Placement
+		if cfg.Placement != "" {
+			printf("Placement policy: %v. It must be the one the file was entangled with.\n", cfg.Placement)
+		}
 		if len(swarmhashes) == 1 {
-			downloadFile(0, swarmhashes[0:], alpha, s, p, false)
+			downloadFile(0, swarmhashes[0:], cfg.Lattice, false)
+			printResult(nil)
 			return
 		}
 		for i := 1; i < len(swarmhashes); i++ {
@@ -42,7 +81,16 @@ var downloadCmd = &cobra.Command{
 			}
 		}
 		size, _ := strconv.ParseInt(swarmhashes[0], 16, 64)
-		downloadFile(uint64(size), swarmhashes[1:], alpha, s, p, false)
+		result.Size = uint64(size)
+		if byteRange != "" {
+			if err := downloadRange(uint64(size), swarmhashes[1:], byteRange); err != nil {
+				fail(err)
+			}
+			printResult(nil)
+			return
+		}
+		downloadFile(uint64(size), swarmhashes[1:], cfg.Lattice, false)
+		printResult(nil)
 	},
 }
 
@@ -53,6 +101,17 @@ func init() {
 	downloadCmd.Flags().BoolVarP(&closelattice, "close", "c", true, "Closed Lattice")
 	downloadCmd.Flags().BoolVarP(&utils.GLOBAL_Benchmark, "benchmark", "b", false, "Run in benchmark mode.")
 	downloadCmd.Flags().BoolVarP(&doRepair, "dorepair", "u", true, "Re-upload repaired chunks to Swarm")
+	downloadCmd.Flags().StringVarP(&collectionPath, "collection", "", "", "Collection index written by entangle. Downloads and repairs every file.")
+	downloadCmd.Flags().StringVarP(&placementName, "placement", "", "", "Placement policy of the data blocks in the lattice: window (default), spread, subtree or random:seed.")
+	downloadCmd.Flags().IntVarP(&chunkSize, "chunksize", "", 0, "File was chunked into chunks of this many bytes instead of the Swarm chunk size.")
+	downloadCmd.Flags().StringVarP(&byteRange, "range", "", "", "Write only the bytes start-end (end exclusive, may be left out) to stdout, repairing only the chunks they need.")
+	downloadCmd.Flags().BoolVarP(&crossCheck, "crosscheck", "", false, "Verify data chunks and compare the repair pairs of repaired blocks, and stop using strands that serve wrong parities.")
+	downloadCmd.Flags().StringVarP(&recordPath, "record", "", "", "Record the lattice parameters, the chunker and every chunk request and response of the download in a trace file.")
+	downloadCmd.Flags().StringVarP(&replayPath, "replay", "", "", "Download from a trace file written with --record instead of from Swarm, with the recorded latencies.")
+	downloadCmd.Flags().StringVarP(&dumpLatticePath, "dump-lattice", "", "", "Write the state of the lattice after the download as a Graphviz graph, or as SVG if the file ends in .svg.")
+	downloadCmd.Flags().StringVarP(&snapshotPath, "snapshot", "", "", "Write the state of the lattice after the download to a snapshot file.")
+	downloadCmd.Flags().BoolVarP(&snapshotData, "snapshot-data", "", false, "Include the data of the blocks in the snapshot, so that the download can be resumed from it.")
+	downloadCmd.Flags().StringVarP(&resumePath, "resume", "", "", "Start from the state of the lattice in a snapshot file, retrieving only the chunks it is missing.")
 	downloadCmd.Flags().StringVarP(&utils.GLOBAL_ExpectedOutput, "hashoutput", "", "", "Expected hash output in benchmark.")
 	downloadCmd.Flags().IntVarP(&utils.GLOBAL_Failrate, "failrate", "", 0, "Random failure rate during tests")
 	downloadCmd.Flags().IntVarP(&utils.GLOBAL_Failednodes, "failednodes", "", 0, "Network nodes failed")
@@ -62,46 +121,49 @@ func init() {
 
 // downloadFile
 // Params: size - [in hex] number of bytes of original file.
-func downloadFile(size uint64, swarmHashes []string, alpha, s, p int, doRepair bool) error {
+func downloadFile(size uint64, swarmHashes []string, lc config.Lattice, doRepair bool) error {
 	// 1. Setup the swarmconnector
-	sc := swarmconnector.NewSwarmConnector(ChunkDBPath, bzzKey, SnarlDBPath)
+	sc := swarmconnector.NewSwarmConnectorConfig(cfg.Connection)
 
 	dataAddr, err := hexutil.Decode(swarmHashes[0])
 	if err != nil {
-		log.Fatalf(err.Error())
+		fail(err)
 	}
 	parityAddrs := make([][]byte, len(swarmHashes)-1)
 	for i := 1; i < len(swarmHashes); i++ {
 		parityAddrs[i-1], err = hexutil.Decode(swarmHashes[i])
 		if err != nil {
-			log.Fatalf(err.Error())
+			fail(err)
 		}
+		result.ParityRoots = append(result.ParityRoots, parityAddrs[i-1])
 	}
+	result.DataRoot = dataAddr
 	dir, err := ioutil.TempDir("", "downloaded-files")
 	if err != nil {
 		return err // ??
 	}
 
 	// 2. Ensure we are connected to enough peers
-	if err := waitConnectionToPeers(minNumPeers); err != nil {
-		log.Fatal(err)
+	if err := waitConnectionToPeers(cfg.Connection); err != nil {
+		fail(err)
 	}
 
-	t := time.Now().UnixNano()
+	start := time.Now()
+	t := start.UnixNano()
 
 	// 2. Try to retrieve normally.
 	if size == 0 && regularDownload(sc, dataAddr, dir) == nil {
 		if utils.GLOBAL_Benchmark {
-			fmt.Printf("Download complete.\n")
-			fmt.Printf("%d,%d\n", t, time.Now().UnixNano())
+			printf("Download complete.\n")
+			printf("%d,%d\n", t, time.Now().UnixNano())
 			if utils.GLOBAL_ExpectedOutput != "" {
 				hashInput, _ := hex.DecodeString(utils.GLOBAL_ExpectedOutput)
 				hashOutput, _ := utils.GetHashOfFile(dir + "/download")
 				hashEqual := bytes.Equal(hashInput, hashOutput)
 				if !hashEqual {
-					fmt.Printf("HASHES NOT EQUAL. Input: %x, Output: %x\n", hashInput, hashOutput)
+					printf("HASHES NOT EQUAL. Input: %x, Output: %x\n", hashInput, hashOutput)
 				} else {
-					fmt.Printf("Hashes Equal. Hash: %x\n", hashInput)
+					printf("Hashes Equal. Hash: %x\n", hashInput)
 				}
 			}
 		}
@@ -114,8 +176,33 @@ func downloadFile(size uint64, swarmHashes []string, alpha, s, p int, doRepair b
 
 	var filename string = "/download"
 
-	lattice := entangler.NewSwarmLattice(sc.Ctx, alpha, s, p, size, sc.Getter, dataAddr, parityAddrs, chunk.DefaultSize)
-	tc, err := swarmconnector.BuildCompleteTree(sc.Ctx, sc.Getter, dataAddr, swarmconnector.BuildTreeOptions{}, lattice)
+	chunker := hashChunker(sc.Ctx, sc.Getter, dataAddr)
+	var getter storage.Getter = sc.Getter
+	var recorder *swarmconnector.Recorder
+	if recordPath != "" {
+		recorder = swarmconnector.NewRecorder(sc.Getter, &swarmconnector.Trace{Lattice: lc, Size: size,
+			DataRoot: dataAddr, ParityRoots: result.ParityRoots, Chunker: chunker})
+		getter = recorder
+	}
+	tc, lattice, err := latticeDownload(sc.Ctx, getter, lc, size, dataAddr, parityAddrs, chunker)
+	result.Repair = latticeStats(lattice, time.Since(start))
+	if recorder != nil {
+		if err := recorder.Trace().WriteFile(recordPath); err != nil {
+			fail(err)
+		}
+		printf("Recorded %d chunk requests in %v\n", len(recorder.Trace().Requests), recordPath)
+	}
+	if err := dumpLattice(lattice, dumpLatticePath); err != nil {
+		fail(err)
+	}
+	if snapshotPath != "" {
+		if err := lattice.Snapshot(snapshotData).WriteFile(snapshotPath); err != nil {
+			fail(err)
+		}
+	}
+	if check := result.Repair.CrossCheck; check != nil && len(check.Quarantined) > 0 {
+		printf("Quarantined strands with wrong parities: %v\n", check.Quarantined)
+	}
 
 	if err != nil {
 		if utils.GLOBAL_Benchmark {
@@ -130,30 +217,18 @@ func downloadFile(size uint64, swarmHashes []string, alpha, s, p int, doRepair b
 							datablocks++
 						}
 					}
-					fmt.Printf("%t,%d,%d,%d,%t,%d,%d,%t\n", b.IsParity, b.Position,
+					printf("%t,%d,%d,%d,%t,%d,%d,%t\n", b.IsParity, b.Position,
 						b.LeftPos(0), b.RightPos(0), b.HasData(), b.DownloadTime.StartTime,
 						b.DownloadTime.EndTime, b.DownloadStatus == entangler.DownloadSuccess)
 				}
 			}
-			fmt.Printf("Download FAILED. Datablocks: %d/%d, Parityblocks: %d/%d\n", datablocks, lattice.NumDataBlocks, parityblocks, len(lattice.Blocks)-lattice.NumDataBlocks)
-			fmt.Println(err.Error())
+			printf("Download FAILED. Datablocks: %d/%d, Parityblocks: %d/%d\n", datablocks, lattice.NumDataBlocks, parityblocks, len(lattice.Blocks)-lattice.NumDataBlocks)
+			printf("%v\n", err.Error())
 		}
-		log.Fatalf(err.Error())
+		fail(err)
 	}
 
-	dataChunks := make([][]byte, 0, tc.Index)
-	var walker func(*swarmconnector.TreeChunk)
-	walker = func(c *swarmconnector.TreeChunk) {
-		for j := range c.Children {
-			walker(c.Children[j])
-		}
-		if c.SubtreeSize <= uint64(len(c.Data)) {
-			dataChunks = append(dataChunks, c.Data[swarmconnector.ChunkSizeOffset:])
-		}
-	}
-	walker(tc)
-
-	if err := RebuildFile(dir+filename, dataChunks...); err == nil {
+	if err := RebuildFile(dir+filename, leafData(tc)...); err == nil {
 		if utils.GLOBAL_Benchmark {
 			datablocks, parityblocks := 0, 0
 			for i := 0; i < len(lattice.Blocks); i++ {
@@ -166,33 +241,312 @@ func downloadFile(size uint64, swarmHashes []string, alpha, s, p int, doRepair b
 							datablocks++
 						}
 					}
-					fmt.Printf("%t,%d,%d,%d,%t,%d,%d,%t\n", b.IsParity, b.Position,
+					printf("%t,%d,%d,%d,%t,%d,%d,%t\n", b.IsParity, b.Position,
 						b.LeftPos(0), b.RightPos(0), b.HasData(), b.DownloadTime.StartTime,
 						b.DownloadTime.EndTime, b.DownloadStatus == entangler.DownloadSuccess)
 				}
 			}
-			fmt.Printf("Download complete. Datablocks: %d/%d, Parityblocks: %d/%d\n", datablocks, lattice.NumDataBlocks, parityblocks, len(lattice.Blocks)-lattice.NumDataBlocks)
-			fmt.Printf("%d,%d\n", t, time.Now().UnixNano())
+			printf("Download complete. Datablocks: %d/%d, Parityblocks: %d/%d\n", datablocks, lattice.NumDataBlocks, parityblocks, len(lattice.Blocks)-lattice.NumDataBlocks)
+			printf("%d,%d\n", t, time.Now().UnixNano())
 			if utils.GLOBAL_ExpectedOutput != "" {
 				hashInput, _ := hex.DecodeString(utils.GLOBAL_ExpectedOutput)
 				hashOutput, _ := utils.GetHashOfFile(dir + filename)
 				hashEqual := bytes.Equal(hashInput, hashOutput)
 				if !hashEqual {
-					fmt.Printf("HASHES NOT EQUAL. Input: %x, Output: %x\n", hashInput, hashOutput)
+					printf("HASHES NOT EQUAL. Input: %x, Output: %x\n", hashInput, hashOutput)
 				} else {
-					fmt.Printf("Hashes Equal. Hash: %x\n", hashInput)
+					printf("Hashes Equal. Hash: %x\n", hashInput)
 				}
 			}
 		}
-		fmt.Printf("Output file with repairs: %v\n", dir+filename)
+		printf("Output file with repairs: %v\n", dir+filename)
+		result.Output = dir + filename
 	} else {
-		fmt.Printf("Error downloading file. %+v\n", err)
+		printf("Error downloading file. %+v\n", err)
+		if jsonOutput {
+			fail(err)
+		}
+	}
+
+	return nil
+}
+
+// latticeDownload retrieves the tree of a file from getter and repairs it with the lattice of its
+// parities. The lattice starts from the snapshot given with --resume if it is of the same file.
+func latticeDownload(ctx context.Context, getter storage.Getter, lc config.Lattice, size uint64, dataAddr []byte,
+	parityAddrs [][]byte, chunker swarmconnector.ChunkerOptions) (*swarmconnector.TreeChunk, *entangler.Lattice, error) {
+	lattice, err := newLatticeGetter(ctx, getter, lc, size, dataAddr, parityAddrs, chunker)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resume != nil && bytes.Equal(resume.DataRoot, dataAddr) {
+		if err := lattice.Restore(resume); err != nil {
+			return nil, lattice, err
+		}
+	}
+	tc, err := swarmconnector.BuildCompleteTree(ctx, getter, dataAddr, lattice.Chunker.TreeOptions(), lattice)
+	return tc, lattice, err
+}
+
+// flagChunker returns the chunker given by --pyramid and --chunksize.
+func flagChunker() swarmconnector.ChunkerOptions {
+	return swarmconnector.ChunkerOptions{Pyramid: usePyramid, ChunkSize: chunkSize}
+}
+
+// hashChunker returns the chunker of a file given by the address of its root. Unless the pyramid
+// chunker or a chunk size is given, the chunker is detected if the rightmost chunks are available.
+func hashChunker(ctx context.Context, getter storage.Getter, dataAddr []byte) swarmconnector.ChunkerOptions {
+	chunker := flagChunker()
+	chunker.Encrypted = swarmconnector.IsEncryptedRef(dataAddr)
+	if !chunker.Pyramid && chunker.ChunkSize == 0 {
+		if detected, err := swarmconnector.DetectChunker(ctx, getter, dataAddr); err == nil {
+			chunker = detected
+		}
+	}
+	return chunker
+}
+
+// newLattice creates the lattice of a file in Swarm, chunked with chunker.
+func newLattice(sc *swarmconnector.SwarmConnector, lc config.Lattice, size uint64, dataAddr []byte,
+	parityAddrs [][]byte, chunker swarmconnector.ChunkerOptions) (*entangler.Lattice, error) {
+	return newLatticeGetter(sc.Ctx, sc.Getter, lc, size, dataAddr, parityAddrs, chunker)
+}
+
+// newLatticeGetter is newLattice with the chunks retrieved from getter.
+func newLatticeGetter(ctx context.Context, getter storage.Getter, lc config.Lattice, size uint64, dataAddr []byte,
+	parityAddrs [][]byte, chunker swarmconnector.ChunkerOptions) (*entangler.Lattice, error) {
+	chunker.Encrypted = swarmconnector.IsEncryptedRef(dataAddr)
+	lattice, err := entangler.NewSwarmLatticeConfig(ctx, lc, size, getter, dataAddr, parityAddrs, chunker)
+	if err != nil {
+		return nil, err
+	}
+	lattice.CrossCheck = crossCheck
+	return lattice, nil
+}
+
+// dumpLattice writes the lattice as a Graphviz graph to path, if it is set. Files ending in .svg
+// are drawn with the dot command of Graphviz.
+func dumpLattice(lattice *entangler.Lattice, path string) error {
+	if path == "" {
+		return nil
+	}
+	if filepath.Ext(path) != ".svg" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if err := lattice.WriteDot(f, entangler.DotWindow{}); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	var graph bytes.Buffer
+	if err := lattice.WriteDot(&graph, entangler.DotWindow{}); err != nil {
+		return err
+	}
+	render := exec.Command("dot", "-Tsvg", "-o", path)
+	render.Stdin, render.Stderr = &graph, os.Stderr
+	if err := render.Run(); err != nil {
+		return fmt.Errorf("could not draw the lattice with Graphviz: %v", err)
+	}
+	return nil
+}
+
+// replayDownload downloads and repairs the file of a trace written with --record, with the
+// responses of the trace. The lattice parameters are those of the trace.
+func replayDownload(path string) error {
+	trace, err := swarmconnector.ReadTrace(path)
+	if err != nil {
+		return err
+	}
+	getter := swarmconnector.NewReplayGetter(trace)
+	getter.Latency = true
+	lc := trace.Lattice
+	result.Alpha, result.S, result.P = lc.Alpha, lc.S, lc.P
+	result.Size, result.DataRoot, result.ParityRoots = trace.Size, trace.DataRoot, trace.ParityRoots
+
+	start := time.Now()
+	tc, lattice, err := latticeDownload(context.Background(), getter, lc, trace.Size, trace.DataRoot,
+		trace.ParityAddrs(), trace.Chunker)
+	result.Repair = latticeStats(lattice, time.Since(start))
+	if err := dumpLattice(lattice, dumpLatticePath); err != nil {
+		return err
+	}
+	if snapshotPath != "" {
+		if err := lattice.Snapshot(snapshotData).WriteFile(snapshotPath); err != nil {
+			return err
+		}
+	}
+	if n := getter.Unrecorded(); n > 0 {
+		printf("%d chunk requests were not in the trace\n", n)
+	}
+	if err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir("", "downloaded-files")
+	if err != nil {
+		return err
+	}
+	result.Output = filepath.Join(dir, "download")
+	if err := RebuildFile(result.Output, leafData(tc)...); err != nil {
+		return err
+	}
+	printf("Output file with repairs: %v\n", result.Output)
+	return nil
+}
+
+// downloadRange writes the bytes in the range "start-end" of a file to stdout, or to a new file
+// with JSON output. Only the chunks that cover the range, and the blocks needed to repair them,
+// are retrieved.
+func downloadRange(size uint64, swarmHashes []string, byteRange string) error {
+	start, end, err := parseByteRange(byteRange, size)
+	if err != nil {
+		return err
+	}
+	sc := swarmconnector.NewSwarmConnectorConfig(cfg.Connection)
+	dataAddr, err := hexutil.Decode(swarmHashes[0])
+	if err != nil {
+		return err
+	}
+	parityAddrs := make([][]byte, len(swarmHashes)-1)
+	for i := 1; i < len(swarmHashes); i++ {
+		if parityAddrs[i-1], err = hexutil.Decode(swarmHashes[i]); err != nil {
+			return err
+		}
+		result.ParityRoots = append(result.ParityRoots, parityAddrs[i-1])
+	}
+	result.DataRoot = dataAddr
+	if err := waitConnectionToPeers(cfg.Connection); err != nil {
+		return err
+	}
+
+	dst := os.Stdout
+	if jsonOutput {
+		if dst, err = ioutil.TempFile("", "download-range-*"); err != nil {
+			return err
+		}
+		defer dst.Close()
+		result.Output = dst.Name()
+	}
+
+	begin := time.Now()
+	lattice, err := newLattice(sc, cfg.Lattice, size, dataAddr, parityAddrs, hashChunker(sc.Ctx, sc.Getter, dataAddr))
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(dst)
+	_, err = swarmconnector.ReadRange(sc.Ctx, sc.Getter, dataAddr, lattice.Chunker.TreeOptions(), lattice, start, end, out)
+	result.Repair = latticeStats(lattice, time.Since(begin))
+	if err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// parseByteRange parses "start-end" into the range [start, end). A missing end is the end of the file.
+func parseByteRange(byteRange string, size uint64) (start, end uint64, err error) {
+	parts := strings.SplitN(byteRange, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("range %q is not on the form start-end", byteRange)
+	}
+	if start, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid range start: %v", err)
+	}
+	end = size
+	if parts[1] != "" {
+		if end, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid range end: %v", err)
+		}
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("range start %d is after its end %d", start, end)
+	}
+	return start, end, nil
+}
+
+// leafData returns the content of the leaves of the tree in order.
+func leafData(tc *swarmconnector.TreeChunk) [][]byte {
+	dataChunks := make([][]byte, 0, tc.Index)
+	var walker func(*swarmconnector.TreeChunk)
+	walker = func(c *swarmconnector.TreeChunk) {
+		for j := range c.Children {
+			walker(c.Children[j])
+		}
+		if c.SubtreeSize <= uint64(len(c.Data)) {
+			dataChunks = append(dataChunks, c.Data[swarmconnector.ChunkSizeOffset:])
+		}
+	}
+	walker(tc)
+	return dataChunks
+}
+
+// downloadCollection downloads every file of an entangled collection and repairs them with
+// their lattices. The files are written to a new directory, following their paths in the
+// manifest. Manifests are repaired as well, but not written.
+func downloadCollection(indexPath string) error {
+	collection, err := entangler.ReadCollection(indexPath)
+	if err != nil {
+		return err
+	}
+	sc := swarmconnector.NewSwarmConnectorConfig(cfg.Connection)
+	if err := waitConnectionToPeers(cfg.Connection); err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir("", "downloaded-files")
+	if err != nil {
+		return err
 	}
 
+	result.Alpha, result.S, result.P = collection.Alpha, collection.S, collection.P
+	result.Collection, result.Output = indexPath, dir
+	var failed int
+	for _, file := range collection.Files {
+		fr := &fileResult{EntangledFile: file}
+		result.Files = append(result.Files, fr)
+		start := time.Now()
+		tc, lattice, err := latticeDownload(sc.Ctx, sc.Getter, file.Lattice(collection.Lattice()), file.Size,
+			file.DataRoot, file.ParityAddrs(), file.Chunker())
+		fr.Repair = latticeStats(lattice, time.Since(start))
+		if err != nil {
+			printf("Could not download %q. Error: %v\n", file.Path, err)
+			fr.Error = err.Error()
+			failed++
+			continue
+		}
+		if file.IsManifest() {
+			continue
+		}
+		fr.Output = collectionFilePath(dir, file.Path)
+		if err := RebuildFile(fr.Output, leafData(tc)...); err != nil {
+			printf("Could not write %q. Error: %v\n", file.Path, err)
+			fr.Error = err.Error()
+			failed++
+		}
+	}
+
+	printf("Output directory with repairs: %v\n", dir)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files could not be downloaded", failed, len(collection.Files))
+	}
 	return nil
 }
 
+// collectionFilePath returns where a file at manifestPath in a collection is written below dir.
+// The default entry of a manifest has an empty path.
+func collectionFilePath(dir, manifestPath string) string {
+	if manifestPath == "" || strings.HasSuffix(manifestPath, "/") {
+		manifestPath += "download"
+	}
+	return filepath.Join(dir, filepath.Clean("/"+manifestPath))
+}
+
 func RebuildFile(filePath string, Chunks ...[]byte) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
 	file, err := os.Create(filePath)
 	if err != nil {
 		return err
@@ -206,31 +560,43 @@ func RebuildFile(filePath string, Chunks ...[]byte) error {
 	return file.Close()
 }
 
+// regularDownload retrieves the content at dataAddr without repairs. If dataAddr is a manifest,
+// every file in it is written to dir, following their paths in the manifest.
 func regularDownload(sc *swarmconnector.SwarmConnector, dataAddr []byte, dir string) error {
-	var filename string
-	var err error
-	var data []byte
-	data, err = sc.Getter.Download(sc.Ctx, dataAddr)
-	if err == nil {
-		var manifestList api.ManifestList
-		manifestList, err = sc.Swarmapi.GetManifestList(sc.Ctx, nil, dataAddr, "")
-		if err == nil {
-			if manifestList.Entries[0].Path != "/" {
-				filename = manifestList.Entries[0].Path
-			}
-
-			dataAddr, _ = hexutil.Decode("0x" + manifestList.Entries[0].Hash)
-			data, err = sc.Getter.Download(sc.Ctx, dataAddr)
-		}
-		if filename == "" {
-			filename = "/download"
+	// Downloading also brings the chunks into the local store, where the manifest is read from.
+	data, err := sc.Getter.Download(sc.Ctx, dataAddr)
+	if err != nil {
+		return err
+	}
+	walker, err := sc.Swarmapi.NewManifestWalker(sc.Ctx, dataAddr, nil, nil)
+	if err != nil {
+		// Not a manifest, only a single file.
+		if err := RebuildFile(dir+"/download", data); err != nil {
+			return err
 		}
+		printf("Output file without any failure: %v\n", dir+"/download")
+		result.Output = dir + "/download"
+		return nil
+	}
 
-		if RebuildFile(dir+filename, data) == nil {
-			fmt.Printf("Output file without any failure: %v\n", dir+"/download")
+	err = walker.Walk(func(entry *api.ManifestEntry) error {
+		if entry.Hash == "" || entry.ContentType == api.ManifestType {
 			return nil
 		}
-		fmt.Printf("Error downloading file.") // Can this happen ?)
+		addr, err := hexutil.Decode("0x" + entry.Hash)
+		if err != nil {
+			return err
+		}
+		data, err := sc.Getter.Download(sc.Ctx, addr)
+		if err != nil {
+			return err
+		}
+		return RebuildFile(collectionFilePath(dir, entry.Path), data)
+	})
+	if err != nil {
+		return err
 	}
-	return err
+	printf("Output directory without any failure: %v\n", dir)
+	result.Output = dir
+	return nil
 }
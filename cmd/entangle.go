@@ -5,15 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/config"
 	"github.com/relab/snarl-mw21/entangler"
 	"github.com/relab/snarl-mw21/repair"
 	"github.com/relab/snarl-mw21/swarmconnector"
@@ -25,9 +26,9 @@ import (
 // p - helical
 // s - horizontal
 // alpha - parities pr data
-var alpha, s, p int
-var doUpload, closelattice, listChunks bool
-var usePyramid bool = false
+var alpha, s, p, chunkSize int
+var doUpload, closelattice, listChunks, usePyramid, storeLocal, pinContent bool
+var collectionPath string
 
 var entangleCmd = &cobra.Command{
 	Use:   "entangle [swarm hash or path]",
@@ -35,11 +36,16 @@ var entangleCmd = &cobra.Command{
 	Long:  "Entangles a file using the given parameters",
 	Args:  cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		err := entangle(args[0], alpha, s, p)
+		result.Alpha, result.S, result.P = cfg.Alpha, cfg.S, cfg.P
+		err := entangle(args[0], cfg.Lattice)
 		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(1)
+			if !jsonOutput {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			fail(err)
 		}
+		printResult(nil)
 	},
 }
 
@@ -49,51 +55,147 @@ func init() {
 	entangleCmd.Flags().IntVarP(&s, "s", "s", 5, "Horizontal strands.")
 	entangleCmd.Flags().BoolVarP(&closelattice, "close", "c", true, "Closed Lattice")
 	entangleCmd.Flags().BoolVarP(&listChunks, "listchunks", "l", true, "Just list all the chunks addresses. No entangling.")
+	entangleCmd.Flags().StringVarP(&placementName, "placement", "", "", "Placement policy of the data blocks in the lattice: window (default), spread, subtree or random:seed. A single file must be entangled with --collection to record it.")
+	entangleCmd.Flags().IntVarP(&chunkSize, "chunksize", "", 0, "Chunk the file into chunks of this many bytes instead of the Swarm chunk size, as another chunker did.")
 
 	entangleCmd.Flags().BoolVarP(&doUpload, "doupload", "u", true, "Upload entangled file to Swarm")
+	entangleCmd.Flags().BoolVarP(&storeLocal, "local", "", false, "Store parities straight into the local chunk store instead of uploading them through the node.")
+	entangleCmd.Flags().BoolVarP(&pinContent, "pin", "", false, "Pin data and parity chunks, so they are never garbage collected.")
+	entangleCmd.Flags().StringVarP(&collectionPath, "collection", "", "", "Where to write the collection index of entangled Swarm content, or of the entangled file.")
 
 	rootCmd.AddCommand(entangleCmd)
 }
 
-func entangle(hashorpath string, alpha, s, p int) error {
-	var err error
-	var path string
+// entangle entangles the Swarm collection at hashorpath, or else the file at the path, in lattices
+// with the parameters of lc.
+func entangle(hashorpath string, lc config.Lattice) error {
 	dataAddr, err := hexutil.Decode(hashorpath)
-	if err != nil {
-		path, err = entangleFile(hashorpath, alpha, s, p)
-	} else {
-		path, err = entangleSwarmfile(dataAddr, alpha, s, p)
+	if err == nil {
+		return entangleCollection(dataAddr, lc)
 	}
 
+	// The placement policy of a single file is only recorded in a collection index of the file.
+	if lc.Placement != "" && doUpload && collectionPath == "" {
+		return errors.New("a placement policy must be recorded in a collection index, give --collection")
+	}
+	path, err := entangleFile(hashorpath, lc)
 	if err != nil {
-		log.Fatal(err.Error())
+		fail(err)
 	}
 	if doUpload {
-		for i := 0; i < alpha; i++ {
-			path := filepath.Join(path, strconv.Itoa(i))
-			manifestHash, contentHash, tagHash, err := uploadFile(path)
-			if err != nil {
-				fmt.Printf("Could not upload file. Error: %v\n", err.Error())
-			} else {
-				os.Remove(path)
-				fmt.Printf("Uploaded parity to Swarm. Manifest hash: %v, Tag hash: %v, Content hash: %v. Class: %d\n", string(manifestHash), tagHash, string(contentHash), i)
+		var parities [][]byte
+		sc := swarmconnector.NewSwarmConnectorConfig(cfg.Connection)
+		if parities, err = uploadParities(sc, path, lc.Alpha); err == nil {
+			printf("Parity root hashes: %v\n", joinHex(parities))
+			for i := 0; i < len(parities); i++ {
+				result.ParityRoots = append(result.ParityRoots, parities[i])
 			}
 		}
+		// The data of the file must already be in Swarm, as entangle only uploads the parities.
+		if err == nil && pinContent {
+			if err = pinData(sc, result.DataRoot); err != nil {
+				err = fmt.Errorf("could not pin the data of the file: %v", err)
+			}
+		}
+		if err == nil && collectionPath != "" {
+			err = writeFileCollection(filepath.Base(hashorpath), lc)
+		}
 	} else {
-		fmt.Printf("Entangled files located at: %v\n", path)
+		printf("Entangled files located at: %v\n", path)
+		result.Output = path
 	}
 
 	return err
 }
 
-func entangleFile(path string, alpha, s, p int) (string, error) {
+// writeFileCollection writes a collection index of the single file that was entangled with lc,
+// so that download --collection restores it with the placement policy and chunker it was entangled with.
+func writeFileCollection(name string, lc config.Lattice) error {
+	file := &entangler.EntangledFile{
+		Path:        name,
+		Size:        result.Size,
+		DataRoot:    result.DataRoot,
+		Pyramid:     usePyramid,
+		ChunkSize:   chunkSize,
+		Placement:   lc.Placement,
+		ParityRoots: result.ParityRoots,
+	}
+	collection := &entangler.Collection{Alpha: lc.Alpha, S: lc.S, P: lc.P, Files: []*entangler.EntangledFile{file}}
+	if err := collection.Write(collectionPath); err != nil {
+		return err
+	}
+	printf("Collection index: %v\n", collectionPath)
+	result.Collection = collectionPath
+	return nil
+}
+
+// uploadParities uploads the parity file of each class in dir as a raw chunk tree, or stores it
+// in the local chunk store, and returns the root addresses.
+func uploadParities(sc *swarmconnector.SwarmConnector, dir string, alpha int) ([][]byte, error) {
+	if !storeLocal {
+		if err := waitConnectionToPeers(cfg.Connection); err != nil {
+			return nil, err
+		}
+	}
+
+	rootAddrs := make([][]byte, alpha)
+	for i := 0; i < alpha; i++ {
+		path := filepath.Join(dir, strconv.Itoa(i))
+		rootAddr, err := uploadParity(sc, path)
+		if err != nil {
+			return nil, fmt.Errorf("could not upload parity of class %d: %v", i, err)
+		}
+		os.Remove(path)
+		printf("Uploaded parity to Swarm. Root hash: %x. Class: %d\n", rootAddr, i)
+		rootAddrs[i] = rootAddr
+	}
+	return rootAddrs, nil
+}
+
+func uploadParity(sc *swarmconnector.SwarmConnector, path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	fileinfo, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if storeLocal {
+		return sc.StoreLocal(file, fileinfo.Size(), pinContent)
+	}
+	rootAddr, tag, err := sc.Putter.UploadRaw(file, fileinfo.Size(), pinContent)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure that the syncing is completed before we continue.
+	seen, total, err := tag.Status(chunk.StateSeen)
+	if err == nil && total-seen > 0 {
+		err = waitForSyncing(sc.Putter, tag.Address.String())
+	}
+	return rootAddr, err
+}
+
+// pinData pins the content at addr, which is already stored in Swarm.
+func pinData(sc *swarmconnector.SwarmConnector, addr []byte) error {
+	if storeLocal {
+		return sc.PinLocal(addr)
+	}
+	return sc.Putter.Pin(addr, true)
+}
+
+func entangleFile(path string, lc config.Lattice) (string, error) {
 	reader, err := os.Open(path)
 	if err != nil {
-		log.Fatalf("Could not open file. %v", err)
+		fail(fmt.Errorf("could not open file: %v", err))
 	}
 	testtag := chunk.NewTag(0, "test-tag", 0, false)
 
-	putGetter := storage.NewHasherStore(utils.NewMapChunkStore(), storage.MakeHashFunc(storage.DefaultHash), false, testtag)
+	store := utils.NewMapChunkStore()
+	putGetter := storage.NewHasherStore(store, storage.MakeHashFunc(storage.DefaultHash), false, testtag)
 
 	//var addr storage.Address
 	var wait func(context.Context) error
@@ -108,60 +210,164 @@ func entangleFile(path string, alpha, s, p int) (string, error) {
 	// return "", nil
 	if usePyramid {
 		rootAddr, wait, err = storage.PyramidSplit(ctx, reader, putGetter, putGetter, testtag)
+	} else if chunkSize != 0 {
+		rootAddr, wait, err = splitTree(ctx, reader, store)
 	} else {
 		fileinfo, _ := reader.Stat()
 		rootAddr, wait, err = storage.TreeSplit(ctx, reader, fileinfo.Size(), putGetter)
 	}
-	fmt.Println(rootAddr)
+	if err != nil {
+		return "", err
+	}
+	printf("%v\n", rootAddr)
 	if err = wait(ctx); err != nil {
 		return "", err
 	}
 
 	treeRoot, err := swarmconnector.BuildCompleteTree(ctx, putGetter, storage.Reference(rootAddr),
-		swarmconnector.BuildTreeOptions{}, repair.NewMockRepair(putGetter))
+		swarmconnector.BuildTreeOptions{Pyramid: usePyramid, ChunkSize: chunkSize}, repair.NewMockRepair(putGetter))
 	if err != nil {
 		return "", err
 	}
+	result.DataRoot, result.Size, result.ChunkSize = hexutil.Bytes(rootAddr), treeRoot.SubtreeSize, chunkSize
+	result.Placement = lc.Placement
 
-	// Flatten the tree in canonical order.
-	flatTree := treeRoot.FlattenTreeWindow(s, p)
+	// Flatten the tree in the order of the lattice.
+	flatTree := treeRoot.FlattenTreePlacement(placementPolicy(lc), lc.S, lc.P)
 
 	dataChunks := make([][]byte, treeRoot.Index)
 	for i := 0; i < len(flatTree); i++ {
 		if listChunks {
-			fmt.Printf("%x\n", flatTree[i].Key)
+			printf("%x\n", flatTree[i].Key)
 		}
-		dataChunks[i] = flatTree[i].Data[swarmconnector.ChunkSizeOffset:]
+		dataChunks[i] = flatTree[i].StoredData()[swarmconnector.ChunkSizeOffset:]
 	}
 	if listChunks {
 		return "", errors.New("Just listed all keys.")
 	}
-	return handleEntangleBlocks(dataChunks, alpha, s, p)
+	return handleEntangleBlocks(dataChunks, lc)
 }
 
-func entangleSwarmfile(swarmhash []byte, alpha, s, p int) (string, error) {
-	var err error
-	sc := swarmconnector.NewSwarmConnector(ChunkDBPath, bzzKey, ChunkDBPath)
-	var trees []*swarmconnector.TreeChunk
-	trees, err = sc.BuildMultiTrees(swarmhash)
+// splitTree splits the file into chunks of --chunksize bytes, which the Swarm chunkers can not,
+// and puts them in store.
+func splitTree(ctx context.Context, file *os.File, store *utils.MapChunkStore) (chunk.Address, func(context.Context) error, error) {
+	fileinfo, err := file.Stat()
 	if err != nil {
-		return "", err
+		return nil, nil, err
+	}
+	chunks, err := swarmconnector.SplitTree(file, uint64(fileinfo.Size()), swarmconnector.ChunkerOptions{ChunkSize: chunkSize})
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := store.Put(ctx, chunk.ModePutUpload, chunks...); err != nil {
+		return nil, nil, err
+	}
+	return chunks[len(chunks)-1].Address(), func(context.Context) error { return nil }, nil
+}
+
+// entangleCollection entangles every file and manifest of the Swarm collection at addr, each
+// in a lattice of its own. The lattices are described by a collection index written to disk,
+// which download uses to restore the collection.
+func entangleCollection(addr []byte, lc config.Lattice) error {
+	sc := swarmconnector.NewSwarmConnectorConfig(cfg.Connection)
+	entries, err := sc.BuildCollection(addr)
+	if err != nil {
+		return err
 	}
 
-	// Flatten the tree in canonical order.
-	flatTree := trees[0].FlattenTreeWindow(s, p)
+	collection := &entangler.Collection{Manifest: addr, Alpha: lc.Alpha, S: lc.S, P: lc.P}
+	for _, entry := range entries {
+		dir, err := entangleSwarmfile(entry.Tree, lc)
+		if err != nil {
+			return err
+		}
+		if !doUpload {
+			printf("Entangled files of %q located at: %v\n", entry.Path, dir)
+			result.Files = append(result.Files, &fileResult{Output: dir, EntangledFile: &entangler.EntangledFile{
+				Path: entry.Path, ContentType: entry.ContentType, Size: entry.Tree.SubtreeSize,
+				DataRoot: entry.Addr, Pyramid: entry.Chunker.Pyramid, Placement: lc.Placement}})
+			continue
+		}
+		parities, err := uploadParities(sc, dir, lc.Alpha)
+		if err != nil {
+			return err
+		}
+		if pinContent {
+			if err := pinData(sc, entry.Addr); err != nil {
+				return fmt.Errorf("could not pin %q: %v", entry.Path, err)
+			}
+		}
+		file := &entangler.EntangledFile{
+			Path:        entry.Path,
+			ContentType: entry.ContentType,
+			Size:        entry.Tree.SubtreeSize,
+			DataRoot:    entry.Addr,
+			Pyramid:     entry.Chunker.Pyramid,
+			Placement:   lc.Placement,
+		}
+		for i := 0; i < len(parities); i++ {
+			file.ParityRoots = append(file.ParityRoots, parities[i])
+		}
+		collection.Files = append(collection.Files, file)
+		result.Files = append(result.Files, &fileResult{EntangledFile: file})
+	}
+	if !doUpload {
+		return nil
+	}
+
+	if collectionPath == "" {
+		f, err := ioutil.TempFile("", "snarl-collection-*.json")
+		if err != nil {
+			return err
+		}
+		f.Close()
+		collectionPath = f.Name()
+	}
+	if err := collection.Write(collectionPath); err != nil {
+		return err
+	}
+	printf("Entangled %d files and manifests. Collection index: %v\n", len(collection.Files), collectionPath)
+	result.Collection = collectionPath
+	return nil
+}
+
+// placementPolicy returns the placement policy of the data blocks of lc.
+func placementPolicy(lc config.Lattice) swarmconnector.PlacementPolicy {
+	policy, err := swarmconnector.ParsePlacement(lc.Placement)
+	if err != nil {
+		fail(err)
+	}
+	return policy
+}
+
+// joinHex returns the addresses as comma separated hex, the way download expects them.
+func joinHex(addrs [][]byte) string {
+	hexAddrs := make([]string, len(addrs))
+	for i := 0; i < len(addrs); i++ {
+		hexAddrs[i] = fmt.Sprintf("%x", addrs[i])
+	}
+	return strings.Join(hexAddrs, ",")
+}
+
+func entangleSwarmfile(tree *swarmconnector.TreeChunk, lc config.Lattice) (string, error) {
+	// Flatten the tree in the order of the lattice.
+	flatTree := tree.FlattenTreePlacement(placementPolicy(lc), lc.S, lc.P)
 
-	dataChunks := make([][]byte, trees[0].Index)
+	// Encrypted content is entangled as ciphertext, so the parities reveal nothing about the data.
+	dataChunks := make([][]byte, tree.Index)
 	for i := 0; i < len(flatTree); i++ {
-		dataChunks[i] = flatTree[i].Data[swarmconnector.ChunkSizeOffset:]
+		dataChunks[i] = flatTree[i].StoredData()[swarmconnector.ChunkSizeOffset:]
 	}
 
-	return handleEntangleBlocks(dataChunks, alpha, s, p)
+	return handleEntangleBlocks(dataChunks, lc)
 }
 
-func handleEntangleBlocks(data [][]byte, alpha, s, p int) (string, error) {
+func handleEntangleBlocks(data [][]byte, lc config.Lattice) (string, error) {
+	alpha, s, p := lc.Alpha, lc.S, lc.P
+	// Parities are uploaded as raw chunk trees with chunks of chunk.DefaultSize bytes, so every parity
+	// fills a chunk of its own even if the data has smaller chunks.
 	tangler := entangler.NewEntangler(p, p, s, alpha, chunk.DefaultSize)
-	result := make(chan *entangler.EntangledBlock)
+	blocks := make(chan *entangler.EntangledBlock)
 	done := make(chan struct{})
 
 	dir, err := ioutil.TempDir("", "entangled-files")
@@ -182,11 +388,11 @@ func handleEntangleBlocks(data [][]byte, alpha, s, p int) (string, error) {
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
-		defer close(result)
+		defer close(blocks)
 	ResultLoop:
 		for {
 			select {
-			case block := <-result:
+			case block := <-blocks:
 				if block.LeftIndex < 1 {
 					continue
 				}
@@ -209,10 +415,10 @@ func handleEntangleBlocks(data [][]byte, alpha, s, p int) (string, error) {
 		wg.Done()
 	}()
 	for i, j := 0, 1; i < len(data); i, j = i+1, j+1 {
-		tangler.Entangle(data[i], j, result)
+		tangler.Entangle(data[i], j, blocks)
 	}
 
-	tangler.WrapLattice(result)
+	tangler.WrapLattice(blocks)
 	done <- struct{}{}
 	wg.Wait()
 	for i := 0; i < alpha; i++ {
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/relab/snarl-mw21/daemon"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/spf13/cobra"
+)
+
+var outputFormat string
+var jsonOutput bool
+
+// result is the result document of the running command, printed with --output json.
+var result = &commandResult{}
+
+// commandResult is the structured result of a command.
+type commandResult struct {
+	Command      string            `json:"command"`
+	Alpha        int               `json:"alpha,omitempty"`
+	S            int               `json:"s,omitempty"`
+	P            int               `json:"p,omitempty"`
+	Size         uint64            `json:"size,omitempty"`
+	ChunkSize    int               `json:"chunkSize,omitempty"` // Chunk size of the data tree, if not the default
+	Placement    string            `json:"placement,omitempty"` // Placement policy of the data blocks, if not the default
+	ManifestHash string            `json:"manifestHash,omitempty"`
+	TagHash      hexutil.Bytes     `json:"tagHash,omitempty"`
+	ContentHash  hexutil.Bytes     `json:"contentHash,omitempty"`
+	DataRoot     hexutil.Bytes     `json:"dataRoot,omitempty"`
+	ParityRoots  []hexutil.Bytes   `json:"parityRoots,omitempty"` // One per strand class
+	Output       string            `json:"output,omitempty"`      // File or directory written by the command
+	Collection   string            `json:"collection,omitempty"`  // Collection index read or written by the command
+	Files        []*fileResult     `json:"files,omitempty"`       // Files of a collection
+	Repair       *repairStats      `json:"repair,omitempty"`
+	Health       []*fileHealth     `json:"health,omitempty"`       // Health reports of verify
+	Repairs      []*fileRepair     `json:"repairs,omitempty"`      // Repair reports of repair
+	StoredChunks int               `json:"storedChunks,omitempty"` // Chunks stored by the command
+	Simulation   *simulationResult `json:"simulation,omitempty"`   // Runs of simulate and their summary
+	Registry     []*daemon.Entry   `json:"registry,omitempty"`     // Files of the daemon
+	Listen       string            `json:"listen,omitempty"`       // Address of the HTTP server of the command
+	Error        string            `json:"error,omitempty"`
+}
+
+// fileResult is the result for a single file of a collection.
+type fileResult struct {
+	*entangler.EntangledFile
+	Output string       `json:"output,omitempty"`
+	Repair *repairStats `json:"repair,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// repairStats are the statistics of a lattice after a download.
+type repairStats struct {
+	DataBlocks       int           `json:"dataBlocks"`
+	DataDownloaded   int           `json:"dataDownloaded"`
+	DataRepaired     int           `json:"dataRepaired"`
+	ParityBlocks     int           `json:"parityBlocks"`
+	ParityDownloaded int           `json:"parityDownloaded"`
+	ParityRepaired   int           `json:"parityRepaired"`
+	Duration         time.Duration `json:"duration"`
+
+	CrossCheck *entangler.CrossCheckStats `json:"crossCheck,omitempty"` // Only with --crosscheck
+}
+
+// latticeStats counts the downloaded and repaired blocks of the lattice.
+func latticeStats(lattice *entangler.Lattice, duration time.Duration) *repairStats {
+	stats := &repairStats{DataBlocks: lattice.NumDataBlocks, ParityBlocks: len(lattice.Blocks) - lattice.NumDataBlocks,
+		Duration: duration}
+	for _, b := range lattice.Blocks {
+		downloaded := b.DownloadStatus == entangler.DownloadSuccess
+		repaired := b.RepairStatus == entangler.RepairSuccess
+		switch {
+		case b.IsParity && downloaded:
+			stats.ParityDownloaded++
+		case b.IsParity && repaired:
+			stats.ParityRepaired++
+		case downloaded:
+			stats.DataDownloaded++
+		case repaired:
+			stats.DataRepaired++
+		}
+	}
+	if lattice.CrossCheck {
+		check := lattice.CrossCheckStats()
+		stats.CrossCheck = &check
+	}
+	return stats
+}
+
+// setOutput validates --output and starts the result document of cmd.
+func setOutput(cmd *cobra.Command, args []string) error {
+	switch outputFormat {
+	case "text":
+	case "json":
+		jsonOutput = true
+	default:
+		return fmt.Errorf("unknown output format %q", outputFormat)
+	}
+	result.Command = strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+	return nil
+}
+
+// textOut is where commands print free-form text. With JSON output, stdout only carries the
+// result document, and the text goes to stderr instead. The same goes for the bytes of a range download.
+func textOut() io.Writer {
+	if jsonOutput || byteRange != "" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// printf prints free-form text to textOut.
+func printf(format string, a ...interface{}) {
+	fmt.Fprintf(textOut(), format, a...)
+}
+
+// printResult prints the result document with JSON output, including err if it is not nil.
+func printResult(err error) {
+	if !jsonOutput {
+		return
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// fail ends the command with err. With JSON output, the error is reported in the result document.
+func fail(err error) {
+	if !jsonOutput {
+		log.Fatal(err)
+	}
+	printResult(err)
+	os.Exit(1)
+}
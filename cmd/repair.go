@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/relab/snarl-mw21/config"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/spf13/cobra"
+)
+
+var repairCmd = &cobra.Command{
+	Use:   "repair [swarm hashes]",
+	Short: "Repair an entangled file and upload the missing chunks",
+	Long: "Probes an entangled file or collection, reconstructs every missing data and parity chunk with the " +
+		"lattice and stores them again. Running it again after an interruption continues with the chunks " +
+		"that are still missing. The swarm hashes are the size in hex, the data root and the parity roots, separated by commas.",
+	Run: func(cmd *cobra.Command, args []string) {
+		files, err := entangledFiles(args)
+		if err != nil {
+			fail(err)
+		}
+		if err := repairFiles(files, cfg.Lattice, textOut()); err != nil {
+			fail(err)
+		}
+		printResult(nil)
+	},
+}
+
+func init() {
+	repairCmd.Flags().IntVarP(&alpha, "alpha", "a", 3, "Parities per data block.")
+	repairCmd.Flags().IntVarP(&p, "p", "p", 5, "Helical strands.")
+	repairCmd.Flags().IntVarP(&s, "s", "s", 5, "Horizontal strands.")
+	repairCmd.Flags().StringVarP(&collectionPath, "collection", "", "", "Collection index written by entangle. Repairs every file.")
+	repairCmd.Flags().StringVarP(&placementName, "placement", "", "", "Placement policy of the data blocks in the lattice: window (default), spread, subtree or random:seed.")
+	repairCmd.Flags().IntVarP(&chunkSize, "chunksize", "", 0, "File was chunked into chunks of this many bytes instead of the Swarm chunk size.")
+	repairCmd.Flags().BoolVarP(&pinContent, "pin", "", false, "Pin the repaired chunks, so they are never garbage collected.")
+
+	rootCmd.AddCommand(repairCmd)
+}
+
+// fileRepair is the repair report of a single entangled file.
+type fileRepair struct {
+	Before *fileHealth `json:"before"`
+	After  *fileHealth `json:"after,omitempty"`
+	Stored int         `json:"storedChunks"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// repairFiles heals every file, sets the reports of the health before and after in the result
+// document and writes them to w.
+func repairFiles(files []*entangler.EntangledFile, lc config.Lattice, w io.Writer) error {
+	sc := swarmconnector.NewSwarmConnectorConfig(cfg.Connection)
+	if err := waitConnectionToPeers(cfg.Connection); err != nil {
+		return err
+	}
+	store := func(chunks []chunk.Chunk) error {
+		return sc.PutLocal(chunks, pinContent)
+	}
+
+	var failed int
+	reports := make([]*fileRepair, len(files))
+	for i, file := range files {
+		report := &fileRepair{}
+		reports[i] = report
+
+		lattice, err := newLattice(sc, file.Lattice(lc), file.Size, file.DataRoot, file.ParityAddrs(), file.Chunker())
+		if err != nil {
+			return err
+		}
+		health := lattice.CheckHealth(sc.Getter)
+		report.Before = &fileHealth{Path: file.Path, DataRoot: file.DataRoot,
+			FullyRecoverable: health.FullyRecoverable(), Health: health}
+		if health.Complete() {
+			continue
+		}
+
+		stored, err := lattice.Heal(health, store)
+		report.Stored = stored
+		result.StoredChunks += stored
+		if err != nil {
+			report.Error = err.Error()
+			failed++
+		}
+
+		// A new lattice probes the chunks again, instead of reusing what was repaired.
+		lattice, err = newLattice(sc, file.Lattice(lc), file.Size, file.DataRoot, file.ParityAddrs(), file.Chunker())
+		if err != nil {
+			return err
+		}
+		health = lattice.CheckHealth(sc.Getter)
+		report.After = &fileHealth{Path: file.Path, DataRoot: file.DataRoot,
+			FullyRecoverable: health.FullyRecoverable(), Health: health}
+	}
+
+	result.Repairs = reports
+	for _, report := range reports {
+		printRepair(w, report)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files could not be repaired", failed, len(files))
+	}
+	return nil
+}
+
+// printRepair writes a repair report in text form.
+func printRepair(w io.Writer, report *fileRepair) {
+	fmt.Fprintf(w, "Before repair:\n")
+	printHealth(w, report.Before)
+	if report.After == nil {
+		fmt.Fprintf(w, "Nothing to repair.\n")
+		return
+	}
+	if report.Error != "" {
+		fmt.Fprintf(w, "Repair failed: %v\n", report.Error)
+	}
+	fmt.Fprintf(w, "Stored %d repaired chunks.\n", report.Stored)
+	fmt.Fprintf(w, "After repair:\n")
+	printHealth(w, report.After)
+}
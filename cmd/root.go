@@ -2,11 +2,11 @@ package cmd
 
 import (
 	"errors"
-	"fmt"
 	"time"
 
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/relab/snarl-mw21/config"
 	"github.com/spf13/cobra"
 	"golang.org/x/net/context"
 )
@@ -16,6 +16,12 @@ var minNumPeers int
 
 var rootCmd = &cobra.Command{
 	Use: "snarl",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := setOutput(cmd, args); err != nil {
+			return err
+		}
+		return loadConfig(cmd)
+	},
 }
 
 func Execute() {
@@ -24,12 +30,17 @@ func Execute() {
 	rootCmd.PersistentFlags().StringVarP(&SnarlDBPath, "snarldbpath", "", "", "Physical location of Snarl chunks.")
 	rootCmd.PersistentFlags().StringVarP(&ipcPath, "ipcpath", "", "", "Ethereum Inter-process Communications file")
 	rootCmd.PersistentFlags().IntVarP(&minNumPeers, "numPeers", "", 9, "Minimum number of peers connected")
+	rootCmd.PersistentFlags().BoolVarP(&usePyramid, "pyramid", "", false, "Chunk with the pyramid chunker, or read content chunked with it. Detected when reading if the root chunk is available.")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "", "text", "Output format: text, or json for a single result document.")
+	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "", "", "Configuration file with named profiles. Defaults to $SNARL_CONFIG, or snarl/config.yaml in the user's configuration directory.")
+	rootCmd.PersistentFlags().StringVarP(&profileName, "profile", "", "", "Profile of the configuration file. Defaults to $SNARL_PROFILE, or the default profile of the file.")
 
 	_ = rootCmd.Execute()
 }
 
-func waitConnectionToPeers(minNumPeers int) error {
-	client, _ := rpc.DialIPC(context.Background(), ipcPath)
+func waitConnectionToPeers(c config.Connection) error {
+	minNumPeers := c.NumPeers
+	client, _ := rpc.DialIPC(context.Background(), c.IPCPath)
 	retryLeft := 3000 // Try 300 * 100ms = 300 seconds
 	var peers []*p2p.PeerInfo
 	_ = client.Call(&peers, "admin_peers")
@@ -40,7 +51,7 @@ func waitConnectionToPeers(minNumPeers int) error {
 		retryLeft--
 	}
 
-	fmt.Printf("Connected to %v peers. Retries left: %v\n", len(peers), retryLeft)
+	printf("Connected to %v peers. Retries left: %v\n", len(peers), retryLeft)
 	if retryLeft == 0 {
 		return errors.New("Could not connect.")
 	}
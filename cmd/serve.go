@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/relab/snarl-mw21/snarl"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/spf13/cobra"
+)
+
+var gatewayAddr string
+var gatewayCache int
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve entangled collections over HTTP",
+	Long: "Runs a local HTTP gateway that serves GET /snarl/<manifest>/<path> for the collections of the " +
+		"collection index, or of every index in a directory. Missing chunks of the requested range are repaired " +
+		"through the lattices while the response is streamed. Range requests are supported, the ETag is the " +
+		"address of the content, and the " + snarl.RepairedChunksHeader + " trailer reports how many chunks were repaired.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if collectionPath == "" {
+			fail(errors.New("must specify a collection index"))
+		}
+		collections, err := snarl.ReadCollections(collectionPath)
+		if err != nil {
+			fail(err)
+		}
+		sc := swarmconnector.NewSwarmConnectorConfig(cfg.Connection)
+		if err := waitConnectionToPeers(cfg.Connection); err != nil {
+			fail(err)
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+		server := &http.Server{Addr: gatewayAddr, Handler: snarl.NewGateway(sc.Ctx, sc.Getter, gatewayCache, collections...)}
+		go func() {
+			<-ctx.Done()
+			server.Shutdown(context.Background())
+		}()
+		for _, c := range collections {
+			printf("Serving %d files at http://%v%s%x/\n", len(c.Files), gatewayAddr, snarl.GatewayPrefix, []byte(c.Manifest))
+		}
+		result.Collection, result.Listen = collectionPath, gatewayAddr
+		printResult(nil)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fail(err)
+		}
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVarP(&collectionPath, "collection", "", "", "Collection index written by entangle, or a directory of them.")
+	serveCmd.Flags().StringVarP(&gatewayAddr, "listen", "", "localhost:8600", "Address of the gateway.")
+	serveCmd.Flags().IntVarP(&gatewayCache, "cache", "", 64, "Decoded chunks kept per request.")
+
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/relab/snarl-mw21/redundancy"
+	"github.com/relab/snarl-mw21/simulation"
+	"github.com/spf13/cobra"
+)
+
+var simChunks uint64
+var failureModel string
+var failRate, replication, propReplication, repFirstCol, numNodes, simRuns int
+var storageDepth, neighbourhoods, neighbourhoodDepth int
+var rndPlacement bool
+var simSeed int64
+var schemeNames []string
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Simulate failures on an in-memory lattice",
+	Long: "Entangles a file of random data in memory and downloads it repeatedly, each time with new failures " +
+		"drawn from the failure model: uniform or proportional replication of chunks, or chunks placed on nodes " +
+		"that fail, or chunks stored by the nodes closest to their addresses, as in Kademlia, where whole nodes " +
+		"and neighbourhoods fail. Reports the recovery, the fetched bytes and the latency of every run as CSV, or with their summary in the result document with --output json.\n\n" +
+		"With --scheme, the file is instead encoded with each of the given redundancy schemes, its blocks are placed " +
+		"on random nodes, and every run fails the same nodes for all schemes. The schemes are only simulated; " +
+		"entangle and download always use alpha entanglement.",
+	Run: func(cmd *cobra.Command, args []string) {
+		var err error
+		if len(schemeNames) > 0 {
+			err = compareSchemes()
+		} else {
+			err = simulate()
+		}
+		if err != nil {
+			fail(err)
+		}
+		printResult(nil)
+	},
+}
+
+func init() {
+	simulateCmd.Flags().IntVarP(&alpha, "alpha", "a", 3, "Parities per data block.")
+	simulateCmd.Flags().IntVarP(&p, "p", "p", 5, "Helical strands.")
+	simulateCmd.Flags().IntVarP(&s, "s", "s", 5, "Horizontal strands.")
+	simulateCmd.Flags().Uint64VarP(&simChunks, "chunks", "", 256, "Size of the simulated file in chunks.")
+	simulateCmd.Flags().StringVarP(&failureModel, "model", "m", "uniform", "Failure model: uniform, proportional, node or kademlia.")
+	simulateCmd.Flags().IntVarP(&failRate, "failrate", "", 10, "Percentage of the chunks, or of the nodes, that fail.")
+	simulateCmd.Flags().IntVarP(&replication, "replication", "r", 1, "Replicas of every leaf chunk.")
+	simulateCmd.Flags().IntVarP(&propReplication, "propreplication", "", 0, "Average replicas per data chunk with proportional replication.")
+	simulateCmd.Flags().IntVarP(&repFirstCol, "repfirstcol", "", 0, "Strengthen the first parities of every strand with proportional replication.")
+	simulateCmd.Flags().IntVarP(&numNodes, "nodes", "n", 100, "Number of storage nodes in the node model.")
+	simulateCmd.Flags().IntVarP(&storageDepth, "depth", "", 4, "Leading address bits a node shares with the chunks it stores in the kademlia model.")
+	simulateCmd.Flags().IntVarP(&neighbourhoods, "neighbourhoods", "", 0, "Neighbourhoods where every node fails in the kademlia model.")
+	simulateCmd.Flags().IntVarP(&neighbourhoodDepth, "neighbourhooddepth", "", 4, "Leading address bits shared by the nodes of a failed neighbourhood.")
+	simulateCmd.Flags().BoolVarP(&rndPlacement, "rndplacement", "", false, "Place the chunks on random nodes in the node model.")
+	simulateCmd.Flags().Int64VarP(&simSeed, "seed", "", time.Now().UnixNano(), "Seed of the failures.")
+	simulateCmd.Flags().IntVarP(&simRuns, "runs", "", 10, "Number of runs.")
+	simulateCmd.Flags().StringArrayVarP(&schemeNames, "scheme", "", nil,
+		"Redundancy scheme to compare, repeatable: entanglement:alpha,s,p, rs:k,m or replication:copies.")
+
+	rootCmd.AddCommand(simulateCmd)
+}
+
+// simulationModels returns the placement and failure models of the named failure model. The node
+// model uses proportional replication if an average replication is given. The kademlia model
+// places the chunks by their addresses instead.
+func simulationModels(name string) (simulation.PlacementModel, simulation.FailureModel, error) {
+	var placement simulation.PlacementModel = simulation.UniformPlacement{Replication: replication}
+	if name == "proportional" || propReplication > 0 {
+		placement = simulation.ProportionalPlacement{LeafReplication: replication, Replication: propReplication, RepFirstCol: repFirstCol}
+	}
+	switch name {
+	case "uniform", "proportional":
+		return placement, simulation.ChunkFailure{Percent: failRate}, nil
+	case "node":
+		return placement, simulation.NodeFailure{Percent: failRate, Nodes: numNodes, RandomPlacement: rndPlacement}, nil
+	case "kademlia":
+		network := simulation.NewNetwork(numNodes, storageDepth, rand.New(rand.NewSource(simSeed)))
+		return network, simulation.NeighbourhoodFailure{Network: network, Percent: failRate,
+			Neighbourhoods: neighbourhoods, Depth: neighbourhoodDepth}, nil
+	}
+	return nil, nil, fmt.Errorf("unknown failure model %q", name)
+}
+
+// simulationResult is the result of a simulation, with either the runs of the failure model
+// or those of the compared redundancy schemes.
+type simulationResult struct {
+	Model   string                     `json:"model,omitempty"`
+	Seed    int64                      `json:"seed"`
+	Summary *simulation.Summary        `json:"summary,omitempty"`
+	Runs    []*simulation.Result       `json:"runs,omitempty"`
+	Schemes []*simulation.SchemeResult `json:"schemes,omitempty"`
+}
+
+// simulate runs the simulation of the failure model given by --model.
+func simulate() error {
+	placement, failures, err := simulationModels(failureModel)
+	if err != nil {
+		return err
+	}
+	sc, err := simulation.NewScenario(simChunks*chunk.DefaultSize, cfg.Alpha, cfg.S, cfg.P)
+	if err != nil {
+		return err
+	}
+	results, err := simulation.Experiment(sc, placement, failures, simRuns, simSeed)
+	if err != nil {
+		return err
+	}
+	result.Alpha, result.S, result.P = cfg.Alpha, cfg.S, cfg.P
+	result.Simulation = &simulationResult{Model: failureModel, Seed: simSeed, Summary: simulation.Summarize(results), Runs: results}
+	if jsonOutput {
+		return nil
+	}
+	return printSimulationCSV(os.Stdout, results)
+}
+
+// compareSchemes runs the comparison of the redundancy schemes given by --scheme, with the file
+// size, nodes, failure rate, runs and seed of the simulation.
+func compareSchemes() error {
+	schemes := make([]redundancy.Scheme, len(schemeNames))
+	for i, name := range schemeNames {
+		scheme, err := redundancy.Parse(name)
+		if err != nil {
+			return err
+		}
+		schemes[i] = scheme
+	}
+	results, err := simulation.CompareSchemes(schemes, int(simChunks), chunk.DefaultSize, numNodes, failRate, simRuns, simSeed)
+	if err != nil {
+		return err
+	}
+	result.Simulation = &simulationResult{Seed: simSeed, Schemes: results}
+	if jsonOutput {
+		return nil
+	}
+	out := csv.NewWriter(os.Stdout)
+	out.Write([]string{"run", "scheme", "blocks", "lost", "recovered", "missing_data"})
+	for _, r := range results {
+		out.Write([]string{strconv.Itoa(r.Run), r.Scheme, strconv.Itoa(r.Blocks), strconv.Itoa(r.Lost),
+			strconv.FormatBool(r.Recovered), strconv.Itoa(r.MissingData)})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// printSimulationCSV writes one line per run.
+func printSimulationCSV(w io.Writer, results []*simulation.Result) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"run", "failed_chunks", "recovered", "missing_data", "repaired_data",
+		"chunks_fetched", "bytes_fetched", "latency_ns", "error"})
+	for _, r := range results {
+		out.Write([]string{strconv.Itoa(r.Run), strconv.Itoa(r.FailedChunks), strconv.FormatBool(r.Recovered),
+			strconv.Itoa(r.MissingData), strconv.Itoa(r.RepairedData), strconv.FormatInt(r.ChunksFetched, 10),
+			strconv.FormatInt(r.BytesFetched, 10), strconv.FormatInt(r.Latency.Nanoseconds(), 10), r.Error})
+	}
+	out.Flush()
+	return out.Error()
+}
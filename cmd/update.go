@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/spf13/cobra"
+)
+
+var updateOffset uint64
+var updateFile, updatePath string
+
+var updateCmd = &cobra.Command{
+	Use:   "update [manifest or swarm hashes]",
+	Short: "Update part of an entangled file in place",
+	Long: "Writes the content of --file over an entangled file at --offset, without changing its size. Only the " +
+		"parities downstream of the changed chunks on each strand are recomputed, and only the chunks that change " +
+		"are stored. The manifest is a collection index written by entangle, which is updated with the new roots; " +
+		"the Swarm manifests of the collection are left as they are. The swarm hashes are the size in hex, the data " +
+		"root and the parity roots, separated by commas.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := update(args[0]); err != nil {
+			fail(err)
+		}
+		printResult(nil)
+	},
+}
+
+func init() {
+	updateCmd.Flags().Uint64VarP(&updateOffset, "offset", "", 0, "Offset in the entangled file where the content is written.")
+	updateCmd.Flags().StringVarP(&updateFile, "file", "", "", "File with the new content.")
+	updateCmd.Flags().StringVarP(&updatePath, "path", "", "", "Path of the file to update in the collection. Needed if it has more than one file.")
+	updateCmd.Flags().IntVarP(&alpha, "alpha", "a", 3, "Parities per data block.")
+	updateCmd.Flags().IntVarP(&p, "p", "p", 5, "Helical strands.")
+	updateCmd.Flags().IntVarP(&s, "s", "s", 5, "Horizontal strands.")
+	updateCmd.Flags().StringVarP(&placementName, "placement", "", "", "Placement policy of the data blocks in the lattice: window (default), spread, subtree or random:seed.")
+	updateCmd.Flags().IntVarP(&chunkSize, "chunksize", "", 0, "File was chunked into chunks of this many bytes instead of the Swarm chunk size.")
+	updateCmd.Flags().BoolVarP(&pinContent, "pin", "", false, "Pin the new chunks, so they are never garbage collected.")
+
+	rootCmd.AddCommand(updateCmd)
+}
+
+// update writes the content of --file over the entangled file given by arg, and stores the chunks that change.
+func update(arg string) error {
+	if updateFile == "" {
+		return errors.New("must specify the file with the new content")
+	}
+	file, collection, err := updateTarget(arg)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(updateFile)
+	if err != nil {
+		return err
+	}
+
+	sc := swarmconnector.NewSwarmConnectorConfig(cfg.Connection)
+	if err := waitConnectionToPeers(cfg.Connection); err != nil {
+		return err
+	}
+	lattice, err := newLattice(sc, file.Lattice(cfg.Lattice), file.Size, file.DataRoot, file.ParityAddrs(), file.Chunker())
+	if err != nil {
+		return err
+	}
+	fileUpdate, err := lattice.UpdateFile(updateOffset, data)
+	if err != nil {
+		return err
+	}
+	if err := sc.PutLocal(fileUpdate.Chunks, pinContent); err != nil {
+		return err
+	}
+
+	file.DataRoot = fileUpdate.DataRoot
+	file.ParityRoots = make([]hexutil.Bytes, len(fileUpdate.ParityRoots))
+	for i := 0; i < len(fileUpdate.ParityRoots); i++ {
+		file.ParityRoots[i] = fileUpdate.ParityRoots[i]
+	}
+	result.Size, result.DataRoot, result.ParityRoots = file.Size, file.DataRoot, file.ParityRoots
+	result.StoredChunks = len(fileUpdate.Chunks)
+	printf("Stored %d changed chunks. Swarm hashes: %x,%x,%v\n", len(fileUpdate.Chunks), file.Size,
+		[]byte(file.DataRoot), joinHex(fileUpdate.ParityRoots))
+
+	if collection == nil {
+		return nil
+	}
+	if err := collection.Write(arg); err != nil {
+		return err
+	}
+	printf("Updated collection index: %v\n", arg)
+	result.Collection = arg
+	return nil
+}
+
+// updateTarget returns the file to update. If arg is a collection index, the file is the one at --path,
+// and the collection is returned as well so it can be written with the new roots.
+func updateTarget(arg string) (*entangler.EntangledFile, *entangler.Collection, error) {
+	if _, err := os.Stat(arg); err != nil {
+		files, err := entangledFiles([]string{arg})
+		if err != nil {
+			return nil, nil, err
+		}
+		return files[0], nil, nil
+	}
+
+	collection, err := entangler.ReadCollection(arg)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg.Lattice = collection.Lattice()
+	for _, file := range collection.Files {
+		if file.Path == updatePath || (updatePath == "" && len(collection.Files) == 1) {
+			return file, collection, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("collection %v has no file at path %q", arg, updatePath)
+}
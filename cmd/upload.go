@@ -3,7 +3,6 @@ package cmd
 import (
 	"errors"
 	"fmt"
-	"log"
 	"os"
 	"time"
 
@@ -16,7 +15,7 @@ import (
 	"golang.org/x/net/context"
 )
 
-var verifyUpload, verbose, simulateUpload bool
+var verifyUpload, verbose, simulateUpload, encryptUpload bool
 
 var uploadCmd = &cobra.Command{
 	Use:   "upload [path]",
@@ -28,8 +27,9 @@ var uploadCmd = &cobra.Command{
 			_, err := verifyUploadSynced(args[0])
 
 			if err != nil {
-				fmt.Printf("Err: %v\n", err)
+				printf("Err: %v\n", err)
 			}
+			printResult(err)
 			return
 		}
 		var manifestHash, contentHash, tagHash []byte
@@ -37,15 +37,19 @@ var uploadCmd = &cobra.Command{
 		if simulateUpload {
 			contentHash, err = getContentHashForFile(args[0])
 		} else {
-			manifestHash, contentHash, tagHash, err = uploadFile(args[0])
+			manifestHash, contentHash, tagHash, err = uploadFile(args[0], encryptUpload)
 		}
 
+		result.ManifestHash, result.TagHash, result.ContentHash = string(manifestHash), tagHash, contentHash
 		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(1)
-
+			if !jsonOutput {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			fail(err)
 		}
-		fmt.Printf("Uploaded file to Swarm. Manifest hash: %v, Tag hash: %064x, Content hash: %064x\n", string(manifestHash), tagHash, contentHash)
+		printf("Uploaded file to Swarm. Manifest hash: %v, Tag hash: %064x, Content hash: %x\n", string(manifestHash), tagHash, contentHash)
+		printResult(nil)
 	},
 }
 
@@ -53,18 +57,19 @@ func init() {
 	uploadCmd.Flags().BoolVarP(&verifyUpload, "verifyupload", "v", false, "Just verify that the upload was successfully synced in the network.")
 	uploadCmd.Flags().BoolVarP(&verbose, "verbose", "", false, "Verbose syncing printing")
 	uploadCmd.Flags().BoolVarP(&simulateUpload, "simulate", "", false, "Simulate upload")
+	uploadCmd.Flags().BoolVarP(&encryptUpload, "encrypt", "e", false, "Encrypt the file. The content hash will include the decryption key.")
 	rootCmd.AddCommand(uploadCmd)
 }
 
 func verifyUploadSynced(hash string) (bool, error) {
-	sc := swarmconnector.NewSwarmConnector(ChunkDBPath, bzzKey, SnarlDBPath)
+	sc := swarmconnector.NewSwarmConnectorConfig(cfg.Connection)
 	tag, err := sc.Putter.GetChunkTag(hash)
 
 	if err != nil {
 		return false, err
 	}
 
-	fmt.Printf("%+v", tag)
+	printf("%+v", tag)
 
 	return true, nil
 }
@@ -73,7 +78,7 @@ func verifyUploadSynced(hash string) (bool, error) {
 func getContentHashForFile(filepath string) ([]byte, error) {
 	reader, err := os.Open(filepath)
 	if err != nil {
-		log.Fatalf("Could not open file. %v", err)
+		fail(fmt.Errorf("could not open file: %v", err))
 	}
 	defer reader.Close()
 
@@ -101,11 +106,11 @@ func getContentHashForFile(filepath string) ([]byte, error) {
 }
 
 // uploadFile returns ManifestHash, ContentHash, TagHash, (error).
-func uploadFile(filepath string) ([]byte, []byte, []byte, error) {
-	sc := swarmconnector.NewSwarmConnector(ChunkDBPath, bzzKey, SnarlDBPath)
+func uploadFile(filepath string, toEncrypt bool) ([]byte, []byte, []byte, error) {
+	sc := swarmconnector.NewSwarmConnectorConfig(cfg.Connection)
 
 	// 2. Ensure we are connected to enough peers
-	if err := waitConnectionToPeers(minNumPeers); err != nil {
+	if err := waitConnectionToPeers(cfg.Connection); err != nil {
 		return nil, nil, nil, err
 	}
 
@@ -116,7 +121,7 @@ func uploadFile(filepath string) ([]byte, []byte, []byte, error) {
 	}
 	defer file.Close()
 
-	manifestHash, tag, err := sc.Putter.UploadFile(file)
+	manifestHash, tag, err := sc.Putter.UploadFile(file, toEncrypt)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -135,6 +140,9 @@ func uploadFile(filepath string) ([]byte, []byte, []byte, error) {
 	}
 
 	// Could not retrieve the manifest for some reason.. Trying to figure out the contentHash by ourselves.
+	if toEncrypt {
+		return manifestHash, nil, tag.Address, errors.New("could not find content hash of encrypted file")
+	}
 	testtag := chunk.NewTag(0, "test-tag", 0, false)
 	putGetter := storage.NewHasherStore(utils.NewMapChunkStore(), storage.MakeHashFunc(storage.DefaultHash), false, testtag)
 
@@ -161,7 +169,7 @@ func waitForSyncing(putter *swarmconnector.SnarlPutter, hash string) error {
 
 		count, total, err := tag.Status(chunk.StateSynced)
 		if verbose {
-			fmt.Printf("Count: %v, Total: %v. i: %v, addr: %v\n", count, total, i, hash)
+			printf("Count: %v, Total: %v. i: %v, addr: %v\n", count, total, i, hash)
 		}
 
 		if err != nil {
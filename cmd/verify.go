@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/relab/snarl-mw21/config"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [swarm hashes]",
+	Short: "Verify that an entangled file can be recovered",
+	Long: "Probes the availability of every data chunk, parity chunk and internal node of an entangled file " +
+		"or collection without downloading the leaves, and reports whether the content can be recovered. " +
+		"The swarm hashes are the size in hex, the data root and the parity roots, separated by commas.",
+	Run: func(cmd *cobra.Command, args []string) {
+		files, err := entangledFiles(args)
+		if err != nil {
+			fail(err)
+		}
+		recoverable, err := verify(files, cfg.Lattice, textOut())
+		if err != nil {
+			fail(err)
+		}
+		printResult(nil)
+		if !recoverable {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	verifyCmd.Flags().IntVarP(&alpha, "alpha", "a", 3, "Parities per data block.")
+	verifyCmd.Flags().IntVarP(&p, "p", "p", 5, "Helical strands.")
+	verifyCmd.Flags().IntVarP(&s, "s", "s", 5, "Horizontal strands.")
+	verifyCmd.Flags().StringVarP(&collectionPath, "collection", "", "", "Collection index written by entangle. Verifies every file.")
+	verifyCmd.Flags().StringVarP(&placementName, "placement", "", "", "Placement policy of the data blocks in the lattice: window (default), spread, subtree or random:seed.")
+	verifyCmd.Flags().IntVarP(&chunkSize, "chunksize", "", 0, "File was chunked into chunks of this many bytes instead of the Swarm chunk size.")
+
+	rootCmd.AddCommand(verifyCmd)
+}
+
+// fileHealth is the health report of a single entangled file.
+type fileHealth struct {
+	Path             string        `json:"path,omitempty"`
+	DataRoot         hexutil.Bytes `json:"dataRoot"`
+	FullyRecoverable bool          `json:"fullyRecoverable"`
+	*entangler.Health
+}
+
+// entangledFiles returns the files given either by the collection index or by swarm hashes in args.
+// The lattice parameters of a collection replace those given by flags.
+func entangledFiles(args []string) ([]*entangler.EntangledFile, error) {
+	if collectionPath != "" {
+		collection, err := entangler.ReadCollection(collectionPath)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Lattice = collection.Lattice()
+		return collection.Files, nil
+	}
+	if len(args) != 1 {
+		return nil, errors.New("must specify swarm hashes or a collection index")
+	}
+	file, err := parseSwarmHashes(args[0])
+	if err != nil {
+		return nil, err
+	}
+	file.Pyramid, file.ChunkSize, file.Placement = usePyramid, chunkSize, cfg.Placement
+	return []*entangler.EntangledFile{file}, nil
+}
+
+// parseSwarmHashes reads the size in hex, the data root and the parity roots of a file, separated by commas.
+func parseSwarmHashes(arg string) (*entangler.EntangledFile, error) {
+	hashes := strings.Split(arg, ",")
+	if len(hashes) < 3 {
+		return nil, errors.New("must specify the size, the data root and the parity roots")
+	}
+	size, err := strconv.ParseUint(strings.TrimPrefix(hashes[0], "0x"), 16, 64)
+	if err != nil {
+		return nil, err
+	}
+	file := &entangler.EntangledFile{Size: size, ParityRoots: make([]hexutil.Bytes, len(hashes)-2)}
+	for i := 1; i < len(hashes); i++ {
+		addr, err := hexutil.Decode("0x" + strings.TrimPrefix(hashes[i], "0x"))
+		if err != nil {
+			return nil, err
+		}
+		if i == 1 {
+			file.DataRoot = addr
+		} else {
+			file.ParityRoots[i-2] = addr
+		}
+	}
+	return file, nil
+}
+
+// verify checks the health of every file, sets the reports in the result document and writes
+// them to w. It returns whether every file is fully recoverable.
+func verify(files []*entangler.EntangledFile, lc config.Lattice, w io.Writer) (bool, error) {
+	sc := swarmconnector.NewSwarmConnectorConfig(cfg.Connection)
+	if err := waitConnectionToPeers(cfg.Connection); err != nil {
+		return false, err
+	}
+
+	recoverable := true
+	reports := make([]*fileHealth, len(files))
+	for i, file := range files {
+		lattice, err := newLattice(sc, file.Lattice(lc), file.Size, file.DataRoot, file.ParityAddrs(), file.Chunker())
+		if err != nil {
+			return false, err
+		}
+		health := lattice.CheckHealth(sc.Getter)
+		reports[i] = &fileHealth{Path: file.Path, DataRoot: file.DataRoot,
+			FullyRecoverable: health.FullyRecoverable(), Health: health}
+		recoverable = recoverable && health.FullyRecoverable()
+	}
+
+	result.Health = reports
+	for _, report := range reports {
+		printHealth(w, report)
+	}
+	return recoverable, nil
+}
+
+// printHealth writes a health report in text form.
+func printHealth(w io.Writer, report *fileHealth) {
+	h := report.Health
+	if report.Path != "" {
+		fmt.Fprintf(w, "File: %v (%v)\n", report.Path, report.DataRoot)
+	} else {
+		fmt.Fprintf(w, "File: %v\n", report.DataRoot)
+	}
+	fmt.Fprintf(w, "  Data blocks: %d/%d available, %d/%d recoverable\n", h.Available, h.DataBlocks, h.Recoverable, h.DataBlocks)
+	for _, strand := range h.Strands {
+		fmt.Fprintf(w, "  %v parities: %d/%d available, %d/%d recoverable, tree nodes %d/%d available\n",
+			strand.Strand, strand.Available, strand.Parities, strand.Recoverable, strand.Parities,
+			strand.TreeNodesAvailable, strand.TreeNodes)
+	}
+	if len(h.Missing) > 0 {
+		fmt.Fprintf(w, "  Missing data blocks: %v\n", h.Missing)
+	}
+	if len(h.AtRisk) > 0 {
+		fmt.Fprintf(w, "  Data blocks at risk: %v\n", h.AtRisk)
+	}
+	if len(h.Unrecoverable) > 0 {
+		fmt.Fprintf(w, "  Unrecoverable data blocks: %v\n", h.Unrecoverable)
+	}
+	fmt.Fprintf(w, "  Recoverability margin: %d\n", h.Margin)
+	if report.FullyRecoverable {
+		fmt.Fprintf(w, "  Status: fully recoverable\n")
+	} else {
+		fmt.Fprintf(w, "  Status: NOT recoverable\n")
+	}
+}
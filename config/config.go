@@ -0,0 +1,164 @@
+// Package config reads the settings of snarl from a file of named profiles, for example one
+// per network or per redundancy level.
+//
+// A configuration file is YAML on the form
+//
+//	default: local
+//	profiles:
+//	  local:
+//	    chunkdbpath: /data/swarm/chunks
+//	    ipcpath: /data/swarm/bzzd.ipc
+//	  durable:
+//	    alpha: 3
+//	    s: 7
+//	    p: 7
+//
+// Settings left out of a profile keep their default values.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix is the prefix of the environment variables that override a profile, as in SNARL_BZZKEY.
+const EnvPrefix = "SNARL_"
+
+// Connection are the settings used to connect to a Swarm node.
+type Connection struct {
+	ChunkDBPath string `yaml:"chunkdbpath"` // Physical location of chunks
+	SnarlDBPath string `yaml:"snarldbpath"` // Physical location of Snarl chunks
+	BzzKey      string `yaml:"bzzkey"`      // Bzzkey of account that uploaded content
+	IPCPath     string `yaml:"ipcpath"`     // Ethereum Inter-process Communications file
+	NumPeers    int    `yaml:"numPeers"`    // Minimum number of peers connected
+}
+
+// Lattice are the parameters of the lattices.
+type Lattice struct {
+	Alpha     int    `yaml:"alpha"`     // Parities per data block
+	S         int    `yaml:"s"`         // Horizontal strands
+	P         int    `yaml:"p"`         // Helical strands
+	Placement string `yaml:"placement"` // Placement policy of the data blocks, see swarmconnector.ParsePlacement
+}
+
+// Config holds the settings of a profile.
+type Config struct {
+	Connection `yaml:",inline"`
+	Lattice    `yaml:",inline"`
+}
+
+// Default returns the settings used when nothing else is given.
+func Default() Config {
+	return Config{
+		Connection: Connection{NumPeers: 9},
+		Lattice:    Lattice{Alpha: 3, S: 5, P: 5},
+	}
+}
+
+// File is a configuration file with named profiles.
+type File struct {
+	DefaultProfile string
+	Profiles       map[string]Config
+}
+
+// DefaultPath returns the location of the configuration file in the user's configuration directory.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "snarl", "config.yaml")
+}
+
+// Load reads the configuration file at path.
+func Load(path string) (*File, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses a configuration file.
+func Parse(data []byte) (*File, error) {
+	var raw struct {
+		Default  string                 `yaml:"default"`
+		Profiles map[string]interface{} `yaml:"profiles"`
+	}
+	if err := yaml.UnmarshalStrict(data, &raw); err != nil {
+		return nil, err
+	}
+	f := &File{DefaultProfile: raw.Default, Profiles: make(map[string]Config)}
+	for name, profile := range raw.Profiles {
+		// Decode every profile on top of the defaults, so left out settings keep them.
+		out, err := yaml.Marshal(profile)
+		if err != nil {
+			return nil, err
+		}
+		c := Default()
+		if err := yaml.UnmarshalStrict(out, &c); err != nil {
+			return nil, fmt.Errorf("profile %q: %v", name, err)
+		}
+		f.Profiles[name] = c
+	}
+	if _, ok := f.Profiles[f.DefaultProfile]; f.DefaultProfile != "" && !ok {
+		return nil, fmt.Errorf("default profile %q does not exist", f.DefaultProfile)
+	}
+	return f, nil
+}
+
+// Profile returns the named profile, or the default profile if name is empty. Without a default
+// profile, the defaults are returned.
+func (f *File) Profile(name string) (Config, error) {
+	if name == "" {
+		name = f.DefaultProfile
+	}
+	if name == "" {
+		return Default(), nil
+	}
+	c, ok := f.Profiles[name]
+	if !ok {
+		return Config{}, fmt.Errorf("profile %q does not exist", name)
+	}
+	return c, nil
+}
+
+// ApplyEnv overrides the settings of c with the environment variables given by lookup, such as
+// SNARL_CHUNKDBPATH or SNARL_ALPHA. The names are those of the settings in upper case.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	texts := map[string]*string{
+		"CHUNKDBPATH": &c.ChunkDBPath,
+		"SNARLDBPATH": &c.SnarlDBPath,
+		"BZZKEY":      &c.BzzKey,
+		"IPCPATH":     &c.IPCPath,
+		"PLACEMENT":   &c.Placement,
+	}
+	for name, v := range texts {
+		if value, ok := lookup(EnvPrefix + name); ok {
+			*v = value
+		}
+	}
+	ints := map[string]*int{
+		"NUMPEERS": &c.NumPeers,
+		"ALPHA":    &c.Alpha,
+		"S":        &c.S,
+		"P":        &c.P,
+	}
+	for name, v := range ints {
+		value, ok := lookup(EnvPrefix + name)
+		if !ok {
+			continue
+		}
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s%s: %v", EnvPrefix, name, err)
+		}
+		*v = i
+	}
+	return nil
+}
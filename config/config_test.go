@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `
+default: local
+profiles:
+  local:
+    chunkdbpath: /data/chunks
+    ipcpath: /data/bzzd.ipc
+  durable:
+    alpha: 3
+    s: 7
+    p: 7
+    numPeers: 20
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	c, err := f.Profile("")
+	assert.NoError(t, err)
+	assert.Equal(t, "/data/chunks", c.ChunkDBPath)
+	assert.Equal(t, "/data/bzzd.ipc", c.IPCPath)
+	assert.Equal(t, Default().Lattice, c.Lattice, "Left out settings should keep the defaults.")
+	assert.Equal(t, 9, c.NumPeers)
+
+	c, err = f.Profile("durable")
+	assert.NoError(t, err)
+	assert.Equal(t, Lattice{Alpha: 3, S: 7, P: 7}, c.Lattice)
+	assert.Equal(t, 20, c.NumPeers)
+	assert.Empty(t, c.ChunkDBPath)
+
+	_, err = f.Profile("missing")
+	assert.Error(t, err)
+
+	_, err = Parse([]byte("default: missing\nprofiles:\n  local:\n    s: 3\n"))
+	assert.Error(t, err, "The default profile must exist.")
+	_, err = Parse([]byte("profiles:\n  local:\n    alpa: 3\n"))
+	assert.Error(t, err, "Unknown settings should be rejected.")
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.Equal(t, "local", f.DefaultProfile)
+	assert.Len(t, f.Profiles, 2)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{"SNARL_BZZKEY": "abc", "SNARL_ALPHA": "2", "SNARL_NUMPEERS": "4"}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	c := Default()
+	assert.NoError(t, c.ApplyEnv(lookup))
+	assert.Equal(t, "abc", c.BzzKey)
+	assert.Equal(t, 2, c.Alpha)
+	assert.Equal(t, 4, c.NumPeers)
+	assert.Equal(t, 5, c.S, "Settings without a variable should be kept.")
+
+	env["SNARL_S"] = "five"
+	assert.Error(t, c.ApplyEnv(lookup))
+}
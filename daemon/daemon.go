@@ -0,0 +1,178 @@
+// Package daemon monitors a registry of entangled files. It samples the availability of their
+// chunks at an interval, and repairs a file when its recoverability margin drops below a threshold.
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/config"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/swarmconnector"
+)
+
+// Config controls how often and how thoroughly the files are checked.
+type Config struct {
+	Interval  time.Duration // Time between checks of every file
+	Intensity float64       // Fraction of the leaves that are probed in each check. Every leaf is probed if not in (0, 1)
+	Threshold int           // A file is repaired when its recoverability margin is below this
+	Seed      int64         // Seed of the sampling
+}
+
+// Daemon checks and repairs the files in a registry.
+type Daemon struct {
+	registry *Registry
+	getter   storage.Getter
+	prober   swarmconnector.Prober
+	store    func([]chunk.Chunk) error
+	config   Config
+	rnd      *rand.Rand
+	lock     sync.Mutex
+}
+
+// New creates a daemon that reads chunks from getter, probes them with prober, and hands
+// repaired chunks to store.
+func New(registry *Registry, getter storage.Getter, prober swarmconnector.Prober,
+	store func([]chunk.Chunk) error, config Config) *Daemon {
+	return &Daemon{
+		registry: registry,
+		getter:   getter,
+		prober:   prober,
+		store:    store,
+		config:   config,
+		rnd:      rand.New(rand.NewSource(config.Seed)),
+	}
+}
+
+// Run checks every file at the configured interval until ctx is done.
+func (d *Daemon) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+	for {
+		if err := d.CheckAll(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll checks every file in the registry once.
+func (d *Daemon) CheckAll(ctx context.Context) error {
+	entries, err := d.registry.List()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := d.Check(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check samples the availability of the file of e, and repairs it if the recoverability margin
+// is below the threshold. A sampled check that finds a low margin is confirmed by probing every
+// chunk before repairing. The result is stored in the registry, where a file that can not be
+// checked or repaired gets the error, so the other files are still checked.
+func (d *Daemon) Check(ctx context.Context, e *Entry) error {
+	err := d.check(ctx, e)
+	e.LastCheck = time.Now()
+	e.LastError = ""
+	if err != nil {
+		e.LastError = err.Error()
+	}
+	return d.registry.Put(e)
+}
+
+// check sets the health of e, and heals its file if needed.
+func (d *Daemon) check(ctx context.Context, e *Entry) error {
+	sample := d.sample()
+	lattice, err := d.newLattice(ctx, e)
+	if err != nil {
+		return err
+	}
+	e.Health = lattice.CheckHealthSample(d.prober, sample)
+	if e.Health.Margin < d.config.Threshold && sample != nil {
+		// Heal needs to know every unavailable block.
+		if lattice, err = d.newLattice(ctx, e); err != nil {
+			return err
+		}
+		e.Health = lattice.CheckHealth(d.prober)
+	}
+	if e.Health.Margin >= d.config.Threshold || e.Health.Complete() {
+		return nil
+	}
+
+	_, healErr := lattice.Heal(e.Health, d.store)
+	if healErr == nil {
+		e.Repairs++
+		e.LastRepair = time.Now()
+	}
+	if lattice, err = d.newLattice(ctx, e); err != nil {
+		return err
+	}
+	e.Health = lattice.CheckHealth(d.prober)
+	return healErr
+}
+
+// ServeHTTP reports the state of the registry as JSON. GET / lists every entry, while
+// GET /<id> returns the entry of the file with the given data root.
+func (d *Daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var value interface{}
+	if id := strings.Trim(r.URL.Path, "/"); id != "" {
+		e, err := d.registry.Get(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		value = e
+	} else {
+		entries, err := d.registry.List()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		value = entries
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(value)
+}
+
+// newLattice creates the lattice of the file of e, with the chunker recorded in its index.
+func (d *Daemon) newLattice(ctx context.Context, e *Entry) (*entangler.Lattice, error) {
+	file := e.File
+	lc := file.Lattice(config.Lattice{Alpha: e.Alpha, S: e.S, P: e.P})
+	return entangler.NewSwarmLatticeConfig(ctx, lc, file.Size, d.getter, file.DataRoot, file.ParityAddrs(), file.Chunker())
+}
+
+// sample returns a function that tells whether to probe a leaf, following the configured intensity.
+func (d *Daemon) sample() func() bool {
+	if d.config.Intensity <= 0 || d.config.Intensity >= 1 {
+		return nil
+	}
+	return func() bool {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		return d.rnd.Float64() < d.config.Intensity
+	}
+}
@@ -0,0 +1,195 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/state"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/simulation"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+// network serves the chunks stored by the daemon on top of a MemoryGetter.
+type network struct {
+	*swarmconnector.MemoryGetter
+	lock   sync.Mutex
+	chunks map[string][]byte
+}
+
+func (n *network) Get(ctx context.Context, ref storage.Reference) (storage.ChunkData, error) {
+	if _, ok := ctx.Value(swarmconnector.Leafchunkid).(int); !ok {
+		n.lock.Lock()
+		data, ok := n.chunks[fmt.Sprintf("%x", []byte(ref))]
+		n.lock.Unlock()
+		if ok {
+			return data, nil
+		}
+	}
+	return n.MemoryGetter.Get(ctx, ref)
+}
+
+func (n *network) Has(ctx context.Context, addr chunk.Address) (bool, error) {
+	n.lock.Lock()
+	_, ok := n.chunks[addr.Hex()]
+	n.lock.Unlock()
+	if ok {
+		return true, nil
+	}
+	return n.MemoryGetter.Has(ctx, addr)
+}
+
+func (n *network) store(chunks []chunk.Chunk) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	for _, c := range chunks {
+		n.chunks[c.Address().Hex()] = c.Data()
+	}
+	return nil
+}
+
+func unavailable(indexes ...int) []swarmconnector.BlockFailure {
+	fails := make([]swarmconnector.BlockFailure, len(indexes))
+	for i, index := range indexes {
+		fails[i] = swarmconnector.BlockFailure{Index: index, Class: swarmconnector.Unavailable}
+	}
+	return fails
+}
+
+// setupDaemon registers a single entangled file with the given failures in a new daemon.
+func setupDaemon(t *testing.T, failedList [][]swarmconnector.BlockFailure) (*Daemon, *network, *Entry) {
+	ts, err := simulation.NewScenario(256*chunk.DefaultSize, 3, 5, 5)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	dataFails, parityFails := simulation.GenerateFailStructures(ts.Roots[0], failedList)
+	net := &network{
+		MemoryGetter: swarmconnector.NewMemoryGetter(ts.Roots[0], ts.Roots[1:], dataFails, parityFails),
+		chunks:       make(map[string][]byte),
+	}
+	net.ParityRootsByAddress = true // The parity trees are probed from their roots
+
+	file := &entangler.EntangledFile{Size: ts.Filesize, DataRoot: ts.Roots[0].Key}
+	for _, root := range ts.Roots[1:] {
+		file.ParityRoots = append(file.ParityRoots, hexutil.Bytes(root.Key))
+	}
+	registry := NewRegistry(state.NewInmemoryStore())
+	entry := &Entry{File: file, Alpha: ts.Alpha, S: ts.S, P: ts.P}
+	if err := registry.Put(entry); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	d := New(registry, net, net, net.store, Config{Intensity: 0.5, Threshold: ts.Alpha + 1, Seed: 1})
+	return d, net, entry
+}
+
+func TestDaemonHealthyFile(t *testing.T) {
+	empty := unavailable()
+	d, net, entry := setupDaemon(t, [][]swarmconnector.BlockFailure{empty, empty, empty, empty})
+	if err := d.CheckAll(context.Background()); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	e, err := d.registry.Get(entry.ID())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.False(t, e.LastCheck.IsZero(), "File was not checked.")
+	assert.Equal(t, 0, e.Repairs, "Healthy file should not be repaired.")
+	assert.Equal(t, 4, e.Health.Margin, "Wrong recoverability margin.")
+	assert.Empty(t, net.chunks, "No chunks should be stored.")
+}
+
+func TestDaemonInvalidPlacement(t *testing.T) {
+	empty := unavailable()
+	d, _, entry := setupDaemon(t, [][]swarmconnector.BlockFailure{empty, empty, empty, empty})
+	entry.File.Placement = "nearest"
+	if err := d.registry.Put(entry); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := d.CheckAll(context.Background()); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	e, err := d.registry.Get(entry.ID())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.False(t, e.LastCheck.IsZero(), "File was not checked.")
+	assert.Contains(t, e.LastError, "nearest", "Invalid placement should be reported.")
+	assert.Equal(t, 0, e.Repairs, "File with an invalid placement should not be repaired.")
+}
+
+func TestDaemonRepairsFile(t *testing.T) {
+	empty := unavailable()
+	d, net, entry := setupDaemon(t, [][]swarmconnector.BlockFailure{unavailable(129), empty, empty, unavailable(5, 130)})
+	for i := 0; i < 2; i++ {
+		if err := d.CheckAll(context.Background()); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	e, err := d.registry.Get(entry.ID())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.Empty(t, e.LastError, "Repair failed.")
+	assert.Equal(t, 1, e.Repairs, "File should be repaired once.")
+	assert.True(t, e.Health.Complete(), "Every chunk should be available after the repair.")
+	assert.NotEmpty(t, net.chunks, "Repaired chunks should be stored.")
+	_, ok := net.chunks[fmt.Sprintf("%x", []byte(entry.File.ParityRoots[0]))]
+	assert.True(t, ok, "Parity tree should be rebuilt.")
+}
+
+func TestDaemonStatusEndpoint(t *testing.T) {
+	empty := unavailable()
+	d, _, entry := setupDaemon(t, [][]swarmconnector.BlockFailure{empty, empty, empty, empty})
+	if err := d.CheckAll(context.Background()); err != nil {
+		t.Fatal(err.Error())
+	}
+	server := httptest.NewServer(d)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var entries []*Entry
+	err = json.NewDecoder(resp.Body).Decode(&entries)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, entry.ID(), entries[0].ID())
+		assert.True(t, entries[0].Health.FullyRecoverable())
+	}
+
+	resp, err = http.Get(server.URL + "/" + entry.ID())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var e Entry
+	err = json.NewDecoder(resp.Body).Decode(&e)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.Equal(t, entry.ID(), e.ID())
+
+	resp, err = http.Get(server.URL + "/00")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,98 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethersphere/swarm/state"
+	"github.com/relab/snarl-mw21/entangler"
+)
+
+const entryPrefix = "file/"
+
+// Entry is an entangled file monitored by the daemon, together with the result of the last check.
+type Entry struct {
+	File       *entangler.EntangledFile `json:"file"`
+	Alpha      int                      `json:"alpha"`
+	S          int                      `json:"s"`
+	P          int                      `json:"p"`
+	LastCheck  time.Time                `json:"lastCheck,omitempty"`
+	Health     *entangler.Health        `json:"health,omitempty"`
+	Repairs    int                      `json:"repairs"`
+	LastRepair time.Time                `json:"lastRepair,omitempty"`
+	LastError  string                   `json:"lastError,omitempty"`
+}
+
+// ID identifies the entry by the data root of the file.
+func (e *Entry) ID() string {
+	return fmt.Sprintf("%x", []byte(e.File.DataRoot))
+}
+
+// Registry keeps the entries of the daemon in a state store, so they survive restarts.
+type Registry struct {
+	store state.Store
+}
+
+// NewRegistry creates a registry backed by store.
+func NewRegistry(store state.Store) *Registry {
+	return &Registry{store: store}
+}
+
+// OpenRegistry opens the registry kept in the database at path.
+func OpenRegistry(path string) (*Registry, error) {
+	store, err := state.NewDBStore(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewRegistry(store), nil
+}
+
+// AddCollection registers every file of the collection.
+func (r *Registry) AddCollection(c *entangler.Collection) error {
+	for _, file := range c.Files {
+		if err := r.Put(&Entry{File: file, Alpha: c.Alpha, S: c.S, P: c.P}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Put adds the entry, or replaces the entry of the same file.
+func (r *Registry) Put(e *Entry) error {
+	return r.store.Put(entryPrefix+e.ID(), e)
+}
+
+// Get returns the entry with the given ID.
+func (r *Registry) Get(id string) (*Entry, error) {
+	e := &Entry{}
+	if err := r.store.Get(entryPrefix+strings.ToLower(id), e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Remove deletes the entry with the given ID.
+func (r *Registry) Remove(id string) error {
+	return r.store.Delete(entryPrefix + strings.ToLower(id))
+}
+
+// List returns every entry in the registry.
+func (r *Registry) List() ([]*Entry, error) {
+	entries := make([]*Entry, 0)
+	err := r.store.Iterate(entryPrefix, func(key, value []byte) (bool, error) {
+		e := &Entry{}
+		if err := json.Unmarshal(value, e); err != nil {
+			return true, err
+		}
+		entries = append(entries, e)
+		return false, nil
+	})
+	return entries, err
+}
+
+// Close closes the underlying store.
+func (r *Registry) Close() error {
+	return r.store.Close()
+}
@@ -133,6 +133,22 @@ func (b *Block) RepairSuccess(data []byte, nolock ...bool) bool {
 	return b.SetData(data, 0, time.Now().UnixNano(), NoDownload, RepairSuccess, nolock...)
 }
 
+// Release drops the data of a block that has data, so that the block is downloaded or repaired
+// again the next time it is needed. Returns true if changed
+func (b *Block) Release(nolock ...bool) bool {
+	if nolock == nil {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+	}
+	if !b.HasData(true) {
+		return false
+	}
+	b.Data = nil
+	b.DownloadStatus = NoDownload
+	b.RepairStatus = NoRepair
+	return true
+}
+
 // SetData sets metadata for the lattice block. Recommended to be called from helper functions Download* and Repair*. Returns true if changed
 func (b *Block) SetData(data []byte, start, end int64, retrieveStatus DownloadStatus, repairStatus RepairStatus, nolock ...bool) bool {
 	if nolock == nil {
@@ -144,13 +160,7 @@ func (b *Block) SetData(data []byte, start, end int64, retrieveStatus DownloadSt
 	}
 
 	if data != nil {
-		b.Data = make([]byte, len(data))
-		copy(b.Data, data)
-
-		if b.Length != 0 {
-			binary.LittleEndian.PutUint64(b.Data, b.Size)
-			b.Data = b.Data[:b.Length]
-		}
+		b.Data = b.blockData(data)
 	}
 	if retrieveStatus != NoDownload {
 		b.DownloadStatus = retrieveStatus
@@ -186,6 +196,17 @@ func (b *Block) SetData(data []byte, start, end int64, retrieveStatus DownloadSt
 	return true
 }
 
+// blockData returns a copy of data as the block keeps it. A block with a length keeps its own span.
+func (b *Block) blockData(data []byte) []byte {
+	out := make([]byte, len(data))
+	copy(out, data)
+	if b.Length != 0 {
+		binary.LittleEndian.PutUint64(out, b.Size)
+		out = out[:b.Length]
+	}
+	return out
+}
+
 type BlockStatus uint8
 
 func Set(ds DownloadStatus, rs RepairStatus) (bs BlockStatus) {
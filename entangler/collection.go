@@ -0,0 +1,93 @@
+package entangler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethersphere/swarm/api"
+	"github.com/relab/snarl-mw21/config"
+	"github.com/relab/snarl-mw21/swarmconnector"
+)
+
+// EntangledFile describes the lattice that protects a single file or manifest.
+type EntangledFile struct {
+	Path        string          `json:"path"`
+	ContentType string          `json:"contentType,omitempty"`
+	Size        uint64          `json:"size"`
+	DataRoot    hexutil.Bytes   `json:"dataRoot"`
+	ParityRoots []hexutil.Bytes `json:"parityRoots"`
+	Pyramid     bool            `json:"pyramid,omitempty"`
+	ChunkSize   int             `json:"chunkSize,omitempty"` // Bytes of data in a full chunk, if not the default
+	Placement   string          `json:"placement,omitempty"` // Placement policy of the data blocks, if not the default
+}
+
+// IsManifest reports whether the entangled file is a manifest of the collection.
+func (f *EntangledFile) IsManifest() bool {
+	return f.ContentType == api.ManifestType
+}
+
+// Chunker returns the options the tree of the file was built with.
+func (f *EntangledFile) Chunker() swarmconnector.ChunkerOptions {
+	return swarmconnector.ChunkerOptions{Encrypted: swarmconnector.IsEncryptedRef(f.DataRoot),
+		Pyramid: f.Pyramid, ChunkSize: f.ChunkSize}
+}
+
+// Lattice returns the lattice parameters of c with the placement policy the file was entangled with.
+func (f *EntangledFile) Lattice(c config.Lattice) config.Lattice {
+	c.Placement = f.Placement
+	return c
+}
+
+// ParityAddrs returns the root addresses of the parity trees, one per strand class.
+func (f *EntangledFile) ParityAddrs() [][]byte {
+	addrs := make([][]byte, len(f.ParityRoots))
+	for i := 0; i < len(f.ParityRoots); i++ {
+		addrs[i] = f.ParityRoots[i]
+	}
+	return addrs
+}
+
+// Collection describes the lattices that protect every file and manifest of a Swarm
+// collection. All lattices share the same parameters. The index of a single file has no manifest.
+type Collection struct {
+	Manifest hexutil.Bytes    `json:"manifest"`
+	Alpha    int              `json:"alpha"`
+	S        int              `json:"s"`
+	P        int              `json:"p"`
+	Files    []*EntangledFile `json:"files"`
+}
+
+// Lattice returns the lattice parameters of the collection.
+func (c *Collection) Lattice() config.Lattice {
+	return config.Lattice{Alpha: c.Alpha, S: c.S, P: c.P}
+}
+
+// ReadCollection reads a collection written by Collection.Write. The placement policies of the
+// files are checked, so the lattices of the files can be created.
+func ReadCollection(path string) (*Collection, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Collection{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	for _, f := range c.Files {
+		if _, err := swarmconnector.ParsePlacement(f.Placement); err != nil {
+			return nil, fmt.Errorf("invalid collection %s: file %q: %v", path, f.Path, err)
+		}
+	}
+	return c, nil
+}
+
+// Write stores the collection as JSON at path.
+func (c *Collection) Write(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
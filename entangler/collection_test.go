@@ -0,0 +1,50 @@
+package entangler_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethersphere/swarm/api"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectionReadWrite(t *testing.T) {
+	collection := &entangler.Collection{
+		Manifest: hexutil.Bytes{1, 2, 3},
+		Alpha:    3, S: 5, P: 5,
+		Files: []*entangler.EntangledFile{
+			{ContentType: api.ManifestType, Size: 300, DataRoot: hexutil.Bytes{1, 2, 3},
+				ParityRoots: []hexutil.Bytes{{4}, {5}, {6}}},
+			{Path: "dir/file.txt", ContentType: "text/plain", Size: 5000, DataRoot: hexutil.Bytes{7, 8},
+				ParityRoots: []hexutil.Bytes{{9}, {10}, {11}}, Pyramid: true},
+		},
+	}
+	path := filepath.Join(t.TempDir(), "collection.json")
+	assert.Nil(t, collection.Write(path))
+
+	read, err := entangler.ReadCollection(path)
+	assert.Nil(t, err)
+	assert.Equal(t, collection, read)
+	assert.True(t, read.Files[0].IsManifest())
+	assert.False(t, read.Files[1].IsManifest())
+	assert.Equal(t, [][]byte{{9}, {10}, {11}}, read.Files[1].ParityAddrs())
+
+	collection.Files[1].Placement = "nearest"
+	assert.Nil(t, collection.Write(path))
+	_, err = entangler.ReadCollection(path)
+	assert.NotNil(t, err, "Unknown placement policy accepted.")
+
+	// The index of a single file has no manifest.
+	file := &entangler.EntangledFile{Path: "file.txt", Size: 5000, DataRoot: hexutil.Bytes{7, 8},
+		ParityRoots: []hexutil.Bytes{{9}, {10}, {11}}, Placement: "spread"}
+	single := &entangler.Collection{Alpha: 3, S: 5, P: 5, Files: []*entangler.EntangledFile{file}}
+	assert.Nil(t, single.Write(path))
+	read, err = entangler.ReadCollection(path)
+	if assert.Nil(t, err) {
+		assert.Empty(t, read.Manifest)
+		assert.Equal(t, []*entangler.EntangledFile{file}, read.Files)
+		assert.Equal(t, "spread", read.Files[0].Lattice(read.Lattice()).Placement)
+	}
+}
@@ -0,0 +1,195 @@
+package entangler
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/utils"
+)
+
+// Strand identifies a strand of the lattice by its class and the lowest position of its parities.
+type Strand struct {
+	Class StrandClass
+	Start int
+}
+
+func (s Strand) String() string {
+	return fmt.Sprintf("%v %d", s.Class, s.Start)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Strand) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// CrossCheckStats are the results of the cross-checks of a lattice.
+type CrossCheckStats struct {
+	Checked     int      `json:"checked"`     // Repaired data blocks compared across their repair pairs
+	Conflicts   int      `json:"conflicts"`   // Checked blocks where the repair pairs disagreed
+	Corrected   int      `json:"corrected"`   // Repaired blocks whose data was replaced by that of the other pairs
+	Rejected    int      `json:"rejected"`    // Downloaded data chunks that did not match their address
+	Quarantined []Strand `json:"quarantined"` // Strands that served wrong parities, in the order they were found
+}
+
+// CrossCheckStats returns the results of the cross-checks so far.
+func (l *Lattice) CrossCheckStats() CrossCheckStats {
+	l.checkLock.Lock()
+	defer l.checkLock.Unlock()
+	stats := l.checkStats
+	stats.Quarantined = append([]Strand(nil), l.checkStats.Quarantined...)
+	return stats
+}
+
+// verifyChunk reports whether data is the chunk at addr. Only unencrypted chunks can be verified,
+// and the others are assumed to be right.
+func (l *Lattice) verifyChunk(addr, data []byte) bool {
+	if !l.CrossCheck || l.Chunker.Encrypted || len(addr) == 0 {
+		return true
+	}
+	hash, err := utils.GetAddrOfRawData(data, storage.MakeHashFunc(storage.DefaultHash)())
+	if err != nil || !bytes.Equal(hash, addr) {
+		l.checkLock.Lock()
+		l.checkStats.Rejected++
+		l.checkLock.Unlock()
+		return false
+	}
+	return true
+}
+
+// crossCheck compares the repaired data block b with the results of all its other repair pairs.
+// If they disagree, b gets the data that matches its address, or else the data of the majority of
+// the pairs. The strands of the parities of the pairs that gave other data are quarantined, and
+// not used for any repair for the rest of the session.
+func (l *Lattice) crossCheck(b *Block) {
+	if !l.CrossCheck || b.IsParity {
+		return
+	}
+
+	type candidate struct {
+		data []byte
+		pair *RepairPair
+	}
+	var candidates []candidate
+	for _, pair := range b.GetRepairPairs() {
+		if !l.usable(pair) {
+			continue
+		}
+		blockChan := make(chan *Block, 2)
+		go l.downloadBlock(pair.Left, blockChan)
+		go l.downloadBlock(pair.Right, blockChan)
+		<-blockChan
+		<-blockChan
+		if pair.Left.HasData() && pair.Right.HasData() {
+			candidates = append(candidates, candidate{b.blockData(XORByteSlice(pair.Left.Data, pair.Right.Data)), pair})
+		}
+	}
+	if len(candidates) < 2 {
+		return
+	}
+
+	l.checkLock.Lock()
+	l.checkStats.Checked++
+	l.checkLock.Unlock()
+
+	votes := make(map[string]int)
+	for _, c := range candidates {
+		votes[string(c.data)]++
+	}
+	if len(votes) == 1 {
+		return
+	}
+	var truth []byte
+	for _, c := range candidates {
+		if l.verifyRepair(b, c.data) {
+			truth = c.data
+			break
+		} else if votes[string(c.data)] > len(candidates)/2 {
+			truth = c.data
+		}
+	}
+	l.checkLock.Lock()
+	l.checkStats.Conflicts++
+	l.checkLock.Unlock()
+	if truth == nil {
+		return
+	}
+
+	b.lock.Lock()
+	corrected := !bytes.Equal(b.Data, truth)
+	if corrected {
+		b.Data = truth
+	}
+	b.lock.Unlock()
+
+	l.checkLock.Lock()
+	defer l.checkLock.Unlock()
+	if corrected {
+		l.checkStats.Corrected++
+	}
+	for _, c := range candidates {
+		if bytes.Equal(c.data, truth) {
+			continue
+		}
+		for _, p := range []*Block{c.pair.Left, c.pair.Right} {
+			if !p.IsParity {
+				continue
+			}
+			strand := l.strand(p)
+			if l.quarantine == nil {
+				l.quarantine = make(map[Strand]bool)
+			}
+			if !l.quarantine[strand] {
+				l.quarantine[strand] = true
+				l.checkStats.Quarantined = append(l.checkStats.Quarantined, strand)
+				DebugPrint("crossCheck. %v disagrees on %v, quarantining strand %v.\n", p, b, strand)
+			}
+		}
+	}
+}
+
+// verifyRepair reports whether data is the chunk of the data block b as given by its address. It
+// is false if the address is not known, or if the chunk can not be verified.
+func (l *Lattice) verifyRepair(b *Block, data []byte) bool {
+	if l.Chunker.Encrypted || len(b.Identifier) == 0 {
+		return false
+	}
+	hash, err := utils.GetAddrOfRawData(data, storage.MakeHashFunc(storage.DefaultHash)())
+	return err == nil && bytes.Equal(hash, b.Identifier)
+}
+
+// usable reports whether neither parity of the repair pair is in a quarantined strand.
+func (l *Lattice) usable(pair *RepairPair) bool {
+	return !l.quarantined(pair.Left) && !l.quarantined(pair.Right)
+}
+
+// quarantined reports whether b is a parity of a quarantined strand.
+func (l *Lattice) quarantined(b *Block) bool {
+	if !l.CrossCheck || !b.IsParity {
+		return false
+	}
+	l.checkLock.Lock()
+	defer l.checkLock.Unlock()
+	return len(l.quarantine) > 0 && l.quarantine[l.strand(b)]
+}
+
+// strand returns the strand of the parity p. It must be called with checkLock held.
+func (l *Lattice) strand(p *Block) Strand {
+	if s, ok := l.strands[p]; ok {
+		return s
+	}
+	if l.strands == nil {
+		l.strands = make(map[*Block]Strand)
+	}
+	// Strands are closed, so following the parities to the right leads back to p.
+	s := Strand{Class: p.Class, Start: p.Position}
+	members := []*Block{p}
+	for q := p.Right[0].Right[p.Class]; q != p && len(members) <= len(l.Blocks); q = q.Right[0].Right[q.Class] {
+		members = append(members, q)
+		s.Start = utils.Min(s.Start, q.Position)
+	}
+	for _, q := range members {
+		l.strands[q] = s
+	}
+	return s
+}
@@ -0,0 +1,55 @@
+package entangler_test
+
+import (
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/simulation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrossCheck(t *testing.T) {
+	size := uint64(256 * chunk.DefaultSize)
+	ts := newTestSetup(size, 3, 5, 5)
+	original := fileData(ts.Roots[0])
+	const failedLeaf = 20
+
+	download := func(failures [][]simulation.Failure, crossCheck bool) ([]byte, entangler.CrossCheckStats) {
+		lattice, getter := memoryLattice(ts, failures)
+		lattice.CrossCheck = crossCheck
+		return fileData(buildTree(t, ts, lattice, getter)), lattice.CrossCheckStats()
+	}
+
+	// The horizontal strand is the first to be used to repair the failed leaf, and the source of
+	// the parity to the right of the leaf serves wrong data.
+	lattice, _ := memoryLattice(ts, ts.NoFailures())
+	bad := lattice.GetBlock(failedLeaf).Right[Horizontal]
+	failures := ts.NoFailures()
+	failures[ts.Alpha] = simulation.UnavailableList(failedLeaf)
+	failures[Horizontal] = ts.Canon(simulation.Byzantine(0), bad.Position)
+
+	data, _ := download(failures, false)
+	assert.NotEqual(t, original, data, "The wrong parity should give a wrong repair.")
+
+	data, stats := download(failures, true)
+	assert.Equal(t, original, data)
+	assert.Equal(t, 1, stats.Conflicts)
+	assert.Equal(t, 1, stats.Corrected)
+	if assert.Len(t, stats.Quarantined, 1) {
+		assert.Equal(t, Horizontal, stats.Quarantined[0].Class)
+	}
+
+	// A wrong data chunk does not match its address, and is repaired instead.
+	failures = ts.NoFailures()
+	failures[ts.Alpha] = []simulation.Failure{simulation.Byzantine(failedLeaf)}
+
+	data, _ = download(failures, false)
+	assert.NotEqual(t, original, data)
+
+	data, stats = download(failures, true)
+	assert.Equal(t, original, data)
+	assert.Equal(t, 1, stats.Rejected)
+	assert.Zero(t, stats.Conflicts)
+	assert.Empty(t, stats.Quarantined)
+}
@@ -0,0 +1,104 @@
+package entangler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// DotWindow selects the data blocks of a lattice drawn by WriteDot, by position. The whole lattice
+// is drawn if Last is 0.
+type DotWindow struct {
+	First, Last int
+}
+
+// strandColors are the colours of the parities of each strand class in WriteDot.
+var strandColors = [...]string{Horizontal: "black", Right: "red", Left: "blue"}
+
+// WriteDot writes the data blocks in window and the parities between them as a Graphviz graph, to
+// be drawn with neato. The data blocks are arranged in S rows, and the parities are edges from the
+// data block to their left to the one to their right, coloured by strand class. Blocks that were
+// downloaded are drawn solid, repaired ones dashed and missing ones dotted and red. Replaced
+// parities are drawn bold, and data blocks shifted to place internal tree nodes have two borders.
+// Parities to blocks outside the window end in a point.
+func (l *Lattice) WriteDot(w io.Writer, window DotWindow) error {
+	first, last := 1, l.NumDataBlocks
+	if window.Last > 0 {
+		first, last = window.First, window.Last
+	}
+	inWindow := func(b *Block) bool {
+		return b != nil && !b.IsParity && b.Position >= first && b.Position <= last
+	}
+	shifted := make(map[int]bool)
+	for _, position := range l.internalNodeShift {
+		shifted[position] = true
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "digraph lattice {\n")
+	fmt.Fprintf(out, "\tgraph [layout=neato, splines=true, label=\"alpha=%d s=%d p=%d\"];\n", l.Alpha, l.S, l.P)
+	fmt.Fprintf(out, "\tnode [shape=circle, fixedsize=true, width=0.5, fontsize=10, style=filled];\n")
+	fmt.Fprintf(out, "\tedge [arrowsize=0.5];\n")
+
+	for _, b := range l.Blocks {
+		if !inWindow(b) {
+			continue
+		}
+		style, color, fill := blockStyle(b)
+		attrs := fmt.Sprintf("pos=\"%d,%d!\", style=\"filled,%s\", color=%s, fillcolor=%s",
+			(b.Position-1)/l.S, -(b.Position-1)%l.S, style, color, fill)
+		if len(b.Children) > 0 {
+			attrs += ", shape=box"
+		}
+		if shifted[b.Position] {
+			attrs += ", peripheries=2"
+		}
+		fmt.Fprintf(out, "\td%d [%s, tooltip=%q];\n", b.Position, attrs, b.String())
+	}
+
+	for _, b := range l.Blocks {
+		if !b.IsParity || len(b.Left) == 0 || len(b.Right) == 0 {
+			continue
+		}
+		left, right := b.Left[0], b.Right[0]
+		if !inWindow(left) && !inWindow(right) {
+			continue
+		}
+		from, to := fmt.Sprintf("d%d", left.Position), fmt.Sprintf("d%d", right.Position)
+		stub := fmt.Sprintf("p%d_%d", b.Class, b.Position)
+		if !inWindow(left) {
+			from = stub
+		} else if !inWindow(right) {
+			to = stub
+		}
+		if from == stub || to == stub {
+			fmt.Fprintf(out, "\t%s [shape=point, width=0.05, label=\"\"];\n", stub)
+		}
+
+		style, color, _ := blockStyle(b)
+		if color == "black" {
+			color = strandColors[b.Class]
+		}
+		if b.Replace {
+			style += ",bold"
+		}
+		fmt.Fprintf(out, "\t%s -> %s [style=\"%s\", color=%s, tooltip=%q];\n", from, to, style, color, b.String())
+	}
+	fmt.Fprintf(out, "}\n")
+	return out.Flush()
+}
+
+// blockStyle returns the line style, line colour and fill colour of b by its status.
+func blockStyle(b *Block) (style, color, fill string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	switch {
+	case b.HasData(true) && b.DownloadStatus == DownloadSuccess:
+		return "solid", "black", "palegreen"
+	case b.HasData(true):
+		return "dashed", "black", "lightblue"
+	case b.DownloadStatus == DownloadFailed || b.RepairStatus == RepairFailed:
+		return "dotted", "red", "salmon"
+	}
+	return "dotted", "black", "white"
+}
@@ -0,0 +1,45 @@
+package entangler_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDot(t *testing.T) {
+	const alpha, s, p, n = 3, 5, 5, 50
+	l := entangler.NewMemoryLattice(alpha, s, p, n)
+	data := make([]byte, 4104)
+	l.Blocks[0].DownloadSuccess(data)
+	l.Blocks[1].DownloadFailed()
+
+	var buf bytes.Buffer
+	if err := l.WriteDot(&buf, entangler.DotWindow{}); err != nil {
+		t.Fatal(err.Error())
+	}
+	dot := buf.String()
+	assert.True(t, strings.HasPrefix(dot, "digraph lattice {"))
+	assert.Equal(t, alpha*n, strings.Count(dot, " -> "), "Every parity should be an edge.")
+	assert.Contains(t, dot, "d1 [pos=\"0,0!\", style=\"filled,solid\"")
+	assert.Contains(t, dot, "d2 [pos=\"0,-1!\", style=\"filled,dotted\", color=red")
+	assert.Contains(t, dot, "d50 [pos=\"9,-4!\"")
+
+	// Only the parities of the window are drawn, and those that leave it end in a point.
+	buf.Reset()
+	if err := l.WriteDot(&buf, entangler.DotWindow{First: 11, Last: 20}); err != nil {
+		t.Fatal(err.Error())
+	}
+	dot = buf.String()
+	assert.NotContains(t, dot, "d1 [")
+	assert.Contains(t, dot, "d11 [")
+	assert.NotContains(t, dot, "d21 [")
+	for _, line := range strings.Split(dot, "\n") {
+		if strings.Contains(line, " -> ") {
+			assert.Regexp(t, `^\t(d1\d|d20|p\d_\d+) -> (d1\d|d20|p\d_\d+) `, line)
+		}
+	}
+	assert.Contains(t, dot, "shape=point")
+}
@@ -160,6 +160,68 @@ func (e *Entangler) WrapLattice(result chan<- *EntangledBlock) {
 	}
 }
 
+// Update sends the change of every parity that depends on the data block at index, when the block
+// changes by delta, the XOR of its old and new content. The parities are XOR chains, so a parity
+// changes by delta if the block is upstream of it on its strand, including the parities that WrapLattice
+// sent. The Data of the blocks sent is the delta to XOR into the parity, not the parity itself.
+// NumDataBlocks must be the number of data blocks in the lattice, and only the first Alpha classes are sent.
+func (e *Entangler) Update(delta []byte, index int, result chan<- *EntangledBlock) {
+	// Create the list of blocks that were wrapped.
+	if len(e.RightExtremeIndex) == 0 {
+		e.setDatablocksToClose()
+	}
+	wrapped := make(map[int]bool, len(e.RightExtremeIndex))
+	for _, i := range e.RightExtremeIndex {
+		wrapped[i] = true
+	}
+
+	for class := StrandClass(0); int(class) < e.Alpha && class <= Left; class++ {
+		parities := make([]*EntangledBlock, 0)
+		last := index
+		for {
+			right := strandNeighbour(class, GetForwardNeighbours, last, e.S, e.P)
+			if right > e.NumDataBlocks {
+				break
+			}
+			parities = append(parities, &EntangledBlock{Data: delta, LeftIndex: last, RightIndex: right, Class: class})
+			last = right
+		}
+
+		if wrapped[last] {
+			first := strandNeighbour(class, GetWrapPosition, last, e.S, e.P)
+			if first == index && len(parities) > 0 {
+				// The parity out of the first data block was replaced by one that holds every block
+				// of the strand but the first, so it does not change.
+				parities = parities[1:]
+			}
+			// The parity that links the end of the strand to its first block holds the whole strand.
+			parities = append(parities, &EntangledBlock{Data: delta, LeftIndex: last, RightIndex: first, Class: class})
+			if first != index {
+				second := strandNeighbour(class, GetForwardNeighbours, first, e.S, e.P)
+				parities = append(parities, &EntangledBlock{Data: delta, LeftIndex: first, RightIndex: second,
+					Class: class, Replace: true})
+			}
+		}
+
+		for _, parity := range parities {
+			result <- parity
+		}
+	}
+}
+
+// strandNeighbour returns the neighbour of the given class that neighbours finds for the data block at index.
+func strandNeighbour(class StrandClass, neighbours func(index, S, P int) (r, h, l int), index, S, P int) int {
+	r, h, l := neighbours(index, S, P)
+	switch class {
+	case Right:
+		return r
+	case Left:
+		return l
+	default:
+		return h
+	}
+}
+
 func (e *Entangler) GetReplacedParityIndices() map[int]struct{} {
 	replacedIndices := make(map[int]struct{})
 
@@ -857,11 +857,14 @@ func TestSwarmEntanglerWithLattice(t *testing.T) {
 		entangledTrees[i] = et
 	}
 
-	lattice := NewSwarmLattice(context.Background(), alpha, s, p, uint64(inputSize), getter,
+	lattice, err := NewSwarmLattice(context.Background(), alpha, s, p, uint64(inputSize), getter,
 		treeRoot.Key, [][]byte{
 			entangledTrees[0].Key, entangledTrees[1].Key,
 			entangledTrees[2].Key,
 		}, chunk.DefaultSize)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
 
 	for i := 0; i < lattice.NumDataBlocks; i = i + 1 {
 		b := lattice.Blocks[i]
@@ -0,0 +1,127 @@
+package entangler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/relab/snarl-mw21/utils"
+)
+
+// Heal repairs every block that Probe found unavailable, and hands the reconstructed chunks to store
+// so they can be uploaded again. health is the result of CheckHealth. Data chunks are stored first,
+// then parities, and last the parity trees that have unavailable internal nodes, so an interrupted
+// heal leaves fewer blocks to repair the next time. It returns the number of chunks stored.
+func (l *Lattice) Heal(health *Health, store func([]chunk.Chunk) error) (int, error) {
+	tree, err := swarmconnector.BuildCompleteTree(l.ctx, l.Getter, l.DataRootID,
+		l.Chunker.TreeOptions(), l)
+	if err != nil {
+		return 0, err
+	}
+	stored := 0
+	chunks := l.RepairedDataChunks(tree)
+	if err := store(chunks); err != nil {
+		return stored, err
+	}
+	stored += len(chunks)
+
+	l.RepairAll()
+	if chunks, err = l.RepairedParityChunks(); err != nil {
+		return stored, err
+	}
+	if err := store(chunks); err != nil {
+		return stored, err
+	}
+	stored += len(chunks)
+
+	for k, strand := range health.Strands {
+		if strand.TreeNodesAvailable == strand.TreeNodes && strand.TreeNodes > 0 {
+			continue
+		}
+		if chunks, err = l.ParityTree(k); err != nil {
+			return stored, err
+		}
+		if err := store(chunks); err != nil {
+			return stored, err
+		}
+		stored += len(chunks)
+	}
+	return stored, nil
+}
+
+// RepairedDataChunks returns the chunks of the data blocks that Probe found unavailable, as they
+// are stored in Swarm. tree is the data tree built with the lattice as repairer.
+func (l *Lattice) RepairedDataChunks(tree *swarmconnector.TreeChunk) []chunk.Chunk {
+	chunks := make([]chunk.Chunk, 0)
+	tree.FilterChunks(func(tc *swarmconnector.TreeChunk) bool {
+		if l.GetBlock(tc.Index).IsUnavailable && len(tc.Data) > 0 {
+			addr := utils.RemoveDecryptionKeyFromChunkHash(tc.Key, chunk.AddressLength)
+			chunks = append(chunks, chunk.NewChunk(addr, tc.StoredData()))
+		}
+		return false
+	})
+	return chunks
+}
+
+// RepairedParityChunks returns the chunks of the parities that Probe found unavailable and that
+// have since been repaired.
+func (l *Lattice) RepairedParityChunks() ([]chunk.Chunk, error) {
+	hasher := storage.MakeHashFunc(storage.DefaultHash)()
+	chunks := make([]chunk.Chunk, 0)
+	for _, b := range l.Blocks[l.NumDataBlocks:] {
+		if !b.IsUnavailable || !b.HasData() {
+			continue
+		}
+		data := parityChunkData(b)
+		addr, err := utils.GetAddrOfRawData(data, hasher)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk.NewChunk(addr, data))
+	}
+	return chunks, nil
+}
+
+// ParityTree rebuilds every chunk of the parity tree of the given class from the parities in the
+// lattice, which must all have data. The internal nodes of a parity tree are not part of the lattice,
+// so this is the only way to recover them.
+func (l *Lattice) ParityTree(class int) ([]chunk.Chunk, error) {
+	leaves := make([][]byte, l.NumDataBlocks)
+	var size uint64
+	for i := 0; i < l.NumDataBlocks; i++ {
+		b := l.parityBlock(i+1, class)
+		if !b.HasData() {
+			return nil, fmt.Errorf("parity %v of strand %v is missing", b.Position, StrandClass(class))
+		}
+		leaves[i] = parityChunkData(b)
+		size += uint64(len(leaves[i]) - swarmconnector.ChunkSizeOffset)
+	}
+
+	// Parities are uploaded with either chunker. The root address tells which one was used.
+	for _, chunker := range []swarmconnector.ChunkerOptions{{Pyramid: true}, {}} {
+		shape, err := swarmconnector.GenerateTreeMetadata(size, chunker)
+		if err != nil {
+			return nil, err
+		}
+		chunks, err := swarmconnector.BuildTreeChunks(shape, leaves)
+		if err != nil {
+			continue
+		}
+		if bytes.Equal(chunks[len(chunks)-1].Address(), l.ParityRootID[class]) {
+			return chunks, nil
+		}
+	}
+	return nil, fmt.Errorf("rebuilt parity tree of strand %v does not match root %x", StrandClass(class), l.ParityRootID[class])
+}
+
+// parityChunkData returns the parity as it is stored in Swarm. The span of a repaired parity is
+// the result of the XOR, so it is set from the length of the parity.
+func parityChunkData(b *Block) []byte {
+	data := make([]byte, len(b.Data))
+	copy(data, b.Data)
+	binary.LittleEndian.PutUint64(data, uint64(len(data)-swarmconnector.ChunkSizeOffset))
+	return data
+}
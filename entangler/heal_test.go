@@ -0,0 +1,79 @@
+package entangler_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/relab/snarl-mw21/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeal(t *testing.T) {
+	ts := newTestSetup(256*chunk.DefaultSize, 3, 5, 5)
+
+	// Every chunk of the data and parity trees, as stored in Swarm.
+	original := make(map[string][]byte)
+	for _, root := range ts.Roots {
+		root.FilterChunks(func(tc *swarmconnector.TreeChunk) bool {
+			addr := utils.RemoveDecryptionKeyFromChunkHash(tc.Key, chunk.AddressLength)
+			original[fmt.Sprintf("%x", addr)] = tc.StoredData()
+			return false
+		})
+	}
+
+	failedList := [][]bf{[]bf{uf(129)}, ts.Canon(uf(0), 3, 70), empty, []bf{uf(5), uf(130)}}
+	lattice, getter := healthLattice(ts, failedList)
+	health := lattice.CheckHealth(getter)
+	assert.False(t, health.Complete(), "Blocks are missing.")
+
+	stored := make(map[string][]byte)
+	n, err := lattice.Heal(health, func(chunks []chunk.Chunk) error {
+		for _, c := range chunks {
+			stored[c.Address().Hex()] = c.Data()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.GreaterOrEqual(t, n, len(stored), "Wrong number of stored chunks.")
+
+	for addr, data := range stored {
+		orig, ok := original[addr]
+		if assert.True(t, ok, "Stored chunk %v is not part of the trees.", addr) {
+			assert.True(t, bytes.Equal(orig, data), "Stored chunk %v does not match the original.", addr)
+		}
+	}
+
+	// The missing data chunks, the parities of the missing parity tree node, and the parity tree itself.
+	expected := [][]byte{ts.Roots[1].Key}
+	ts.Roots[0].FilterChunks(func(tc *swarmconnector.TreeChunk) bool {
+		if tc.Index == 5 || tc.Index == 130 {
+			expected = append(expected, tc.Key)
+		}
+		return false
+	})
+	for _, leaf := range []int{1, 128} {
+		ts.Roots[1].FilterChunks(func(tc *swarmconnector.TreeChunk) bool {
+			if tc.Index == ts.LeafToCanonMap[leaf] {
+				expected = append(expected, tc.Key)
+			}
+			return false
+		})
+	}
+	for _, leaf := range []int{3, 70} {
+		ts.Roots[2].FilterChunks(func(tc *swarmconnector.TreeChunk) bool {
+			if tc.Index == ts.LeafToCanonMap[leaf] {
+				expected = append(expected, tc.Key)
+			}
+			return false
+		})
+	}
+	for _, key := range expected {
+		_, ok := stored[fmt.Sprintf("%x", key)]
+		assert.True(t, ok, "Chunk %x was not stored.", key)
+	}
+}
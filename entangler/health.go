@@ -0,0 +1,222 @@
+package entangler
+
+import "github.com/relab/snarl-mw21/swarmconnector"
+
+// StrandHealth is the availability of the parities of one strand class.
+type StrandHealth struct {
+	Strand             string `json:"strand"`
+	Parities           int    `json:"parities"`
+	Available          int    `json:"available"`
+	Recoverable        int    `json:"recoverable"`
+	TreeNodes          int    `json:"treeNodes"`          // Internal nodes of the parity tree
+	TreeNodesAvailable int    `json:"treeNodesAvailable"` // Internal nodes of the parity tree that are available
+}
+
+// Health is the result of a recoverability analysis of a lattice.
+type Health struct {
+	DataBlocks    int             `json:"dataBlocks"`
+	Available     int             `json:"available"`
+	Recoverable   int             `json:"recoverable"`
+	Strands       []*StrandHealth `json:"strands"`
+	Missing       []int           `json:"missing"`       // Canonical indexes of unavailable data blocks
+	Unrecoverable []int           `json:"unrecoverable"` // Canonical indexes of data blocks that can not be repaired
+	AtRisk        []int           `json:"atRisk"`        // Canonical indexes of available data blocks without an available repair pair
+	Margin        int             `json:"margin"`        // Least number of ways any data block can be retrieved directly
+}
+
+// FullyRecoverable reports whether every data block is either available or can be repaired.
+func (h *Health) FullyRecoverable() bool {
+	return len(h.Unrecoverable) == 0
+}
+
+// Complete reports whether every block of the lattice and every internal node of the parity trees is available.
+func (h *Health) Complete() bool {
+	for _, strand := range h.Strands {
+		if strand.Available < strand.Parities || strand.TreeNodesAvailable < strand.TreeNodes {
+			return false
+		}
+	}
+	return len(h.Missing) == 0
+}
+
+// CheckHealth probes the availability of the lattice and analyses whether the file can be recovered.
+func (l *Lattice) CheckHealth(prober swarmconnector.Prober) *Health {
+	return l.CheckHealthSample(prober, nil)
+}
+
+// CheckHealthSample is the same as CheckHealth, but only probes a sample of the leaves, see ProbeSample.
+func (l *Lattice) CheckHealthSample(prober swarmconnector.Prober, sample func() bool) *Health {
+	trees := l.ProbeSample(prober, sample)
+	h := l.AnalyseHealth()
+	for k := 0; k < len(h.Strands); k++ {
+		h.Strands[k].TreeNodes = trees[k].TreeNodes
+		h.Strands[k].TreeNodesAvailable = trees[k].TreeNodesAvailable
+	}
+	return h
+}
+
+// Probe checks the availability of every block of the lattice without downloading the leaves,
+// and sets IsUnavailable on the blocks that can not be retrieved. Blocks below an unavailable
+// internal node of the data or parity trees can not be probed, and are also marked as unavailable.
+// The availability of the internal nodes of the parity trees is returned per strand class.
+func (l *Lattice) Probe(prober swarmconnector.Prober) []*StrandHealth {
+	return l.ProbeSample(prober, nil)
+}
+
+// ProbeSample is the same as Probe, but a leaf is only probed if sample returns true. The leaves
+// that are left out are assumed to be available. Internal nodes are always retrieved.
+func (l *Lattice) ProbeSample(prober swarmconnector.Prober, sample func() bool) []*StrandHealth {
+	var sampleLeaf func(int) bool
+	if sample != nil {
+		sampleLeaf = func(int) bool { return sample() }
+	}
+	available := func(status swarmconnector.ChunkStatus) bool {
+		return status == swarmconnector.ChunkAvailable || status == swarmconnector.ChunkSkipped
+	}
+
+	status := swarmconnector.ProbeTreeSample(l.ctx, l.Getter, prober, l.DataRootID, l.metadata, sampleLeaf)
+	for i := 0; i < len(status); i++ {
+		l.GetBlock(i + 1).IsUnavailable = !available(status[i])
+	}
+
+	trees := make([]*StrandHealth, l.Alpha)
+	for k := 0; k < l.Alpha; k++ {
+		trees[k] = &StrandHealth{Strand: StrandClass(k).String()}
+		for i := 0; i < l.NumDataBlocks; i++ {
+			l.parityBlock(i+1, k).IsUnavailable = true
+		}
+		if k >= len(l.ParityRootID) {
+			continue
+		}
+		shape, err := l.parityShape(k)
+		if err != nil {
+			DebugPrint("Probe. Could not read parity tree %v: %v\n", StrandClass(k), err)
+			continue
+		}
+
+		status := swarmconnector.ProbeTreeSample(l.ctx, l.Getter, prober, l.ParityRootID[k], shape, sampleLeaf)
+		leaf := 0
+		for i := 0; i < len(shape); i++ {
+			if len(shape[i].Children) > 0 {
+				trees[k].TreeNodes++
+				if available(status[i]) {
+					trees[k].TreeNodesAvailable++
+				}
+				continue
+			}
+			if leaf++; leaf <= l.NumDataBlocks {
+				l.parityBlock(leaf, k).IsUnavailable = !available(status[i])
+			}
+		}
+	}
+	return trees
+}
+
+// AnalyseHealth applies the repair rules of the lattice to the availability of the blocks, as given
+// by IsUnavailable, to find which blocks can be recovered. No data is retrieved.
+func (l *Lattice) AnalyseHealth() *Health {
+	recoverable := make(map[*Block]bool, len(l.Blocks))
+	for _, b := range l.Blocks {
+		recoverable[b] = !b.IsUnavailable
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, b := range l.Blocks {
+			if !recoverable[b] && l.canRepair(b, recoverable) {
+				recoverable[b] = true
+				changed = true
+			}
+		}
+	}
+
+	h := &Health{DataBlocks: l.NumDataBlocks, Strands: make([]*StrandHealth, l.Alpha), Margin: -1}
+	for k := 0; k < l.Alpha; k++ {
+		h.Strands[k] = &StrandHealth{Strand: StrandClass(k).String(), Parities: l.NumDataBlocks}
+		for i := 0; i < l.NumDataBlocks; i++ {
+			b := l.parityBlock(i+1, k)
+			if !b.IsUnavailable {
+				h.Strands[k].Available++
+			}
+			if recoverable[b] {
+				h.Strands[k].Recoverable++
+			}
+		}
+	}
+
+	for index := 1; index <= l.NumDataBlocks; index++ {
+		b := l.GetBlock(index)
+		if !b.IsUnavailable {
+			h.Available++
+		} else {
+			h.Missing = append(h.Missing, index)
+		}
+		if recoverable[b] {
+			h.Recoverable++
+		} else {
+			h.Unrecoverable = append(h.Unrecoverable, index)
+		}
+
+		// The block can be retrieved directly from itself or from a repair pair where both blocks are available.
+		intact := 0
+		for _, pair := range b.GetRepairPairs() {
+			if !pair.Left.IsUnavailable && !pair.Right.IsUnavailable {
+				intact++
+			}
+		}
+		if intact == 0 && !b.IsUnavailable {
+			h.AtRisk = append(h.AtRisk, index)
+		}
+		if !b.IsUnavailable {
+			intact++
+		}
+		if h.Margin < 0 || intact < h.Margin {
+			h.Margin = intact
+		}
+	}
+	if h.Margin < 0 {
+		h.Margin = 0
+	}
+	return h
+}
+
+// canRepair reports whether b can be repaired from blocks that are recoverable.
+func (l *Lattice) canRepair(b *Block, recoverable map[*Block]bool) bool {
+	if b.IsParity && b.Replace {
+		// A replaced parity is the XOR of the data blocks along its strand.
+		right := b.Right[0]
+		for steps := 0; steps <= l.NumDataBlocks; steps++ {
+			if right.Position == b.Position {
+				return true
+			} else if !recoverable[right] {
+				break
+			}
+			right = right.Right[b.Class].Right[0]
+		}
+	}
+	for _, pair := range b.GetRepairPairs() {
+		if recoverable[pair.Left] && recoverable[pair.Right] {
+			return true
+		}
+	}
+	return false
+}
+
+// parityBlock returns the parity of the given strand class whose left data block is at position.
+func (l *Lattice) parityBlock(position, class int) *Block {
+	return l.Blocks[l.NumDataBlocks+(position-1)*l.Alpha+class]
+}
+
+// parityShape reads the root of a parity tree to find the shape of the tree.
+func (l *Lattice) parityShape(class int) ([]swarmconnector.ChunkMetadata, error) {
+	root := l.ParityRootID[class]
+	chunker, err := swarmconnector.DetectChunker(l.ctx, l.Getter, root)
+	if err != nil {
+		return nil, err
+	}
+	data, err := swarmconnector.GetPlainChunk(l.ctx, l.Getter, root)
+	if err != nil {
+		return nil, err
+	}
+	return swarmconnector.GenerateTreeMetadata(swarmconnector.RawChunkSize(data), chunker)
+}
@@ -0,0 +1,103 @@
+package entangler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/simulation"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryLattice sets up a lattice for ts that reads from memory, with the failures in failedList,
+// and panics if that fails.
+func memoryLattice(ts *simulation.Scenario, failedList [][]bf) (*entangler.Lattice, *swarmconnector.MemoryGetter) {
+	dataTree, parityTrees := ts.Roots[0], ts.Roots[1:]
+	dataFails, parityFails := simulation.GenerateFailStructures(dataTree, failedList)
+	getter := swarmconnector.NewMemoryGetter(dataTree, parityTrees, dataFails, parityFails)
+	parityRoots := make([][]byte, len(parityTrees))
+	for i := 0; i < len(parityTrees); i++ {
+		parityRoots[i] = parityTrees[i].Key
+	}
+	lattice, err := entangler.NewSwarmLatticeChunker(context.Background(), ts.Alpha, ts.S, ts.P, ts.Filesize, getter,
+		dataTree.Key, parityRoots, chunk.DefaultSize, swarmconnector.ChunkerOptions{Encrypted: ts.Encrypted, Pyramid: ts.Pyramid})
+	if err != nil {
+		panic(err)
+	}
+	return lattice, getter
+}
+
+// healthLattice is the same as memoryLattice, but the parity trees can also be probed from their roots.
+func healthLattice(ts *simulation.Scenario, failedList [][]bf) (*entangler.Lattice, *swarmconnector.MemoryGetter) {
+	lattice, getter := memoryLattice(ts, failedList)
+	getter.ParityRootsByAddress = true
+	return lattice, getter
+}
+
+// buildTree downloads the data tree of ts from getter, and repairs it with the lattice.
+func buildTree(t *testing.T, ts *simulation.Scenario, lattice *entangler.Lattice, getter storage.Getter) *swarmconnector.TreeChunk {
+	tree, err := swarmconnector.BuildCompleteTree(context.Background(), getter, ts.Roots[0].Key,
+		swarmconnector.BuildTreeOptions{Pyramid: ts.Pyramid}, lattice)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return tree
+}
+
+func TestCheckHealth(t *testing.T) {
+	ts := newTestSetup(256*chunk.DefaultSize, 3, 5, 5)
+	parityNode := 129 // First internal node of a parity tree
+	unavailParities := ts.ParityTreeNodes[parityNode]
+
+	tests := []struct {
+		desc          string
+		failedList    [][]bf
+		missing       []int
+		unrecoverable []int
+		parities      []int // Available parities per strand class
+		margin        int
+	}{
+		{"NoFailure", [][]bf{empty, empty, empty, empty}, nil, nil,
+			[]int{ts.DataRootIndex, ts.DataRootIndex, ts.DataRootIndex}, ts.Alpha + 1},
+		{"SingleDataFailure", [][]bf{empty, empty, empty, []bf{uf(5)}}, []int{5}, nil,
+			[]int{ts.DataRootIndex, ts.DataRootIndex, ts.DataRootIndex}, ts.Alpha},
+		{"ParityTreeNodeFailure", [][]bf{[]bf{uf(parityNode)}, empty, empty, empty}, nil, nil,
+			[]int{ts.DataRootIndex - unavailParities, ts.DataRootIndex, ts.DataRootIndex}, ts.Alpha},
+		{"AllRootsFailure", [][]bf{[]bf{uf(ts.ParityRootIndex)}, []bf{uf(ts.ParityRootIndex)},
+			[]bf{uf(ts.ParityRootIndex)}, []bf{uf(ts.DataRootIndex)}}, makeRange(1, ts.DataRootIndex+1, 1),
+			makeRange(1, ts.DataRootIndex+1, 1), []int{0, 0, 0}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			lattice, getter := healthLattice(ts, test.failedList)
+			health := lattice.CheckHealth(getter)
+
+			assert.Equal(t, ts.DataRootIndex, health.DataBlocks, "Wrong number of data blocks.")
+			assert.Equal(t, test.missing, health.Missing, "Wrong missing data blocks.")
+			assert.Equal(t, ts.DataRootIndex-len(test.missing), health.Available, "Wrong number of available data blocks.")
+			assert.Equal(t, test.unrecoverable, health.Unrecoverable, "Wrong unrecoverable data blocks.")
+			assert.Equal(t, len(test.unrecoverable) == 0, health.FullyRecoverable())
+			for k := 0; k < ts.Alpha; k++ {
+				assert.Equal(t, test.parities[k], health.Strands[k].Available, "Wrong available parities. Strand: %v", k)
+			}
+			assert.Empty(t, health.AtRisk, "No data block should be at risk.")
+			assert.Equal(t, test.margin, health.Margin, "Wrong recoverability margin.")
+		})
+	}
+}
+
+func TestCheckHealthParityTreeNodes(t *testing.T) {
+	ts := newTestSetup(256*chunk.DefaultSize, 3, 5, 5)
+
+	lattice, getter := healthLattice(ts, [][]bf{[]bf{uf(129)}, empty, empty, empty})
+	health := lattice.CheckHealth(getter)
+	numNodes := len(ts.ParityTreeNodes)
+	assert.Equal(t, numNodes, health.Strands[Horizontal].TreeNodes, "Wrong number of parity tree nodes.")
+	assert.Equal(t, numNodes-1, health.Strands[Horizontal].TreeNodesAvailable, "Wrong number of available parity tree nodes.")
+	assert.Equal(t, numNodes, health.Strands[Right].TreeNodesAvailable, "Wrong number of available parity tree nodes.")
+	assert.Equal(t, ts.DataRootIndex, health.Strands[Horizontal].Recoverable, "Every parity should be recoverable.")
+}
@@ -2,10 +2,12 @@ package entangler
 
 import (
 	"context"
-	"log"
+	"errors"
 	"sync"
 
+	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/config"
 	"github.com/relab/snarl-mw21/swarmconnector"
 )
 
@@ -20,14 +22,27 @@ type Lattice struct {
 	DataRootID        []byte
 	ParityRootID      [][]byte
 	didInit           bool
-	maxDatablockSize  int
+	maxDatablockSize  int // Data of a full chunk of the tree
 	Size              uint64
 	lock              sync.Mutex
 	dlLock            sync.Mutex
 	DownloadEvent     []chan int
 	pendingDLs        int
 	RecoverError      error
+	Chunker           swarmconnector.ChunkerOptions
 	internalNodeShift map[int]int // Shifts from TreeChunk Index to Lattice Position
+	placement         swarmconnector.PlacementPolicy
+	metadata          []swarmconnector.ChunkMetadata
+	releasedRepairs   int // Repaired data blocks whose data a reader has released
+
+	// CrossCheck makes the lattice verify downloaded data chunks against their addresses, and
+	// compare every repaired data block with the results of its other repair pairs. Strands that
+	// give wrong parities are quarantined, see crossCheck.
+	CrossCheck bool
+	checkLock  sync.Mutex
+	checkStats CrossCheckStats
+	quarantine map[Strand]bool
+	strands    map[*Block]Strand
 }
 
 func NewLattice(ctx context.Context, alpha, s, p int, numDataBlocks int) *Lattice {
@@ -43,12 +58,27 @@ func NewLattice(ctx context.Context, alpha, s, p int, numDataBlocks int) *Lattic
 		Blocks:            blocks,
 		ctx:               ctx,
 		Size:              uint64(numDataBlocks),
-		maxDatablockSize:  1 << 20,
+		maxDatablockSize:  chunk.DefaultSize,
 	}
 }
 
 func NewSwarmLattice(ctx context.Context, alpha, s, p int, size uint64, getter storage.Getter,
-	datarootid []byte, parityrootids [][]byte, maxDataSize int) *Lattice {
+	datarootid []byte, parityrootids [][]byte, maxDataSize int) (*Lattice, error) {
+	return NewSwarmLatticeChunker(ctx, alpha, s, p, size, getter, datarootid, parityrootids, maxDataSize,
+		swarmconnector.ChunkerOptions{Encrypted: swarmconnector.IsEncryptedRef(datarootid)})
+}
+
+// NewSwarmLatticeChunker is the same as NewSwarmLattice for a file chunked with the given options.
+func NewSwarmLatticeChunker(ctx context.Context, alpha, s, p int, size uint64, getter storage.Getter,
+	datarootid []byte, parityrootids [][]byte, maxDataSize int, chunker swarmconnector.ChunkerOptions) (*Lattice, error) {
+	return newSwarmLattice(ctx, alpha, s, p, size, getter, datarootid, parityrootids, maxDataSize, chunker,
+		swarmconnector.WindowPlacement{})
+}
+
+// newSwarmLattice is the same as NewSwarmLatticeChunker with the chunks placed by placement.
+func newSwarmLattice(ctx context.Context, alpha, s, p int, size uint64, getter storage.Getter, datarootid []byte,
+	parityrootids [][]byte, maxDataSize int, chunker swarmconnector.ChunkerOptions,
+	placement swarmconnector.PlacementPolicy) (*Lattice, error) {
 	l := &Lattice{
 		Entangler: Entangler{
 			Alpha: alpha,
@@ -61,12 +91,35 @@ func NewSwarmLattice(ctx context.Context, alpha, s, p int, size uint64, getter s
 		ParityRootID:     parityrootids,
 		maxDatablockSize: maxDataSize,
 		Size:             size,
+		Chunker:          chunker,
+		placement:        placement,
 	}
 
 	// We initialize the lattice
-	l.RunInit()
+	if err := l.RunInit(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
 
-	return l
+// NewSwarmLatticeConfig is the same as NewSwarmLatticeChunker with the lattice parameters and the
+// placement policy of c, and data blocks of the chunk size of chunker.
+func NewSwarmLatticeConfig(ctx context.Context, c config.Lattice, size uint64, getter storage.Getter,
+	datarootid []byte, parityrootids [][]byte, chunker swarmconnector.ChunkerOptions) (*Lattice, error) {
+	placement, err := swarmconnector.ParsePlacement(c.Placement)
+	if err != nil {
+		return nil, err
+	}
+	return newSwarmLattice(ctx, c.Alpha, c.S, c.P, size, getter, datarootid, parityrootids,
+		chunker.PayloadSize(), chunker, placement)
+}
+
+// Placement returns the placement policy of the data blocks of the lattice.
+func (l *Lattice) Placement() swarmconnector.PlacementPolicy {
+	if l.placement == nil {
+		return swarmconnector.WindowPlacement{}
+	}
+	return l.placement
 }
 
 // GetBlock retrieves the correct block in the lattice given the blocks canonical index
@@ -187,25 +240,57 @@ func (l *Lattice) ResetMendingStatus(nolock ...bool) {
 }
 
 // RunInit creates the entire Lattice structure in memory for the given size and configuration.
-func (l *Lattice) RunInit() {
+func (l *Lattice) RunInit() error {
 	l.lock.Lock()
 	defer l.lock.Unlock()
 	if l.didInit {
-		return
+		return nil
 	}
 
-	sizeList, err := swarmconnector.GenerateChunkMetadata(l.Size)
+	sizeList, err := swarmconnector.GenerateTreeMetadata(l.Size, l.Chunker)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	l.metadata = sizeList
 	if l.NumDataBlocks == 0 {
 		l.NumDataBlocks = len(sizeList)
 	}
 
-	l.MissingDataBlocks = l.NumDataBlocks
-	l.Blocks = make([]*Block, 0, l.NumDataBlocks*l.Alpha)
+	l.createDataBlocks()
+	l.createInternalNodeShift(sizeList)
+	if err := l.createParities(); err != nil {
+		return err
+	}
+	l.didInit = true
+	return nil
+}
 
-	// Create datablocks
+// NewMemoryLattice returns the lattice of numDataBlocks data blocks that are not part of a Swarm
+// tree. The blocks have no data, and there is nothing to retrieve them from.
+func NewMemoryLattice(alpha, s, p, numDataBlocks int) *Lattice {
+	l := NewLattice(context.Background(), alpha, s, p, numDataBlocks)
+	l.Getter = noGetter{}
+	l.ParityRootID = make([][]byte, alpha)
+	l.createDataBlocks()
+	l.internalNodeShift = make(map[int]int)
+	if err := l.createParities(); err != nil {
+		panic(err) // The lattice of any number of blocks can be connected
+	}
+	l.didInit = true
+	return l
+}
+
+// noGetter is the getter of a lattice that has nothing to retrieve.
+type noGetter struct{}
+
+func (noGetter) Get(context.Context, storage.Reference) (storage.ChunkData, error) {
+	return nil, chunk.ErrChunkNotFound
+}
+
+// createDataBlocks creates the data blocks of the lattice.
+func (l *Lattice) createDataBlocks() {
+	l.MissingDataBlocks = l.NumDataBlocks
+	l.Blocks = make([]*Block, 0, l.NumDataBlocks*(l.Alpha+1))
 	for i := 0; i < l.NumDataBlocks; i++ {
 		b := &Block{
 			EntangledBlock: EntangledBlock{},
@@ -215,10 +300,10 @@ func (l *Lattice) RunInit() {
 		}
 		l.Blocks = append(l.Blocks, b)
 	}
+}
 
-	l.createInternalNodeShift(sizeList)
-
-	// Create parities
+// createParities creates the parities of the lattice and connects them to the data blocks.
+func (l *Lattice) createParities() error {
 	replacedIndices := l.GetReplacedParityIndices()
 
 	// Setup temporary storage for connecting blocks
@@ -259,7 +344,7 @@ func (l *Lattice) RunInit() {
 			}
 
 			if nxt--; nxt >= len(l.Blocks) || nxt < 0 {
-				log.Fatal("Error in lattice construction.")
+				return errors.New("error in lattice construction")
 			}
 
 			rightData := l.Blocks[nxt]
@@ -270,14 +355,12 @@ func (l *Lattice) RunInit() {
 			l.Blocks = append(l.Blocks, b)
 		}
 	}
-	l.didInit = true
+	return nil
 }
 
 func (l *Lattice) createInternalNodeShift(sizeList []swarmconnector.ChunkMetadata) {
 	// Add links to parents and children.
 	l.internalNodeShift = make(map[int]int)
-	internalNodes := make(map[int]swarmconnector.ChunkMetadata)
-	internalNodesOrder := make([]int, 0)
 	for i := 0; i < len(sizeList); i++ {
 		b, s := l.Blocks[i], sizeList[i]
 		lsc := len(s.Children)
@@ -289,37 +372,19 @@ func (l *Lattice) createInternalNodeShift(sizeList []swarmconnector.ChunkMetadat
 			for j := 0; j < lsc; j++ {
 				b.Children[j] = l.Blocks[s.Children[j]-1]
 			}
-			if s.Parent != 0 { // We do not shift the root
-				internalNodes[i] = s
-				internalNodesOrder = append(internalNodesOrder, i)
-			}
 		}
 		b.Size = s.Size
 		b.Length = s.Length
 	}
 
-	windowSize := l.S * l.P
-
-	for i := 0; i < len(internalNodesOrder); i++ {
-		canInd := internalNodesOrder[i]
-		im := internalNodes[canInd]
-		lowestChild := im.Children[0]
-		highestChild := im.Children[len(im.Children)-1]
-		for j := windowSize; j < l.NumDataBlocks; j += windowSize + l.S {
-			inWindow := j+1 > lowestChild-windowSize && j+1 < highestChild+windowSize
-			if !inWindow && len(sizeList[j].Children) == 0 {
-				// Check if we already added this shift.
-				if _, ok := l.internalNodeShift[canInd+1]; ok {
-					continue
-				}
-				if _, ok := l.internalNodeShift[j+1]; ok {
-					continue
-				}
-				l.internalNodeShift[canInd+1] = j + 1
-				l.internalNodeShift[j+1] = canInd + 1
-				l.translateBlocks(canInd, j)
-				break
-			}
+	// Placement policies only swap chunks in pairs, so the shifts go both ways.
+	for i, position := range l.Placement().Place(sizeList, l.S, l.P) {
+		if position == i+1 {
+			continue
+		}
+		l.internalNodeShift[i+1] = position
+		if i+1 < position {
+			l.translateBlocks(i, position-1)
 		}
 	}
 }
@@ -9,6 +9,7 @@ import (
 
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/config"
 	"github.com/relab/snarl-mw21/repair"
 	"github.com/relab/snarl-mw21/swarmconnector"
 	"github.com/relab/snarl-mw21/utils"
@@ -28,10 +29,11 @@ func TestGetNeighbours(t *testing.T) {
 		{257, true, []int{251, 256, 257, 255, 254, 258, 259, 1, 2, 3, 4, 5}},
 		{257, false, []int{1, 4, 251, 252, 253, 254, 255, 256, 257, 258, 259, 5}},
 	}
-	ts := NewTestSetup(256*chunk.DefaultSize, 3, 5, 5)
 	for i, test := range tests {
-		lattice := NewSwarmLattice(context.TODO(), ts.Alpha, ts.S, ts.P, ts.Filesize, nil, nil, nil, chunk.DefaultSize)
-		lattice.RunInit()
+		lattice, err := NewSwarmLattice(context.TODO(), 3, 5, 5, 256*chunk.DefaultSize, nil, nil, nil, chunk.DefaultSize)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
 
 		block := lattice.Blocks[test.index-1]
 		neighbours := lattice.GetNeighbours(block, test.direction)
@@ -100,14 +102,17 @@ func TestLatticeRunInit(t *testing.T) {
 	// Test NewLattice
 	for i, test := range tests {
 		var lattice *Lattice
+		var err error
 		if test.swarmlattice {
-			lattice = NewSwarmLattice(context.TODO(), test.alpha, test.s, test.p, test.size, nil, nil, nil, chunk.DefaultSize)
+			lattice, err = NewSwarmLattice(context.TODO(), test.alpha, test.s, test.p, test.size, nil, nil, nil, chunk.DefaultSize)
 			swarmHierNum++
 		} else {
 			lattice = NewLattice(context.TODO(), test.alpha, test.s, test.p, test.numblocks)
+			err = lattice.RunInit()
+		}
+		if err != nil {
+			t.Fatal(err.Error())
 		}
-
-		lattice.RunInit()
 
 		assert.Equal(t, test.numblocks*(test.alpha+1), len(lattice.Blocks), "Number of blocks in lattice did not match. Test %v, Swarmlattice: %v", i, test.swarmlattice)
 		assert.Equal(t, test.numblocks, lattice.NumDataBlocks, "Number of DATA blocks in lattice did not match. Test %v, Swarmlattice: %v", i, test.swarmlattice)
@@ -205,9 +210,10 @@ func TestCreateInternalNodeShift(t *testing.T) {
 
 		S, P := 5, 5
 		flatTree := treeRoot.FlattenTreeWindow(S, P)
-		ts := NewTestSetup(uint64(test.length), 3, 5, 5)
-		lattice := NewSwarmLattice(context.TODO(), ts.Alpha, ts.S, ts.P, ts.Filesize, nil, nil, nil, chunk.DefaultSize)
-		lattice.RunInit()
+		lattice, err := NewSwarmLattice(context.TODO(), 3, S, P, uint64(test.length), nil, nil, nil, chunk.DefaultSize)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
 
 		for j := 0; j < len(flatTree); j++ {
 			b := lattice.GetBlock(flatTree[j].Index)
@@ -215,3 +221,46 @@ func TestCreateInternalNodeShift(t *testing.T) {
 		}
 	}
 }
+
+func TestPlacementPolicyShift(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swarm-storage-")
+	defer os.RemoveAll(dir)
+	if err != nil {
+		t.Fatalf("Could not create temp directory. Error: %v", err.Error())
+	}
+
+	length := chunk.DefaultSize*128*3 + 1337 // One root, 4 IM1, 385 children.
+	addr, reader, getter, err := utils.GenerateRandomData(length, storage.DefaultHash, dir)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	treeRoot, err := swarmconnector.BuildCompleteTree(reader.Context(), getter, storage.Reference(addr),
+		swarmconnector.BuildTreeOptions{EmptyLeaves: true}, repair.NewMockRepair(getter))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, name := range []string{"window", "spread", "subtree", "random:11"} {
+		c := config.Lattice{Alpha: 3, S: 5, P: 5, Placement: name}
+		policy, err := swarmconnector.ParsePlacement(name)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		flatTree := treeRoot.FlattenTreePlacement(policy, c.S, c.P)
+		lattice, err := NewSwarmLatticeConfig(context.TODO(), c, uint64(length), nil, nil, nil, swarmconnector.ChunkerOptions{})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		assert.Equal(t, name, lattice.Placement().String())
+		for j := 0; j < len(flatTree); j++ {
+			b := lattice.GetBlock(flatTree[j].Index)
+			assert.Equal(t, j+1, b.Position, "%v: chunk %d", name, flatTree[j].Index)
+		}
+		assert.Equal(t, name, lattice.Snapshot(false).Placement)
+	}
+
+	c := config.Lattice{Alpha: 3, S: 5, P: 5, Placement: "nearest"}
+	_, err = NewSwarmLatticeConfig(context.TODO(), c, uint64(length), nil, nil, nil, swarmconnector.ChunkerOptions{})
+	assert.NotNil(t, err, "Unknown placement policy accepted.")
+}
@@ -0,0 +1,100 @@
+package entangler_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/simulation"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+// fileData returns the content of the file below root.
+func fileData(root *swarmconnector.TreeChunk) []byte {
+	var data []byte
+	var walker func(*swarmconnector.TreeChunk)
+	walker = func(c *swarmconnector.TreeChunk) {
+		if c.SubtreeSize <= uint64(len(c.Data)) {
+			data = append(data, c.Data[swarmconnector.ChunkSizeOffset:]...)
+		}
+		for j := range c.Children {
+			walker(c.Children[j])
+		}
+	}
+	walker(root)
+	return data
+}
+
+func TestReadRange(t *testing.T) {
+	scenarios := map[string]func(uint64, int, int, int) (*simulation.Scenario, error){
+		"Tree":      simulation.NewScenario,
+		"Encrypted": simulation.NewEncryptedScenario,
+		"Pyramid":   simulation.NewPyramidScenario,
+	}
+	size := uint64(256 * chunk.DefaultSize)
+	failedLeaf := uint64(3) // Canonical index of the third leaf
+
+	ranges := []struct {
+		name          string
+		start, end    uint64
+		repairedBlock bool
+	}{
+		{"FirstChunk", 0, chunk.DefaultSize, false},
+		{"FailedChunk", 2*chunk.DefaultSize + 10, 2*chunk.DefaultSize + 20, true},
+		{"AcrossSubtrees", 120 * chunk.DefaultSize, 140*chunk.DefaultSize + 7, false},
+		{"LastBytes", size - 100, size, false},
+		{"PastEnd", size - 100, size + 100, false},
+		{"Empty", 50, 50, false},
+	}
+
+	for name, newScenario := range scenarios {
+		ts, err := newScenario(size, 3, 5, 5)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		original := fileData(ts.Roots[0])
+		failures := ts.NoFailures()
+		failures[ts.Alpha] = simulation.UnavailableList(int(failedLeaf))
+
+		for _, r := range ranges {
+			t.Run(name+"/"+r.name, func(t *testing.T) {
+				lattice, getter := memoryLattice(ts, failures)
+
+				var buf bytes.Buffer
+				n, err := swarmconnector.ReadRange(context.Background(), getter, ts.Roots[0].Key,
+					swarmconnector.BuildTreeOptions{Pyramid: ts.Pyramid}, lattice, r.start, r.end, &buf)
+				if err != nil {
+					t.Fatal(err.Error())
+				}
+				end := r.end
+				if end > size {
+					end = size
+				}
+				assert.Equal(t, int64(end-r.start), n)
+				assert.True(t, bytes.Equal(original[r.start:end], buf.Bytes()), "The range does not match the original.")
+
+				repaired := 0
+				for _, b := range lattice.Blocks {
+					if !b.IsParity && b.RepairStatus == entangler.RepairSuccess {
+						repaired++
+					}
+				}
+				if r.repairedBlock {
+					assert.Equal(t, 1, repaired, "Only the failed block in the range should be repaired.")
+				} else {
+					assert.Zero(t, repaired, "Blocks outside of the range should not be repaired.")
+				}
+			})
+		}
+	}
+
+	ts := newTestSetup(size, 3, 5, 5)
+	lattice, getter := healthLattice(ts, ts.NoFailures())
+	_, err := swarmconnector.ReadRange(context.Background(), getter, ts.Roots[0].Key,
+		swarmconnector.BuildTreeOptions{}, lattice, size+1, size+2, &bytes.Buffer{})
+	assert.True(t, errors.Is(err, swarmconnector.ErrInvalidRange), "A range past the end should be invalid.")
+}
@@ -0,0 +1,102 @@
+package entangler
+
+import (
+	"sync"
+
+	"github.com/relab/snarl-mw21/swarmconnector"
+)
+
+// NewReader opens the data file of the lattice as an io.ReadSeeker and io.ReaderAt. Chunks are
+// retrieved when they are read, and chunks that are not available are repaired through the lattice.
+// The reader keeps at most cacheSize decoded chunks, and the lattice only keeps the data of the
+// chunks in the cache of the reader.
+func (l *Lattice) NewReader(cacheSize int) (*swarmconnector.LazyReader, error) {
+	r := &latticeReader{Lattice: l, resident: make(map[*Block]bool)}
+	return swarmconnector.NewLazyReader(l.ctx, l.Getter, l.DataRootID,
+		l.Chunker.TreeOptions(), r, cacheSize)
+}
+
+// latticeReader is the repairer of a reader of the lattice. It releases the data of the blocks
+// that the reader no longer uses, and of the blocks that were only needed to repair a chunk.
+type latticeReader struct {
+	*Lattice
+	lock     sync.Mutex
+	resident map[*Block]bool // Blocks of the chunks that the reader uses
+}
+
+func (r *latticeReader) GetChunk(addr []byte, index int) ([]byte, error) {
+	data, err := r.Lattice.GetChunk(addr, index)
+	if err == nil {
+		r.keep(index)
+	}
+	return data, err
+}
+
+func (r *latticeReader) RepairChunk(index int) ([]byte, error) {
+	data, err := r.Lattice.RepairChunk(index)
+	if err == nil {
+		r.keep(index)
+	}
+	r.releaseUnused()
+	return data, err
+}
+
+// Release implements repair.Releaser.
+func (r *latticeReader) Release(index int) {
+	b := r.GetBlock(index)
+	r.lock.Lock()
+	delete(r.resident, b)
+	r.lock.Unlock()
+
+	// Wait for any repair to finish, since it may use the data of the block.
+	r.Lattice.lock.Lock()
+	defer r.Lattice.lock.Unlock()
+	r.release(b)
+}
+
+func (r *latticeReader) keep(index int) {
+	r.lock.Lock()
+	r.resident[r.GetBlock(index)] = true
+	r.lock.Unlock()
+}
+
+// releaseUnused releases the data of every block but those the reader uses.
+func (r *latticeReader) releaseUnused() {
+	r.Lattice.lock.Lock()
+	defer r.Lattice.lock.Unlock()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, b := range r.Blocks {
+		if !r.resident[b] {
+			r.release(b)
+		}
+	}
+}
+
+// release releases the data of b, and counts it if it was a repaired data block.
+// The lattice must be locked.
+func (r *latticeReader) release(b *Block) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	repaired := !b.IsParity && b.RepairStatus == RepairSuccess
+	if b.Release(true) && repaired {
+		r.releasedRepairs++
+	}
+}
+
+// RepairedDataBlocks returns the number of data blocks that have been repaired, including the
+// blocks whose data a reader of the lattice has released since.
+func (l *Lattice) RepairedDataBlocks() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	repaired := l.releasedRepairs
+	for i := 0; i < l.NumDataBlocks; i++ {
+		b := l.Blocks[i]
+		b.lock.Lock()
+		if b.RepairStatus == RepairSuccess {
+			repaired++
+		}
+		b.lock.Unlock()
+	}
+	return repaired
+}
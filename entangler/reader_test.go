@@ -0,0 +1,104 @@
+package entangler_test
+
+import (
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/relab/snarl-mw21/simulation"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLazyReader(t *testing.T) {
+	size := uint64(200 * chunk.DefaultSize)
+	ts := newTestSetup(size, 3, 5, 5)
+	original := fileData(ts.Roots[0])
+	failures := ts.NoFailures()
+	failures[ts.Alpha] = simulation.UnavailableList(3, 150)
+	lattice, _ := healthLattice(ts, failures)
+
+	r, err := lattice.NewReader(swarmconnector.DefaultReaderCacheSize)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.Equal(t, int64(size), r.Size())
+
+	all, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.Equal(t, original, all, "Reading the whole file should give the original.")
+
+	pos, err := r.Seek(-100, io.SeekEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(size-100), pos)
+	buf := make([]byte, 200)
+	n, err := r.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, original[size-100:], buf[:n])
+	_, err = r.Read(buf)
+	assert.Equal(t, io.EOF, err)
+
+	var wg sync.WaitGroup
+	for _, off := range []int64{0, 2*chunk.DefaultSize - 5, 130 * chunk.DefaultSize, int64(size) - 10} {
+		wg.Add(1)
+		go func(off int64) {
+			defer wg.Done()
+			buf := make([]byte, chunk.DefaultSize)
+			n, err := r.ReadAt(buf, off)
+			end := off + int64(len(buf))
+			if end > int64(size) {
+				end = int64(size)
+				assert.Equal(t, io.EOF, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, original[off:end], buf[:n])
+		}(off)
+	}
+	wg.Wait()
+
+	_, err = r.ReadAt(buf, int64(size))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestLazyReaderReleasesChunks(t *testing.T) {
+	size := uint64(200 * chunk.DefaultSize)
+	ts := newTestSetup(size, 3, 5, 5)
+	original := fileData(ts.Roots[0])
+	failures := ts.NoFailures()
+	failures[ts.Alpha] = simulation.UnavailableList(3, 70, 71)
+	lattice, _ := healthLattice(ts, failures)
+
+	cacheSize := 8
+	r, err := lattice.NewReader(cacheSize)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var all []byte
+	buf := make([]byte, chunk.DefaultSize/2)
+	for {
+		n, err := r.Read(buf)
+		all = append(all, buf[:n]...)
+		held := 0
+		for _, b := range lattice.Blocks {
+			if b.HasData() {
+				held++
+			}
+		}
+		// The reader keeps the root chunk besides the cached chunks.
+		if held > cacheSize+1 {
+			t.Fatalf("Lattice keeps the data of %d blocks after reading %d bytes.", held, len(all))
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	assert.Equal(t, original, all, "Reading the whole file should give the original.")
+	assert.Equal(t, 3, lattice.RepairedDataBlocks(), "Released blocks should still be counted as repaired.")
+}
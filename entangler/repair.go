@@ -128,11 +128,15 @@ func (l *Lattice) repairDataRepAdjacent(b *Block) ([]byte, error) {
 			return b.Data, nil
 		}
 		repPair := pairs[i]
+		if !l.usable(repPair) {
+			continue
+		}
 
 		l.repairParity(repPair.Right, true)
 		l.repairParity(repPair.Left, false)
 
 		if b.Repair(repPair.Left, repPair.Right) == nil {
+			l.crossCheck(b)
 			return b.Data, nil
 		}
 	}
@@ -152,12 +156,16 @@ func (l *Lattice) repairDataDLAdjacent(block *Block) bool {
 	repPairs := block.GetRepairPairs()
 	for i := 0; i < len(repPairs); i++ {
 		repPair := repPairs[i]
+		if !l.usable(repPair) {
+			continue
+		}
 		blockChan := make(chan *Block, 2)
 		defer close(blockChan)
 		go l.downloadBlock(repPair.Left, blockChan)
 		go l.downloadBlock(repPair.Right, blockChan)
 
 		if block.Repair(<-blockChan, <-blockChan) == nil {
+			l.crossCheck(block)
 			return true
 		}
 	}
@@ -181,7 +189,7 @@ func (l *Lattice) downloadBlock(block *Block, resultChan chan<- *Block) {
 
 func (l *Lattice) replacedParityRepair(b *Block) bool {
 	right := b.Right[0]
-	rightDat := make([]byte, chunk.DefaultSize)
+	rightDat := make([]byte, l.maxDatablockSize)
 	for {
 		if right.Position == b.Position {
 			return b.RepairSuccess(rightDat)
@@ -207,7 +215,7 @@ func (l *Lattice) repairParity(block *Block, goRight bool) {
 			_, _ = l.repairDataRepAdjacent(block)
 		}
 		return
-	} else if !block.ParityShouldRepair() {
+	} else if !block.ParityShouldRepair() || l.quarantined(block) {
 		return
 	}
 
@@ -291,10 +299,15 @@ func (l *Lattice) GetChunk(addr []byte, index int) ([]byte, error) {
 	b.DownloadPending()
 	b.Identifier = addr
 	data, err := l.Getter.Get(l.ctx, addr)
+	if err == nil && !l.verifyChunk(addr, data) {
+		err = fmt.Errorf("chunk %x does not match its address", addr)
+	}
 	if err != nil {
 		b.DownloadFailed()
 	} else {
 		b.DownloadSuccess(data)
+		// The block has the span of the plaintext, which is needed for encrypted chunks.
+		data = b.Data
 	}
 	l.pendingDLchange(-1)
 	return data, err
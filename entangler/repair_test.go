@@ -1,9 +1,10 @@
-package entangler
+package entangler_test
 
 import (
 	"fmt"
 	"testing"
 
+	"github.com/relab/snarl-mw21/simulation"
 	"github.com/relab/snarl-mw21/utils"
 	"github.com/stretchr/testify/assert"
 )
@@ -13,7 +14,7 @@ func TestRepair(t *testing.T) {
 	utils.Enable_LogPrint()
 
 	// *****  START: Positive tests (Should pass.)  ****** //
-	testSetups := make([]*testsetup, 0)
+	testSetups := make([]*simulation.Scenario, 0)
 	t.Run("RootDataFailure", func(t *testing.T) {
 		r_RootDataFailure(&testSetups)
 	})
@@ -109,15 +110,21 @@ func TestRepair(t *testing.T) {
 	t.Run("RepairPendingInfiniteLoop", func(t *testing.T) {
 		r_RepairPendingInfiniteLoop(&testSetups)
 	})
+	t.Run("EncryptedDataFailure", func(t *testing.T) {
+		r_EncryptedDataFailure(&testSetups)
+	})
+	t.Run("PyramidDataFailure", func(t *testing.T) {
+		r_PyramidDataFailure(&testSetups)
+	})
 
-	testFailures := RunTests(testSetups)
 	var haveFailures bool = false
 	for i := 0; i < len(testSetups); i++ {
-		if testFailures[i] != "" && !testSetups[i].ShouldFail {
+		result := simulation.Run(testSetups[i])
+		if result.Error != "" && !testSetups[i].ShouldFail {
 			haveFailures = true
 			fmt.Printf("---------------------------------------------\nError in test: %v\n%v\n---------------------------------------------\n",
-				testSetups[i].Description, testFailures[i])
-		} else if testFailures[i] == "" && testSetups[i].ShouldFail {
+				testSetups[i].Description, result.Error)
+		} else if result.Error == "" && testSetups[i].ShouldFail {
 			haveFailures = true
 			fmt.Printf("---------------------------------------------\nError in test: %v\n%v\n---------------------------------------------\n",
 				testSetups[i].Description, "Expected the test to fail!")
@@ -0,0 +1,180 @@
+package entangler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/swarmconnector"
+)
+
+// Snapshot is the state of a lattice that can be written as JSON: the parameters needed to build
+// it again, and the statuses of its blocks. The data of the blocks is only included if asked for.
+type Snapshot struct {
+	Alpha         int                           `json:"alpha"`
+	S             int                           `json:"s"`
+	P             int                           `json:"p"`
+	Size          uint64                        `json:"size"`
+	NumDataBlocks int                           `json:"numDataBlocks"`
+	MaxDataSize   int                           `json:"maxDataSize"`
+	DataRoot      hexutil.Bytes                 `json:"dataRoot"`
+	ParityRoots   []hexutil.Bytes               `json:"parityRoots"`
+	Chunker       swarmconnector.ChunkerOptions `json:"chunker"`
+	Placement     string                        `json:"placement,omitempty"`
+	CrossCheck    *CrossCheckStats              `json:"crossCheck,omitempty"`
+	Blocks        []BlockSnapshot               `json:"blocks"` // In the order of Lattice.Blocks
+}
+
+// BlockSnapshot is the state of a block.
+type BlockSnapshot struct {
+	Position       int            `json:"position"`
+	Parity         bool           `json:"parity,omitempty"`
+	Class          StrandClass    `json:"class,omitempty"`
+	Identifier     hexutil.Bytes  `json:"identifier,omitempty"`
+	DownloadStatus DownloadStatus `json:"downloadStatus"`
+	RepairStatus   RepairStatus   `json:"repairStatus"`
+	Unavailable    bool           `json:"unavailable,omitempty"`
+	DownloadStart  int64          `json:"downloadStart,omitempty"` // Unix nanoseconds
+	DownloadEnd    int64          `json:"downloadEnd,omitempty"`
+	RepairStart    int64          `json:"repairStart,omitempty"`
+	RepairEnd      int64          `json:"repairEnd,omitempty"`
+	HasData        bool           `json:"hasData,omitempty"`
+	Data           []byte         `json:"data,omitempty"`
+}
+
+// Snapshot returns the state of the lattice, with the data of the blocks if payloads is set.
+func (l *Lattice) Snapshot(payloads bool) *Snapshot {
+	snap := &Snapshot{
+		Alpha: l.Alpha, S: l.S, P: l.P, Size: l.Size, NumDataBlocks: l.NumDataBlocks,
+		MaxDataSize: l.maxDatablockSize, DataRoot: l.DataRootID, Chunker: l.Chunker, Placement: l.Placement().String(),
+		Blocks: make([]BlockSnapshot, len(l.Blocks)),
+	}
+	for _, root := range l.ParityRootID {
+		snap.ParityRoots = append(snap.ParityRoots, root)
+	}
+	if l.CrossCheck {
+		stats := l.CrossCheckStats()
+		snap.CrossCheck = &stats
+	}
+	for i, b := range l.Blocks {
+		b.lock.Lock()
+		bs := BlockSnapshot{
+			Position: b.Position, Parity: b.IsParity, Class: b.Class, Identifier: b.Identifier,
+			DownloadStatus: b.DownloadStatus, RepairStatus: b.RepairStatus, Unavailable: b.IsUnavailable,
+			DownloadStart: b.DownloadTime.StartTime, DownloadEnd: b.DownloadTime.EndTime,
+			RepairStart: b.RepairTime.StartTime, RepairEnd: b.RepairTime.EndTime,
+			HasData: b.HasData(true),
+		}
+		if payloads && bs.HasData {
+			bs.Data = append([]byte(nil), b.Data...)
+		}
+		b.lock.Unlock()
+		snap.Blocks[i] = bs
+	}
+	return snap
+}
+
+// Restore applies the statuses of a snapshot of the same lattice to its blocks. Blocks that had
+// data are restored as they were if the snapshot has their data, and otherwise as never retrieved,
+// as are blocks that were being retrieved or repaired. Blocks whose download failed keep that
+// status, and are only to be repaired again. Cross-check results, and the strands that
+// were quarantined, are restored as well.
+func (l *Lattice) Restore(snap *Snapshot) error {
+	if snap.Alpha != l.Alpha || snap.S != l.S || snap.P != l.P || len(snap.Blocks) != len(l.Blocks) {
+		return fmt.Errorf("snapshot of a lattice of %d blocks with alpha=%d s=%d p=%d, not %d blocks with alpha=%d s=%d p=%d",
+			len(snap.Blocks), snap.Alpha, snap.S, snap.P, len(l.Blocks), l.Alpha, l.S, l.P)
+	}
+	placement, err := swarmconnector.ParsePlacement(snap.Placement)
+	if err != nil {
+		return err
+	}
+	if placement.String() != l.Placement().String() {
+		return fmt.Errorf("snapshot of a lattice with %v placement, not %v", placement, l.Placement())
+	}
+	for i, bs := range snap.Blocks {
+		if b := l.Blocks[i]; b.Position != bs.Position || b.IsParity != bs.Parity || b.Class != bs.Class {
+			return fmt.Errorf("block %d of the snapshot is not %v", i, b)
+		}
+	}
+
+	for i, bs := range snap.Blocks {
+		b := l.Blocks[i]
+		b.lock.Lock()
+		b.Identifier = bs.Identifier
+		b.IsUnavailable = bs.Unavailable
+		b.DownloadTime = timePeriod{bs.DownloadStart, bs.DownloadEnd}
+		b.RepairTime = timePeriod{bs.RepairStart, bs.RepairEnd}
+		b.DownloadStatus, b.RepairStatus, b.Data = bs.DownloadStatus, bs.RepairStatus, nil
+		switch {
+		case bs.HasData && len(bs.Data) > 0:
+			b.Data = append([]byte(nil), bs.Data...)
+		case b.DownloadStatus == DownloadFailed && (bs.HasData || b.RepairStatus == RepairPending):
+			// The download is not tried again, but the block is to be repaired again.
+			b.RepairStatus, b.RepairTime = NoRepair, timePeriod{}
+		case bs.HasData, b.DownloadStatus == DownloadPending, b.RepairStatus == RepairPending:
+			b.DownloadStatus, b.RepairStatus = NoDownload, NoRepair
+			b.DownloadTime, b.RepairTime = timePeriod{}, timePeriod{}
+		}
+		b.lock.Unlock()
+	}
+
+	if snap.CrossCheck != nil {
+		l.CrossCheck = true
+		l.checkLock.Lock()
+		l.checkStats = *snap.CrossCheck
+		l.checkStats.Quarantined = append([]Strand(nil), snap.CrossCheck.Quarantined...)
+		l.quarantine = make(map[Strand]bool)
+		for _, strand := range l.checkStats.Quarantined {
+			l.quarantine[strand] = true
+		}
+		l.checkLock.Unlock()
+	}
+	return nil
+}
+
+// RestoreLattice builds the lattice of a snapshot with RunInit, and restores the state of its
+// blocks. The chunks that are still missing are retrieved from getter.
+func RestoreLattice(ctx context.Context, snap *Snapshot, getter storage.Getter) (*Lattice, error) {
+	parityRoots := make([][]byte, len(snap.ParityRoots))
+	for i, root := range snap.ParityRoots {
+		parityRoots[i] = root
+	}
+	placement, err := swarmconnector.ParsePlacement(snap.Placement)
+	if err != nil {
+		return nil, err
+	}
+	l, err := newSwarmLattice(ctx, snap.Alpha, snap.S, snap.P, snap.Size, getter, snap.DataRoot,
+		parityRoots, snap.MaxDataSize, snap.Chunker, placement)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.Restore(snap); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// WriteFile writes the snapshot as JSON to path.
+func (s *Snapshot) WriteFile(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// ReadSnapshot reads a snapshot written by Snapshot.WriteFile.
+func ReadSnapshot(path string) (*Snapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := new(Snapshot)
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %v", path, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,66 @@
+package entangler_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/simulation"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	size := uint64(128 * chunk.DefaultSize)
+	ts := newTestSetup(size, 3, 5, 5)
+	original := fileData(ts.Roots[0])
+	const failedLeaf = 30
+
+	failures := ts.NoFailures()
+	failures[ts.Alpha] = simulation.UnavailableList(failedLeaf)
+	lattice, getter := memoryLattice(ts, failures)
+	buildTree(t, ts, lattice, getter)
+
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := lattice.Snapshot(true).WriteFile(path); err != nil {
+		t.Fatal(err.Error())
+	}
+	snap, err := entangler.ReadSnapshot(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.Equal(t, lattice.Snapshot(true), snap)
+
+	// With the data of the blocks, the file is rebuilt with nothing to retrieve it from.
+	nothing := swarmconnector.NewReplayGetter(&swarmconnector.Trace{})
+	restored, err := entangler.RestoreLattice(context.Background(), snap, nothing)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for i, b := range lattice.Blocks {
+		r := restored.Blocks[i]
+		assert.Equal(t, b.DownloadStatus, r.DownloadStatus, b.String())
+		assert.Equal(t, b.RepairStatus, r.RepairStatus, b.String())
+		if assert.Equal(t, b.HasData(), r.HasData(), b.String()) && b.HasData() {
+			assert.Equal(t, b.Data, r.Data, b.String())
+		}
+		assert.Equal(t, b.DownloadTime, r.DownloadTime, b.String())
+	}
+	assert.Equal(t, original, fileData(buildTree(t, ts, restored, nothing)))
+	assert.Zero(t, nothing.Unrecorded())
+
+	// Without the data, the blocks that had data are to be retrieved again.
+	restored, err = entangler.RestoreLattice(context.Background(), lattice.Snapshot(false), nothing)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.Equal(t, entangler.DownloadFailed, restored.GetBlock(failedLeaf).DownloadStatus)
+	assert.Equal(t, entangler.NoDownload, restored.GetBlock(failedLeaf+1).DownloadStatus)
+	assert.False(t, restored.GetBlock(failedLeaf+1).HasData())
+
+	// A snapshot only applies to a lattice of the same shape.
+	other := entangler.NewMemoryLattice(ts.Alpha, ts.S, ts.P, 10)
+	assert.NotNil(t, other.Restore(snap))
+}
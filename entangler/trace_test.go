@@ -0,0 +1,74 @@
+package entangler_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/config"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/simulation"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceReplay(t *testing.T) {
+	size := uint64(128 * chunk.DefaultSize)
+	ts := newTestSetup(size, 3, 5, 5)
+	original := fileData(ts.Roots[0])
+	lc := config.Lattice{Alpha: ts.Alpha, S: ts.S, P: ts.P}
+
+	download := func(getter storage.Getter, trace *swarmconnector.Trace) (*swarmconnector.TreeChunk, *entangler.Lattice) {
+		lattice, err := entangler.NewSwarmLatticeConfig(context.Background(), trace.Lattice, trace.Size, getter,
+			trace.DataRoot, trace.ParityAddrs(), trace.Chunker)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		tree, err := swarmconnector.BuildCompleteTree(context.Background(), getter, storage.Reference(trace.DataRoot),
+			trace.Chunker.TreeOptions(), lattice)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return tree, lattice
+	}
+
+	failures := ts.NoFailures()
+	failures[ts.Alpha] = simulation.UnavailableList(10, 11, 40)
+	failures[entangler.Horizontal] = ts.Canon(simulation.Unavailable(0), 12)
+	_, getter := memoryLattice(ts, failures)
+
+	trace := &swarmconnector.Trace{Lattice: lc, Size: size, DataRoot: ts.Roots[0].Key}
+	for _, addr := range ts.ParityAddrs() {
+		trace.ParityRoots = append(trace.ParityRoots, addr)
+	}
+	recorder := swarmconnector.NewRecorder(getter, trace)
+	tree, recorded := download(recorder, trace)
+	assert.Equal(t, original, fileData(tree))
+	assert.NotEmpty(t, trace.Requests)
+
+	path := filepath.Join(t.TempDir(), "trace.json")
+	if err := trace.WriteFile(path); err != nil {
+		t.Fatal(err.Error())
+	}
+	read, err := swarmconnector.ReadTrace(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.Equal(t, trace, read)
+
+	// The replay repairs the file without the scenario, and only the chunks that were retrieved
+	// in the recording are retrieved.
+	replay := swarmconnector.NewReplayGetter(read)
+	tree, replayed := download(replay, read)
+	assert.Equal(t, original, fileData(tree))
+	for i, b := range replayed.Blocks {
+		if b.DownloadStatus == entangler.DownloadSuccess {
+			assert.Equal(t, entangler.DownloadSuccess, recorded.Blocks[i].DownloadStatus, b.String())
+		}
+	}
+	for _, block := range []int{10, 11, 40} {
+		assert.NotEqual(t, entangler.DownloadSuccess, replayed.GetBlock(block).DownloadStatus)
+	}
+}
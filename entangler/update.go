@@ -0,0 +1,124 @@
+package entangler
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/relab/snarl-mw21/repair"
+	"github.com/relab/snarl-mw21/swarmconnector"
+)
+
+// FileUpdate is the result of Lattice.UpdateFile.
+type FileUpdate struct {
+	DataRoot    []byte
+	ParityRoots [][]byte      // One per strand class
+	Chunks      []chunk.Chunk // New chunks of the data and parity trees, children before their parents
+}
+
+// UpdateFile writes data over the file at offset, and returns the chunks of the data and parity trees that
+// change. The size of the file stays the same. Only the parities downstream of the changed data blocks on each
+// strand change, see Entangler.Update, so the rest of the lattice is neither retrieved nor entangled again.
+// The data chunks are retrieved, or repaired, through the lattice, while the parity chunks that change must
+// be available. The lattice keeps describing the file as it was before the update.
+func (l *Lattice) UpdateFile(offset uint64, data []byte) (*FileUpdate, error) {
+	end := offset + uint64(len(data))
+	dataUpdates, err := swarmconnector.UpdateTree(l.ctx, l.Getter, l.DataRootID, l.Chunker.TreeOptions(), l,
+		[]swarmconnector.Range{{Start: offset, End: end}}, func(leaf uint64, payload []byte) {
+			from, to := leaf, leaf+uint64(len(payload))
+			if from < offset {
+				from = offset
+			}
+			if to > end {
+				to = end
+			}
+			copy(payload[from-leaf:to-leaf], data[from-offset:to-offset])
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	update := &FileUpdate{DataRoot: l.DataRootID, ParityRoots: make([][]byte, len(l.ParityRootID))}
+	copy(update.ParityRoots, l.ParityRootID)
+	if len(dataUpdates) == 0 {
+		return update, nil
+	}
+	update.DataRoot = dataUpdates[len(dataUpdates)-1].New.Address()
+	for _, u := range dataUpdates {
+		update.Chunks = append(update.Chunks, u.New)
+	}
+
+	// The change of every parity, by class and the position of its left data block. Parities that
+	// depend on more than one of the changed data blocks get the XOR of their changes.
+	deltas := make([]map[int][]byte, l.Alpha)
+	for class := range deltas {
+		deltas[class] = make(map[int][]byte)
+	}
+	result := make(chan *EntangledBlock)
+	go func() {
+		defer close(result)
+		for _, u := range dataUpdates {
+			delta := XORByteSlice(u.Old.Data()[swarmconnector.ChunkSizeOffset:], u.New.Data()[swarmconnector.ChunkSizeOffset:])
+			l.Entangler.Update(delta, l.GetBlock(u.Index).Position, result)
+		}
+	}()
+	for block := range result {
+		deltas[block.Class][block.LeftIndex] = XORByteSlice(deltas[block.Class][block.LeftIndex], block.Data)
+	}
+
+	for class, classDeltas := range deltas {
+		if len(classDeltas) == 0 {
+			continue
+		}
+		if class >= len(l.ParityRootID) {
+			return nil, fmt.Errorf("missing parity root of strand %v", StrandClass(class))
+		}
+		chunks, root, err := l.updateParities(class, classDeltas)
+		if err != nil {
+			return nil, fmt.Errorf("could not update the parities of strand %v: %v", StrandClass(class), err)
+		}
+		update.Chunks = append(update.Chunks, chunks...)
+		update.ParityRoots[class] = root
+	}
+	return update, nil
+}
+
+// updateParities XORs the deltas into the parities of the given class, by the position of their left data
+// block, and returns the chunks of the parity tree that change and its new root.
+func (l *Lattice) updateParities(class int, deltas map[int][]byte) ([]chunk.Chunk, []byte, error) {
+	root := l.ParityRootID[class]
+	chunker, err := swarmconnector.DetectChunker(l.ctx, l.Getter, root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Parities are stored in the order of their left data block, in chunks of chunk.DefaultSize bytes.
+	positions := make([]int, 0, len(deltas))
+	for position := range deltas {
+		positions = append(positions, position)
+	}
+	sort.Ints(positions)
+	ranges := make([]swarmconnector.Range, len(positions))
+	for i, position := range positions {
+		ranges[i] = swarmconnector.Range{Start: uint64(position-1) * chunk.DefaultSize, End: uint64(position) * chunk.DefaultSize}
+	}
+
+	// The internal nodes of a parity tree are not part of the lattice, so it can not repair them.
+	parityUpdates, err := swarmconnector.UpdateTree(l.ctx, l.Getter, root, chunker.TreeOptions(),
+		repair.NewMockRepair(l.Getter), ranges, func(leaf uint64, payload []byte) {
+			if delta, ok := deltas[int(leaf/chunk.DefaultSize)+1]; ok {
+				XORByteSliceFast(payload, delta, payload)
+			}
+		})
+	if err != nil {
+		return nil, nil, err
+	}
+	chunks := make([]chunk.Chunk, len(parityUpdates))
+	for i, u := range parityUpdates {
+		chunks[i] = u.New
+	}
+	if len(chunks) == 0 {
+		return nil, root, nil
+	}
+	return chunks, chunks[len(chunks)-1].Address(), nil
+}
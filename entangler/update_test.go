@@ -0,0 +1,97 @@
+package entangler_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/repair"
+	"github.com/relab/snarl-mw21/simulation"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/relab/snarl-mw21/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateFile(t *testing.T) {
+	ctx := context.Background()
+	size := uint64(256 * chunk.DefaultSize)
+	ts := newTestSetup(size, 3, 5, 5)
+
+	tests := []struct {
+		desc   string
+		offset uint64
+		leaves []int // Canonical indexes of the updated leaves
+	}{
+		// The end of the last leaf below the first internal node and the start of the first leaf below the second.
+		{"AcrossInternalNodes", 128*chunk.DefaultSize - 100, []int{128, 130}},
+		// The first block of every strand, whose left parities are the wrapped parities at the end of the lattice.
+		{"FirstBlock", 0, []int{1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			lattice, _ := healthLattice(ts, ts.NoFailures()) // The parity trees are updated from their roots
+
+			patch := utils.GenerateRandomBytes(200, 1)
+			update, err := lattice.UpdateFile(test.offset, patch)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			expected := fileData(ts.Roots[0])
+			copy(expected[test.offset:], patch)
+
+			// The update must give the same trees as entangling the updated file from scratch.
+			expectedTs, err := simulation.NewDataScenario(expected, ts.Alpha, ts.S, ts.P)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			assert.Equal(t, []byte(expectedTs.Roots[0].Key), update.DataRoot)
+			assert.Equal(t, expectedTs.ParityAddrs(), update.ParityRoots)
+
+			// The updated leaves, their parents and the root, and the changed parities with their parity tree nodes.
+			assert.Greater(t, len(update.Chunks), 3+len(test.leaves))
+			assert.Less(t, len(update.Chunks), ts.UniqueChunks(), "Every chunk changed.")
+			for class, root := range update.ParityRoots {
+				assert.NotEqual(t, ts.Roots[class+1].Key, root, "Parity root of class %d did not change.", class)
+			}
+
+			// The updated leaves are lost, and can only be repaired with the updated parities.
+			store := utils.NewMapChunkStore()
+			putGetter := storage.NewHasherStore(store, storage.MakeHashFunc(storage.DefaultHash), false,
+				chunk.NewTag(0, "test-tag", 0, false))
+			for _, root := range ts.Roots {
+				root.FilterChunks(func(tc *swarmconnector.TreeChunk) bool {
+					store.Put(ctx, chunk.ModePutUpload, chunk.NewChunk(tc.Key, tc.StoredData()))
+					return false
+				})
+			}
+			store.Put(ctx, chunk.ModePutUpload, update.Chunks...)
+			roots := make([]*swarmconnector.TreeChunk, 0, 1+len(update.ParityRoots))
+			for _, addr := range append([][]byte{update.DataRoot}, update.ParityRoots...) {
+				root, err := swarmconnector.BuildCompleteTree(ctx, putGetter, addr, swarmconnector.BuildTreeOptions{},
+					repair.NewMockRepair(putGetter))
+				if err != nil {
+					t.Fatal(err.Error())
+				}
+				roots = append(roots, root)
+			}
+			updated := &simulation.Scenario{Alpha: ts.Alpha, S: ts.S, P: ts.P, Filesize: size}
+			updated.AddRoots(roots)
+			failures := updated.NoFailures()
+			failures[ts.Alpha] = simulation.UnavailableList(test.leaves...)
+			lattice, getter := memoryLattice(updated, failures)
+			assert.Equal(t, expected, fileData(buildTree(t, updated, lattice, getter)))
+			for _, leaf := range test.leaves {
+				assert.Equal(t, entangler.RepairSuccess, lattice.GetBlock(leaf).RepairStatus, "Leaf %d.", leaf)
+			}
+		})
+	}
+
+	// The size of the file can not change.
+	lattice, _ := healthLattice(ts, ts.NoFailures())
+	_, err := lattice.UpdateFile(size-1, utils.GenerateRandomBytes(200, 1))
+	assert.True(t, errors.Is(err, swarmconnector.ErrInvalidRange), "Update past the end accepted. %v", err)
+}
@@ -0,0 +1,146 @@
+package redundancy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/swarmconnector"
+)
+
+// Entanglement is alpha entanglement with S horizontal and P helical strands, as in package
+// entangler. The lattice is closed, and every data block has Alpha parities: the parity with
+// index n+i*Alpha+class is the parity of the given strand class to the right of data block i.
+// Blocks must be larger than swarmconnector.ChunkSizeOffset.
+type Entanglement struct {
+	Alpha, S, P int
+}
+
+func (e Entanglement) validate() error {
+	if e.Alpha < 1 || e.Alpha > 3 || e.S < 1 || e.P < 1 {
+		return fmt.Errorf("invalid entanglement %d,%d,%d", e.Alpha, e.S, e.P)
+	}
+	return nil
+}
+
+// Name implements Scheme.
+func (e Entanglement) Name() string {
+	return fmt.Sprintf("entanglement:%d,%d,%d", e.Alpha, e.S, e.P)
+}
+
+// Redundancy implements Scheme.
+func (e Entanglement) Redundancy(n int) int {
+	return e.Alpha * n
+}
+
+// Encode implements Scheme.
+func (e Entanglement) Encode(data [][]byte) ([][]byte, error) {
+	if err := e.validate(); err != nil {
+		return nil, err
+	}
+	size, err := blockSize(data)
+	if err != nil {
+		return nil, err
+	} else if err := missingData(data); err != nil {
+		return nil, errors.New("entanglement needs every data block")
+	} else if size <= swarmconnector.ChunkSizeOffset {
+		return nil, fmt.Errorf("blocks of %d bytes, entanglement needs more than %d", size, swarmconnector.ChunkSizeOffset)
+	}
+
+	tangler := entangler.NewEntangler(e.P, e.P, e.S, e.Alpha, size)
+	resultChan := make(chan *entangler.EntangledBlock)
+	done := make(chan []*entangler.EntangledBlock)
+	go func() {
+		// A closed lattice replaces the first parities of the strands, as in simulation.Scenario.
+		blocks := make([]*entangler.EntangledBlock, 0)
+		for block := range resultChan {
+			if block.LeftIndex < 1 || int(block.Class) >= e.Alpha {
+				continue
+			}
+			replaced := false
+			if block.Replace {
+				for _, b := range blocks {
+					if b.LeftIndex == block.LeftIndex && b.RightIndex == block.RightIndex && b.Class == block.Class {
+						b.Data, replaced = block.Data, true
+						break
+					}
+				}
+			}
+			if !replaced {
+				blocks = append(blocks, block)
+			}
+		}
+		done <- blocks
+	}()
+	for i, d := range data {
+		tangler.Entangle(d, i+1, resultChan)
+	}
+	tangler.WrapLattice(resultChan)
+	close(resultChan)
+
+	parities := make([][]byte, e.Redundancy(len(data)))
+	for _, block := range <-done {
+		parities[(block.LeftIndex-1)*e.Alpha+int(block.Class)] = block.Data
+	}
+	return parities, nil
+}
+
+// RepairSets implements Scheme. Every set is a pair of blocks.
+func (e Entanglement) RepairSets(n, index int) []RepairSet {
+	l := entangler.NewMemoryLattice(e.Alpha, e.S, e.P, n)
+	indexOf := func(b *entangler.Block) int {
+		if b.IsParity {
+			return n + (b.Position-1)*e.Alpha + int(b.Class)
+		}
+		return b.Position - 1
+	}
+	pairs := l.Blocks[index].GetRepairPairs()
+	sets := make([]RepairSet, len(pairs))
+	for i, pair := range pairs {
+		sets[i] = RepairSet{Blocks: []int{indexOf(pair.Left), indexOf(pair.Right)}, Need: 2}
+	}
+	return sets
+}
+
+// Decode implements Scheme. The blocks are repaired with the repair rules of entangler.Lattice.
+func (e Entanglement) Decode(blocks [][]byte, n int) error {
+	if err := e.validate(); err != nil {
+		return err
+	} else if err := checkDecode(e, blocks, n); err != nil {
+		return err
+	}
+	size, err := blockSize(blocks)
+	if err != nil {
+		return err
+	}
+
+	// The blocks of the lattice are in the same order as the blocks of the file.
+	l := entangler.NewMemoryLattice(e.Alpha, e.S, e.P, n)
+	for i, b := range l.Blocks {
+		if blocks[i] != nil {
+			b.DownloadSuccess(blocks[i])
+		}
+	}
+	hasData := func() int {
+		count := 0
+		for _, b := range l.Blocks {
+			if b.HasData() {
+				count++
+			}
+		}
+		return count
+	}
+	for before := -1; before != hasData(); {
+		before = hasData()
+		l.RepairAll()
+		l.ResetRepairStatus()
+		l.ResetMendingStatus()
+	}
+
+	for i, b := range l.Blocks {
+		if blocks[i] == nil && b.HasData() {
+			blocks[i] = b.Data[:size]
+		}
+	}
+	return missingData(blocks[:n])
+}
@@ -0,0 +1,127 @@
+// Package redundancy gives a common interface to the schemes that protect a file with redundancy
+// blocks: alpha entanglement, Reed-Solomon codes and replication.
+//
+// The schemes encode and decode files in memory, for the simulation to compare them on the same
+// failures. Content in Swarm is only protected with alpha entanglement: entangle, download and
+// repair use the lattices of package entangler, and collection indexes do not record a scheme.
+//
+// A file is a list of n data blocks of the same size. The blocks of an encoded file are indexed
+// with the data blocks first, from 0 to n-1, followed by the redundancy blocks of the scheme.
+package redundancy
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Scheme is a redundancy scheme.
+type Scheme interface {
+	// Name returns the scheme and its parameters, as accepted by Parse.
+	Name() string
+	// Redundancy returns the number of redundancy blocks of a file with n data blocks.
+	Redundancy(n int) int
+	// Encode returns the redundancy blocks of the data blocks.
+	Encode(data [][]byte) ([][]byte, error)
+	// RepairSets returns the ways the block with the given index, in a file with n data blocks,
+	// can be repaired.
+	RepairSets(n, index int) []RepairSet
+	// Decode repairs the blocks of a file with n data blocks that are nil, as far as it can.
+	// It returns ErrUnrecoverable if any data block is still missing.
+	Decode(blocks [][]byte, n int) error
+}
+
+// RepairSet is a way to repair a block: from any Need of the Blocks, by index.
+type RepairSet struct {
+	Blocks []int
+	Need   int
+}
+
+// ErrUnrecoverable is returned by Decode when data blocks can not be repaired.
+var ErrUnrecoverable = errors.New("data blocks can not be recovered")
+
+// Parse returns the scheme with the given name: entanglement:alpha,s,p for alpha entanglement,
+// rs:k,m for a Reed-Solomon code or replication:copies.
+func Parse(name string) (Scheme, error) {
+	kind, params := name, ""
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		kind, params = name[:i], name[i+1:]
+	}
+	var nums []int
+	if params != "" {
+		for _, param := range strings.Split(params, ",") {
+			num, err := strconv.Atoi(strings.TrimSpace(param))
+			if err != nil {
+				return nil, fmt.Errorf("invalid redundancy scheme %q: %v", name, err)
+			}
+			nums = append(nums, num)
+		}
+	}
+
+	var scheme interface {
+		Scheme
+		validate() error
+	}
+	switch {
+	case kind == "entanglement" && len(nums) == 3:
+		scheme = Entanglement{Alpha: nums[0], S: nums[1], P: nums[2]}
+	case kind == "rs" && len(nums) == 2:
+		scheme = ReedSolomon{K: nums[0], M: nums[1]}
+	case kind == "replication" && len(nums) == 1:
+		scheme = Replication{Copies: nums[0]}
+	default:
+		return nil, fmt.Errorf("unknown redundancy scheme %q", name)
+	}
+	if err := scheme.validate(); err != nil {
+		return nil, err
+	}
+	return scheme, nil
+}
+
+// blockSize returns the size of the blocks that are not nil, which must all have the same size.
+func blockSize(blocks [][]byte) (int, error) {
+	size := -1
+	for _, b := range blocks {
+		if b == nil {
+			continue
+		}
+		if size == -1 {
+			size = len(b)
+		} else if len(b) != size {
+			return 0, fmt.Errorf("blocks of %d and %d bytes, must be the same size", size, len(b))
+		}
+	}
+	if size <= 0 {
+		return 0, errors.New("no blocks with data")
+	}
+	return size, nil
+}
+
+// checkDecode checks that blocks is a file with n data blocks encoded with the scheme, and that
+// some of them are left.
+func checkDecode(s Scheme, blocks [][]byte, n int) error {
+	if want := n + s.Redundancy(n); len(blocks) != want {
+		return fmt.Errorf("%d blocks, %s gives %d data blocks %d blocks", len(blocks), s.Name(), n, want)
+	}
+	for _, b := range blocks {
+		if b != nil {
+			return nil
+		}
+	}
+	return missingData(blocks[:n])
+}
+
+// missingData returns ErrUnrecoverable if any of the data blocks is nil.
+func missingData(data [][]byte) error {
+	missing := 0
+	for _, b := range data {
+		if b == nil {
+			missing++
+		}
+	}
+	if missing > 0 {
+		return fmt.Errorf("%w: %d of %d missing", ErrUnrecoverable, missing, len(data))
+	}
+	return nil
+}
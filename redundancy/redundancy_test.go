@@ -0,0 +1,114 @@
+package redundancy_test
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/redundancy"
+	"github.com/stretchr/testify/assert"
+)
+
+func testData(n, size int) [][]byte {
+	rnd := rand.New(rand.NewSource(int64(n)))
+	data := make([][]byte, n)
+	for i := range data {
+		data[i] = make([]byte, size)
+		rnd.Read(data[i])
+	}
+	return data
+}
+
+func encode(t *testing.T, scheme redundancy.Scheme, data [][]byte) [][]byte {
+	redundant, err := scheme.Encode(data)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.Len(t, redundant, scheme.Redundancy(len(data)))
+	return append(append([][]byte(nil), data...), redundant...)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		scheme redundancy.Scheme
+	}{
+		{"entanglement:3,5,5", redundancy.Entanglement{Alpha: 3, S: 5, P: 5}},
+		{"rs:10,4", redundancy.ReedSolomon{K: 10, M: 4}},
+		{"replication:3", redundancy.Replication{Copies: 3}},
+	}
+	for _, test := range tests {
+		scheme, err := redundancy.Parse(test.name)
+		assert.Nil(t, err)
+		assert.Equal(t, test.scheme, scheme)
+		assert.Equal(t, test.name, scheme.Name())
+	}
+	for _, name := range []string{"", "rs", "rs:10", "rs:200,100", "replication:0", "entanglement:4,5,5", "xor:2"} {
+		_, err := redundancy.Parse(name)
+		assert.NotNil(t, err, name)
+	}
+}
+
+func TestSchemes(t *testing.T) {
+	const n, size = 50, 64
+	tests := []struct {
+		scheme redundancy.Scheme
+		lost   []int // Recoverable
+		worst  []int // Unrecoverable
+	}{
+		{redundancy.Entanglement{Alpha: 3, S: 5, P: 5}, []int{3, 4, 10, 30}, nil},
+		{redundancy.ReedSolomon{K: 10, M: 4}, []int{0, 3, 4, 54, 55}, []int{0, 1, 2, 3, 50}},
+		{redundancy.ReedSolomon{K: 8, M: 2}, []int{48, 49}, []int{48, 49, n + 13}},
+		{redundancy.Replication{Copies: 3}, []int{7, n + 7, 8}, []int{7, n + 7, 2*n + 7}},
+	}
+	for _, test := range tests {
+		data := testData(n, size)
+		all := encode(t, test.scheme, data)
+
+		blocks := append([][]byte(nil), all...)
+		for _, i := range test.lost {
+			blocks[i] = nil
+		}
+		assert.Nil(t, test.scheme.Decode(blocks, n), test.scheme.Name())
+		assert.Equal(t, data, blocks[:n], test.scheme.Name())
+
+		if test.worst != nil {
+			blocks = append([][]byte(nil), all...)
+			for _, i := range test.worst {
+				blocks[i] = nil
+			}
+			err := test.scheme.Decode(blocks, n)
+			assert.True(t, errors.Is(err, redundancy.ErrUnrecoverable), test.scheme.Name())
+		}
+	}
+}
+
+func TestRepairSets(t *testing.T) {
+	const n, size = 40, 64
+	data := testData(n, size)
+
+	// Every pair of an entanglement repair set gives the block.
+	e := redundancy.Entanglement{Alpha: 3, S: 5, P: 5}
+	all := encode(t, e, data)
+	for i := 0; i < n; i++ {
+		sets := e.RepairSets(n, i)
+		assert.True(t, len(sets) >= e.Alpha)
+		for _, set := range sets {
+			assert.Equal(t, 2, set.Need)
+			assert.Equal(t, all[i], entangler.XORByteSlice(all[set.Blocks[0]], all[set.Blocks[1]]))
+		}
+	}
+
+	rs := redundancy.ReedSolomon{K: 16, M: 4}
+	sets := rs.RepairSets(n, 35)
+	assert.Equal(t, 8, sets[0].Need)
+	assert.Len(t, sets[0].Blocks, 7+4)
+	sets = rs.RepairSets(n, n+9)
+	assert.Equal(t, 8, sets[0].Need)
+	assert.Len(t, sets[0].Blocks, 8+3)
+
+	r := redundancy.Replication{Copies: 3}
+	sets = r.RepairSets(n, n+5)
+	assert.Equal(t, []redundancy.RepairSet{{Blocks: []int{5, 2*n + 5}, Need: 1}}, sets)
+}
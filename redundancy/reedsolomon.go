@@ -0,0 +1,237 @@
+package redundancy
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ReedSolomon is a systematic Reed-Solomon code over GF(2^8). The data blocks are split into
+// stripes of K blocks, and every stripe gets M parities, so that any K of the K+M blocks of a stripe
+// recover it. The last stripe is padded with blocks of zeros that are not stored. The parities of
+// stripe s have the indexes n+s*M to n+s*M+M-1.
+type ReedSolomon struct {
+	K, M int
+}
+
+func (r ReedSolomon) validate() error {
+	if r.K < 1 || r.M < 1 || r.K+r.M > 256 {
+		return fmt.Errorf("invalid Reed-Solomon code %d,%d, needs k+m <= 256", r.K, r.M)
+	}
+	return nil
+}
+
+// Name implements Scheme.
+func (r ReedSolomon) Name() string {
+	return fmt.Sprintf("rs:%d,%d", r.K, r.M)
+}
+
+// Redundancy implements Scheme.
+func (r ReedSolomon) Redundancy(n int) int {
+	return r.stripes(n) * r.M
+}
+
+// stripes returns the number of stripes of a file with n data blocks.
+func (r ReedSolomon) stripes(n int) int {
+	return (n + r.K - 1) / r.K
+}
+
+// stripeSize returns the number of data blocks in the given stripe, which is less than K for the
+// last stripe if it is padded.
+func (r ReedSolomon) stripeSize(n, stripe int) int {
+	if rest := n - stripe*r.K; rest < r.K {
+		return rest
+	}
+	return r.K
+}
+
+// coefficient returns the coefficient of data block i in parity j, from a Cauchy matrix. Any K
+// rows of the identity matrix and the Cauchy matrix together can be inverted.
+func (r ReedSolomon) coefficient(j, i int) byte {
+	return gfInv(byte(r.K+j) ^ byte(i))
+}
+
+// Encode implements Scheme.
+func (r ReedSolomon) Encode(data [][]byte) ([][]byte, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	size, err := blockSize(data)
+	if err != nil {
+		return nil, err
+	} else if err := missingData(data); err != nil {
+		return nil, errors.New("Reed-Solomon encoding needs every data block")
+	}
+
+	parities := make([][]byte, r.Redundancy(len(data)))
+	for s := 0; s < r.stripes(len(data)); s++ {
+		for j := 0; j < r.M; j++ {
+			parity := make([]byte, size)
+			for i := 0; i < r.stripeSize(len(data), s); i++ {
+				gfMulAdd(parity, data[s*r.K+i], r.coefficient(j, i))
+			}
+			parities[s*r.M+j] = parity
+		}
+	}
+	return parities, nil
+}
+
+// RepairSets implements Scheme. A block is repaired from its stripe.
+func (r ReedSolomon) RepairSets(n, index int) []RepairSet {
+	stripe := index / r.K
+	if index >= n {
+		stripe = (index - n) / r.M
+	}
+	size := r.stripeSize(n, stripe)
+	set := RepairSet{Need: size}
+	for i := 0; i < size; i++ {
+		if b := stripe*r.K + i; b != index {
+			set.Blocks = append(set.Blocks, b)
+		}
+	}
+	for j := 0; j < r.M; j++ {
+		if b := n + stripe*r.M + j; b != index {
+			set.Blocks = append(set.Blocks, b)
+		}
+	}
+	return []RepairSet{set}
+}
+
+// Decode implements Scheme. Every stripe with at least K blocks is repaired, including its parities.
+func (r ReedSolomon) Decode(blocks [][]byte, n int) error {
+	if err := r.validate(); err != nil {
+		return err
+	} else if err := checkDecode(r, blocks, n); err != nil {
+		return err
+	}
+	size, err := blockSize(blocks)
+	if err != nil {
+		return err
+	}
+
+	for s := 0; s < r.stripes(n); s++ {
+		data := blocks[s*r.K : s*r.K+r.stripeSize(n, s)]
+		parities := blocks[n+s*r.M : n+(s+1)*r.M]
+
+		// The rows of the blocks that are present, with the padding blocks as known zeros.
+		var rows [][]byte
+		var values [][]byte
+		missing := false
+		for i := 0; i < r.K && len(rows) < r.K; i++ {
+			row := make([]byte, r.K)
+			row[i] = 1
+			if i >= len(data) {
+				rows, values = append(rows, row), append(values, make([]byte, size))
+			} else if data[i] != nil {
+				rows, values = append(rows, row), append(values, data[i])
+			} else {
+				missing = true
+			}
+		}
+		for j := 0; j < r.M && len(rows) < r.K; j++ {
+			if parities[j] == nil {
+				continue
+			}
+			row := make([]byte, r.K)
+			for i := range row {
+				row[i] = r.coefficient(j, i)
+			}
+			rows, values = append(rows, row), append(values, parities[j])
+		}
+
+		if missing {
+			if len(rows) < r.K {
+				continue
+			}
+			solved := gfSolve(rows, values)
+			for i := range data {
+				if data[i] == nil {
+					data[i] = solved[i]
+				}
+			}
+		}
+		for j := range parities {
+			if parities[j] == nil {
+				parity := make([]byte, size)
+				for i := range data {
+					gfMulAdd(parity, data[i], r.coefficient(j, i))
+				}
+				parities[j] = parity
+			}
+		}
+	}
+	return missingData(blocks[:n])
+}
+
+// gfSolve solves rows·x = values for x over GF(2^8) with Gauss-Jordan elimination. The rows must be
+// a K×K invertible matrix, and are changed.
+func gfSolve(rows, values [][]byte) [][]byte {
+	values = append([][]byte(nil), values...)
+	for i := range values {
+		values[i] = append([]byte(nil), values[i]...)
+	}
+	k := len(rows)
+	for col := 0; col < k; col++ {
+		pivot := col
+		for rows[pivot][col] == 0 {
+			pivot++
+		}
+		rows[col], rows[pivot] = rows[pivot], rows[col]
+		values[col], values[pivot] = values[pivot], values[col]
+
+		inv := gfInv(rows[col][col])
+		for c := range rows[col] {
+			rows[col][c] = gfMul(rows[col][c], inv)
+		}
+		for b := range values[col] {
+			values[col][b] = gfMul(values[col][b], inv)
+		}
+		for row := 0; row < k; row++ {
+			if f := rows[row][col]; row != col && f != 0 {
+				for c := range rows[row] {
+					rows[row][c] ^= gfMul(rows[col][c], f)
+				}
+				gfMulAdd(values[row], values[col], f)
+			}
+		}
+	}
+	return values
+}
+
+// gfExp and gfLog are the exponent and logarithm tables of GF(2^8) with the polynomial
+// x^8+x^4+x^3+x^2+1 and generator 2.
+var gfExp, gfLog = func() (exp [510]byte, log [256]byte) {
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i], exp[i+255] = byte(x), byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	return
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// gfMulAdd adds f·src to dst.
+func gfMulAdd(dst, src []byte, f byte) {
+	if f == 0 {
+		return
+	}
+	logF := int(gfLog[f])
+	for i, b := range src {
+		if b != 0 {
+			dst[i] ^= gfExp[int(gfLog[b])+logF]
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package redundancy
+
+import "fmt"
+
+// Replication stores Copies copies of every data block, the data block itself included. Copy c of
+// data block i, for c from 1, has the index n+(c-1)*n+i.
+type Replication struct {
+	Copies int
+}
+
+func (r Replication) validate() error {
+	if r.Copies < 1 {
+		return fmt.Errorf("invalid replication with %d copies", r.Copies)
+	}
+	return nil
+}
+
+// Name implements Scheme.
+func (r Replication) Name() string {
+	return fmt.Sprintf("replication:%d", r.Copies)
+}
+
+// Redundancy implements Scheme.
+func (r Replication) Redundancy(n int) int {
+	return (r.Copies - 1) * n
+}
+
+// Encode implements Scheme.
+func (r Replication) Encode(data [][]byte) ([][]byte, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	} else if _, err := blockSize(data); err != nil {
+		return nil, err
+	}
+	copies := make([][]byte, 0, r.Redundancy(len(data)))
+	for c := 1; c < r.Copies; c++ {
+		for _, d := range data {
+			copies = append(copies, append([]byte(nil), d...))
+		}
+	}
+	return copies, nil
+}
+
+// RepairSets implements Scheme. A block is repaired from any other copy.
+func (r Replication) RepairSets(n, index int) []RepairSet {
+	set := RepairSet{Need: 1}
+	for c := 0; c < r.Copies; c++ {
+		if b := c*n + index%n; b != index {
+			set.Blocks = append(set.Blocks, b)
+		}
+	}
+	return []RepairSet{set}
+}
+
+// Decode implements Scheme.
+func (r Replication) Decode(blocks [][]byte, n int) error {
+	if err := r.validate(); err != nil {
+		return err
+	} else if err := checkDecode(r, blocks, n); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		var found []byte
+		for c := 0; c < r.Copies && found == nil; c++ {
+			found = blocks[c*n+i]
+		}
+		if found == nil {
+			continue
+		}
+		for c := 0; c < r.Copies; c++ {
+			if blocks[c*n+i] == nil {
+				blocks[c*n+i] = append([]byte(nil), found...)
+			}
+		}
+	}
+	return missingData(blocks[:n])
+}
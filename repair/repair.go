@@ -10,3 +10,9 @@ type Repairer interface {
 	RepairChunk(index int) ([]byte, error)
 	RepairAll()
 }
+
+// Releaser is implemented by repairers that keep the chunks they retrieve or repair.
+// Release tells the repairer that the chunk at the canonical index is no longer needed.
+type Releaser interface {
+	Release(index int)
+}
@@ -0,0 +1,204 @@
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/relab/snarl-mw21/utils"
+)
+
+// Distribution draws the durations of the sessions of a node.
+type Distribution interface {
+	// Sample returns the duration of a session that starts at the given time.
+	Sample(rnd *rand.Rand, at time.Duration) time.Duration
+}
+
+// Exponential draws durations from the exponential distribution with the given mean, as the
+// session times of peer-to-peer networks are often modelled.
+type Exponential struct {
+	Mean time.Duration
+}
+
+// Sample implements Distribution.
+func (d Exponential) Sample(rnd *rand.Rand, at time.Duration) time.Duration {
+	return time.Duration(rnd.ExpFloat64() * float64(d.Mean))
+}
+
+// Diurnal scales the durations of a distribution with a daily pattern. The durations of sessions
+// that start at the peak, a quarter Period after time zero, are 1+Amplitude times as long, and
+// those that start at the bottom 1-Amplitude times as long.
+type Diurnal struct {
+	Distribution
+	Period    time.Duration // 24 hours if zero
+	Amplitude float64       // Between 0 and 1
+}
+
+// Sample implements Distribution.
+func (d Diurnal) Sample(rnd *rand.Rand, at time.Duration) time.Duration {
+	period := d.Period
+	if period == 0 {
+		period = 24 * time.Hour
+	}
+	scale := 1 + d.Amplitude*math.Sin(2*math.Pi*float64(at%period)/float64(period))
+	return time.Duration(scale * float64(d.Distribution.Sample(rnd, at)))
+}
+
+// Churn makes the nodes of a network alternate between sessions where they are up and down.
+type Churn struct {
+	Session  Distribution // Time a node stays up
+	Downtime Distribution // Time a node stays down
+	Speed    float64      // Simulated time per real time, such that hours of churn can pass during a download. 1 if zero.
+}
+
+// churnState is the current session of a node.
+type churnState struct {
+	up   bool
+	next time.Duration // Start of the next session
+}
+
+// ChurnGetter serves the chunks of a placed Network, where the nodes go down and come back up
+// while the chunks are retrieved. A chunk is available if any node storing it is up, both in the
+// network and in its current session. Every node starts a session where it is up at time zero.
+type ChurnGetter struct {
+	// Clock returns the simulated time since the getter was created. It may be replaced, for
+	// example to step through the time in tests.
+	Clock func() time.Duration
+
+	network    *Network
+	churn      Churn
+	rnd        *rand.Rand
+	dataMap    map[string]*swarmconnector.TreeChunk
+	parityMap  map[string]parityChunk
+	parityRoot []*swarmconnector.TreeChunk
+
+	lock   sync.Mutex
+	states []churnState
+}
+
+// parityChunk is a chunk of the parity tree of the given class.
+type parityChunk struct {
+	class int
+	tc    *swarmconnector.TreeChunk
+}
+
+// NewChurnGetter returns a getter of the scenario placed on the network, with the churn drawn
+// from rnd.
+func NewChurnGetter(n *Network, churn Churn, rnd *rand.Rand) *ChurnGetter {
+	g := &ChurnGetter{
+		network:    n,
+		churn:      churn,
+		rnd:        rnd,
+		dataMap:    make(map[string]*swarmconnector.TreeChunk),
+		parityMap:  make(map[string]parityChunk),
+		parityRoot: n.sc.Roots[1:],
+		states:     make([]churnState, len(n.Nodes)),
+	}
+	speed := churn.Speed
+	if speed == 0 {
+		speed = 1
+	}
+	start := time.Now()
+	g.Clock = func() time.Duration {
+		return time.Duration(speed * float64(time.Since(start)))
+	}
+
+	n.sc.Roots[0].FilterChunks(func(tc *swarmconnector.TreeChunk) bool {
+		g.dataMap[fmt.Sprintf("%x", utils.RemoveDecryptionKeyFromChunkHash(tc.Key, chunk.AddressLength))] = tc
+		return false
+	})
+	for class, root := range g.parityRoot {
+		root.FilterChunks(func(tc *swarmconnector.TreeChunk) bool {
+			g.parityMap[fmt.Sprintf("%x", tc.Key)] = parityChunk{class, tc}
+			return false
+		})
+	}
+	for i := range g.states {
+		g.states[i] = churnState{up: true, next: churn.Session.Sample(rnd, 0)}
+	}
+	return g
+}
+
+// Up reports whether node i of the network is in a session where it is up at the given time.
+// The time must not go backwards between calls.
+func (g *ChurnGetter) Up(i int, at time.Duration) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.up(i, at)
+}
+
+func (g *ChurnGetter) up(i int, at time.Duration) bool {
+	state := &g.states[i]
+	for state.next <= at {
+		state.up = !state.up
+		dist := g.churn.Downtime
+		if state.up {
+			dist = g.churn.Session
+		}
+		d := dist.Sample(g.rnd, state.next)
+		if d <= 0 {
+			d = 1 // A session lasts at least a nanosecond, such that the loop ends.
+		}
+		state.next += d
+	}
+	return state.up && g.network.Nodes[i].Up
+}
+
+// available reports whether the chunk with the given chunk ID is stored by a node that is up.
+func (g *ChurnGetter) available(id int, at time.Duration) bool {
+	for _, i := range g.network.StoredBy(id) {
+		if g.up(i, at) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get retrieves the chunk at ref if it is available at the time of the call. Like
+// swarmconnector.MemoryGetter, a leaf of a parity tree is requested with the root address of the
+// tree and the leaf number in ctx, and it is unavailable if any chunk on its branch is.
+func (g *ChurnGetter) Get(ctx context.Context, ref storage.Reference) (storage.ChunkData, error) {
+	at := g.Clock()
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	sc := g.network.sc
+
+	for class, root := range g.parityRoot {
+		if !bytes.Equal(ref, root.Key) {
+			continue
+		}
+		if leaf, ok := ctx.Value(swarmconnector.Leafchunkid).(int); ok {
+			failed := make(map[int]Failure)
+			for index := 1; index <= sc.ParityRootIndex; index++ {
+				if !g.available(sc.DataRootIndex+class*sc.ParityRootIndex+index, at) {
+					failed[index] = Unavailable(index)
+				}
+			}
+			tc, err := root.GetChildFromMemWithFail(leaf, failed)
+			if err != nil {
+				return nil, err
+			}
+			return tc.Data, nil
+		}
+	}
+
+	strRef := fmt.Sprintf("%x", ref)
+	if pc, ok := g.parityMap[strRef]; ok {
+		if !g.available(sc.DataRootIndex+pc.class*sc.ParityRootIndex+pc.tc.Index, at) {
+			return nil, chunk.ErrChunkNotFound
+		}
+		return pc.tc.Data, nil
+	}
+	tc, ok := g.dataMap[strRef]
+	if !ok || !g.available(tc.Index, at) {
+		return nil, chunk.ErrChunkNotFound
+	}
+	return tc.StoredData(), nil
+}
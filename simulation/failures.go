@@ -0,0 +1,103 @@
+package simulation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/relab/snarl-mw21/utils"
+)
+
+// Failure is the failure of the chunk with the given canonical index.
+type Failure = swarmconnector.BlockFailure
+
+// Unavailable returns the failure of a chunk that can not be retrieved.
+func Unavailable(index int) Failure {
+	return NewFailure(index, 0, swarmconnector.Unavailable)
+}
+
+// Delayed returns the failure of a chunk that is retrieved after delay milliseconds.
+func Delayed(index, delay int) Failure {
+	return NewFailure(index, delay, swarmconnector.Delay)
+}
+
+// DelayedUnavailable returns the failure of a chunk that is reported unavailable after delay milliseconds.
+func DelayedUnavailable(index, delay int) Failure {
+	return NewFailure(index, delay, swarmconnector.Unavailable)
+}
+
+// Byzantine returns the failure of a chunk whose source consistently serves well-formed but wrong data.
+func Byzantine(index int) Failure {
+	return NewFailure(index, 0, swarmconnector.Byzantine)
+}
+
+// NewFailure returns a failure of the given class, with delay in milliseconds.
+func NewFailure(index, delay int, class swarmconnector.FailType) Failure {
+	return Failure{Index: index, Delay: time.Duration(delay) * time.Millisecond, Class: class}
+}
+
+// UnavailableList returns the failures of the unavailable chunks with the given indexes.
+func UnavailableList(indexes ...int) []Failure {
+	failList := make([]Failure, len(indexes))
+	for i := 0; i < len(indexes); i++ {
+		failList[i] = Unavailable(indexes[i])
+	}
+	return failList
+}
+
+// Periodic makes every inc'th chunk from start unavailable, as well as the chunk at end.
+func Periodic(start, end, inc int) []Failure {
+	ret := make([]Failure, 0)
+	i := start
+	for ; i <= end; i += inc {
+		ret = append(ret, Unavailable(utils.Min(i, end)))
+	}
+	if i-inc < end {
+		ret = append(ret, Unavailable(end))
+	}
+	return ret
+}
+
+// Consecutive makes the chunks from start to end unavailable.
+func Consecutive(start, end int) []Failure {
+	return Periodic(start, end, 1)
+}
+
+// GenerateFailStructures translates failures to the structures of swarmconnector.MemoryGetter.
+// The data failures are keyed by chunk address, and the parity failures by canonical index.
+func GenerateFailStructures(dataroot *swarmconnector.TreeChunk,
+	failures [][]Failure) (dataFails map[string]Failure, parityFails []map[int]Failure) {
+	dataFails = make(map[string]Failure)
+	numTypes := len(failures) - 1
+	tmpDataFails := make(map[int]Failure)
+	parityFails = make([]map[int]Failure, numTypes)
+
+	dataFailList := failures[numTypes]
+	for i := 0; i < len(dataFailList); i++ {
+		tmpDataFails[dataFailList[i].Index] = dataFailList[i]
+	}
+
+	for i := 0; i < numTypes; i++ {
+		fails := failures[i]
+		parityFails[i] = make(map[int]Failure)
+		parFails := parityFails[i]
+		for j := 0; j < len(fails); j++ {
+			parFails[fails[j].Index] = fails[j]
+		}
+	}
+
+	var walker func(*swarmconnector.TreeChunk)
+	walker = func(c *swarmconnector.TreeChunk) {
+		for j := range c.Children {
+			walker(c.Children[j])
+		}
+		if fail, ok := tmpDataFails[c.Index]; ok {
+			key := fmt.Sprintf("%x", utils.RemoveDecryptionKeyFromChunkHash(c.Key, chunk.AddressLength))
+			dataFails[key] = fail
+		}
+	}
+	walker(dataroot)
+
+	return
+}
@@ -0,0 +1,189 @@
+package simulation
+
+import (
+	"errors"
+	"math/bits"
+	"math/rand"
+	"sort"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/relab/snarl-mw21/utils"
+)
+
+// Node is a storage node of a simulated network.
+type Node struct {
+	Addr []byte // Overlay address
+	Up   bool
+}
+
+// Network is a simulated Swarm network, where every chunk is stored by the nodes closest to its
+// address, as in Kademlia. The nodes storing a chunk are its neighbourhood: every node whose
+// address shares at least Depth leading bits with the address of the chunk. If there are no
+// such nodes, the neighbourhood is the nodes sharing the most leading bits with it.
+//
+// Since data and parity chunks are placed by their addresses, chunks that land in the same
+// neighbourhood fail together when its nodes fail.
+type Network struct {
+	Nodes  []*Node
+	Depth  int
+	sc     *Scenario
+	chunks map[int][]int // Nodes storing the chunk, by chunk ID
+}
+
+// NewNetwork returns a network of size nodes with random overlay addresses, where every chunk is
+// stored by the nodes that share at least depth leading bits with its address.
+func NewNetwork(size, depth int, rnd *rand.Rand) *Network {
+	nodes := make([]*Node, size)
+	for i := range nodes {
+		addr := make([]byte, chunk.AddressLength)
+		rnd.Read(addr)
+		nodes[i] = &Node{Addr: addr, Up: true}
+	}
+	return &Network{Nodes: nodes, Depth: depth}
+}
+
+// Place stores the data chunks and the parity chunks of the scenario on the nodes closest to their
+// addresses. Every node is up afterwards.
+func (n *Network) Place(sc *Scenario) {
+	n.sc, n.chunks = sc, make(map[int][]int)
+	sc.Roots[0].FilterChunks(func(tc *swarmconnector.TreeChunk) bool {
+		n.chunks[tc.Index] = n.neighbourhood(utils.RemoveDecryptionKeyFromChunkHash(tc.Key, chunk.AddressLength))
+		return false
+	})
+	for class, root := range sc.Roots[1:] {
+		root.FilterChunks(func(tc *swarmconnector.TreeChunk) bool {
+			n.chunks[sc.DataRootIndex+class*sc.ParityRootIndex+tc.Index] = n.neighbourhood(tc.Key)
+			return false
+		})
+	}
+	n.Restore()
+}
+
+// neighbourhood returns the nodes storing a chunk at addr.
+func (n *Network) neighbourhood(addr []byte) []int {
+	depth, closest := n.Depth, 0
+	for _, node := range n.Nodes {
+		closest = utils.Max(closest, proximity(addr, node.Addr))
+	}
+	depth = utils.Min(depth, closest)
+	nodes := make([]int, 0)
+	for i, node := range n.Nodes {
+		if proximity(addr, node.Addr) >= depth {
+			nodes = append(nodes, i)
+		}
+	}
+	return nodes
+}
+
+// Replicas implements PlacementModel. It places the scenario, and returns the number of nodes
+// storing every chunk.
+func (n *Network) Replicas(sc *Scenario) map[int]int {
+	n.Place(sc)
+	replicas := make(map[int]int, len(n.chunks))
+	for id, nodes := range n.chunks {
+		replicas[id] = len(nodes)
+	}
+	return replicas
+}
+
+// StoredBy returns the indexes in Nodes of the nodes storing the chunk with the given chunk ID.
+func (n *Network) StoredBy(id int) []int {
+	return n.chunks[id]
+}
+
+// FailNode takes down the node with the given index in Nodes.
+func (n *Network) FailNode(i int) {
+	n.Nodes[i].Up = false
+}
+
+// FailNeighbourhood takes down every node whose address shares at least depth leading bits with
+// addr, and returns the number of nodes that went down.
+func (n *Network) FailNeighbourhood(addr []byte, depth int) int {
+	failed := 0
+	for _, node := range n.Nodes {
+		if node.Up && proximity(addr, node.Addr) >= depth {
+			node.Up = false
+			failed++
+		}
+	}
+	return failed
+}
+
+// Restore brings every node back up.
+func (n *Network) Restore() {
+	for _, node := range n.Nodes {
+		node.Up = true
+	}
+}
+
+// Failures returns the chunks of the placed scenario that are not stored by any node that is up.
+func (n *Network) Failures() [][]Failure {
+	failures := n.sc.NoFailures()
+	ids := make([]int, 0, len(n.chunks))
+	for id := range n.chunks {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		available := false
+		for _, i := range n.chunks[id] {
+			if n.Nodes[i].Up {
+				available = true
+				break
+			}
+		}
+		if !available {
+			n.sc.addChunkFailure(failures, id)
+		}
+	}
+	return failures
+}
+
+// Getter returns a getter that serves the chunks of the placed scenario that are stored by a node
+// that is up. It does not follow nodes that go down or up later.
+func (n *Network) Getter() *swarmconnector.MemoryGetter {
+	dataFails, parityFails := GenerateFailStructures(n.sc.Roots[0], n.Failures())
+	return swarmconnector.NewMemoryGetter(n.sc.Roots[0], n.sc.Roots[1:], dataFails, parityFails)
+}
+
+// proximity returns the number of leading bits that a and b have in common.
+func proximity(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if x := a[i] ^ b[i]; x != 0 {
+			return i*8 + bits.LeadingZeros8(x)
+		}
+	}
+	return 8 * utils.Min(len(a), len(b))
+}
+
+// NeighbourhoodFailure takes down nodes of a Network, which must also be the placement model of
+// the experiment. The replicas given to Failures are not used, as the network knows where every
+// chunk is stored.
+type NeighbourhoodFailure struct {
+	Network        *Network
+	Percent        int // Percentage of the nodes that fail at random
+	Neighbourhoods int // Number of neighbourhoods, around random addresses, where every node fails
+	Depth          int // Leading bits shared by the nodes of a failed neighbourhood
+}
+
+// Failures implements FailureModel.
+func (m NeighbourhoodFailure) Failures(sc *Scenario, replicas map[int]int, rnd *rand.Rand) ([][]Failure, error) {
+	if m.Percent < 0 || m.Percent > 100 {
+		return nil, errors.New("fail percentage must be between 0 and 100")
+	}
+	n := m.Network
+	if n.sc != sc {
+		n.Place(sc)
+	}
+	n.Restore()
+	for _, i := range rnd.Perm(len(n.Nodes))[:len(n.Nodes)*m.Percent/100] {
+		n.FailNode(i)
+	}
+	for i := 0; i < m.Neighbourhoods; i++ {
+		addr := make([]byte, chunk.AddressLength)
+		rnd.Read(addr)
+		n.FailNeighbourhood(addr, m.Depth)
+	}
+	return n.Failures(), nil
+}
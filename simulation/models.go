@@ -0,0 +1,394 @@
+package simulation
+
+import (
+	"errors"
+	"math/rand"
+
+	"github.com/relab/snarl-mw21/utils"
+)
+
+// PlacementModel decides how many replicas of every chunk are stored in the network.
+type PlacementModel interface {
+	// Replicas returns the number of replicas keyed by chunk ID.
+	Replicas(sc *Scenario) map[int]int
+}
+
+// FailureModel decides which chunks are lost.
+type FailureModel interface {
+	// Failures returns the unavailable chunks of every tree, given the replicas of every chunk.
+	Failures(sc *Scenario, replicas map[int]int, rnd *rand.Rand) ([][]Failure, error)
+}
+
+// UniformPlacement stores the same number of replicas of every chunk.
+type UniformPlacement struct {
+	Replication int
+}
+
+// Replicas implements PlacementModel.
+func (m UniformPlacement) Replicas(sc *Scenario) map[int]int {
+	chunks := make(map[int]int)
+	for i := 1; i <= sc.UniqueChunks(); i++ {
+		chunks[i] = m.Replication
+	}
+	return chunks
+}
+
+// ProportionalPlacement increases the replication of the parity tree nodes, as they are not
+// entangled. The total number of replicas is Replication times the number of data chunks.
+type ProportionalPlacement struct {
+	LeafReplication int // Minimum replicas of every leaf
+	Replication     int // Average replicas per data chunk
+	// RepFirstCol strengthens the first parities of every strand, if above 0. 1 is minimum strength,
+	// meaning the 5 first parity of each class is replicated equal to 1 tree node. S is maximum,
+	// meaning that the first parities are replicated equal to the tree nodes.
+	RepFirstCol int
+}
+
+// Replicas implements PlacementModel.
+func (m ProportionalPlacement) Replicas(sc *Scenario) map[int]int {
+	leafRep, propRep, repFirstCol := m.LeafReplication, m.Replication, m.RepFirstCol
+	if leafRep == 1 {
+		return m.prioritizeLeaves(sc)
+	}
+
+	parityTreeNodes, firstColNodes := 1+sc.Alpha*len(sc.ParityTreeNodes), sc.Alpha*sc.S
+	nodesWithMoreRep := parityTreeNodes
+	if repFirstCol > 0 {
+		nodesWithMoreRep += firstColNodes
+	}
+	// If the tree nodes can be saturated and every leaf gets its replication, the remaining
+	// replicas go to the leaves. Otherwise the leaves are prioritized.
+	nodesWithLeafRep := sc.UniqueChunks() - nodesWithMoreRep
+	chunks, numChunksToAssign := make(map[int]int), (propRep*sc.DataRootIndex)-(nodesWithLeafRep*(leafRep))
+	treeRep := leafRep * 15    // Heuristic
+	firstColRep := leafRep * 8 // Heuristic
+	numChunksToAssign -= (treeRep * parityTreeNodes) + (firstColRep * firstColNodes)
+
+	if numChunksToAssign < 0 {
+		return m.prioritizeLeaves(sc)
+	}
+	numChunksToAssign += nodesWithLeafRep // This should go to the leaves.
+
+	// Give every chunk the minimal replication.
+	for i := 1; i <= sc.UniqueChunks(); i++ {
+		chunks[i] = leafRep - 1
+	}
+
+	// Give the data root the tree replication
+	chunks[sc.DataRootIndex] = treeRep
+
+	// Give the calculated tree replication to Parity tree nodes
+	nonLeaves := map[int]struct{}{sc.DataRootIndex: {}}
+	for i := 0; i < sc.Alpha; i++ {
+		for index := range sc.ParityTreeNodes {
+			chunks[index+(i*sc.ParityRootIndex)+sc.DataRootIndex] = treeRep
+			nonLeaves[index+(i*sc.ParityRootIndex)+sc.DataRootIndex] = struct{}{}
+		}
+		if repFirstCol > 0 {
+			limit := sc.S
+			if i > 0 {
+				limit = sc.P
+			}
+			for j := 1; j <= limit; j++ {
+				chunks[j+(i*sc.ParityRootIndex)+sc.DataRootIndex] = firstColRep
+				nonLeaves[j+(i*sc.ParityRootIndex)+sc.DataRootIndex] = struct{}{}
+			}
+		}
+	}
+
+	// Check if we have space for some extra nodes, assign to leaves.
+	for numChunksToAssign > 0 {
+		for i := 1; i <= sc.UniqueChunks(); i++ {
+			if numChunksToAssign == 0 {
+				break
+			}
+			if _, ok := nonLeaves[i]; !ok {
+				// Is a leaf
+				chunks[i]++
+				numChunksToAssign--
+			}
+		}
+	}
+	return chunks
+}
+
+// prioritizeLeaves gives every leaf its replication, as opposed to ensure that internal nodes are
+// sufficiently saturated. The remaining replicas are shared by the tree nodes.
+func (m ProportionalPlacement) prioritizeLeaves(sc *Scenario) map[int]int {
+	leafRep, propRep, repFirstCol := m.LeafReplication, m.Replication, m.RepFirstCol
+	parityTreeNodes, firstColNodes := 1+sc.Alpha*len(sc.ParityTreeNodes), sc.Alpha*sc.S
+	nodesWithMoreRep, firstColRep := parityTreeNodes, 0
+	if repFirstCol > 0 {
+		nodesWithMoreRep += firstColNodes
+	}
+	chunks, numChunksToAssign := make(map[int]int), (propRep*sc.DataRootIndex)-((sc.UniqueChunks()-nodesWithMoreRep)*leafRep)
+	treeRep := int(float64(numChunksToAssign) / float64(parityTreeNodes+(sc.Alpha*utils.Min(sc.S, repFirstCol))))
+	numChunksToAssign = numChunksToAssign - (treeRep * parityTreeNodes)
+	if repFirstCol > 0 {
+		firstColRep = int(float64(numChunksToAssign) / float64(firstColNodes))
+		numChunksToAssign = numChunksToAssign - (firstColRep * firstColNodes)
+	}
+
+	// Give every chunk the minimal replication.
+	for i := 1; i <= sc.UniqueChunks(); i++ {
+		chunks[i] = leafRep
+	}
+
+	// Give the data root the tree replication
+	chunks[sc.DataRootIndex] = treeRep
+
+	// Give the calculated tree replication to Parity tree nodes
+	for i := 0; i < sc.Alpha; i++ {
+		for index := range sc.ParityTreeNodes {
+			chunks[index+(i*sc.ParityRootIndex)+sc.DataRootIndex] = treeRep
+		}
+		if repFirstCol > 0 {
+			limit := sc.S
+			if i > 0 {
+				limit = sc.P
+			}
+			for j := 1; j <= limit; j++ {
+				chunks[j+(i*sc.ParityRootIndex)+sc.DataRootIndex] = firstColRep
+			}
+		}
+	}
+
+	// Check if we have space for some extra nodes, and if so, assign them to the roots.
+	for numChunksToAssign > 0 {
+		for i := -1; i < sc.Alpha; i++ {
+			if numChunksToAssign == 0 {
+				break
+			}
+			if i == -1 { // Assign to data root.
+				chunks[sc.DataRootIndex]++
+				numChunksToAssign--
+				continue
+			}
+			for index, val := range sc.ParityTreeNodes {
+				if numChunksToAssign == 0 {
+					break
+				}
+				if val == sc.DataRootIndex { // Assign to parity root
+					chunks[index+(i*sc.ParityRootIndex)+sc.DataRootIndex]++
+					numChunksToAssign--
+				}
+			}
+		}
+	}
+	return chunks
+}
+
+// ChunkFailure loses the given percentage of all replicas, picked at random. A chunk is
+// unavailable when every replica of it is lost.
+type ChunkFailure struct {
+	Percent int
+}
+
+// Failures implements FailureModel.
+func (m ChunkFailure) Failures(sc *Scenario, replicas map[int]int, rnd *rand.Rand) ([][]Failure, error) {
+	if m.Percent < 0 || m.Percent > 100 {
+		return nil, errors.New("fail percentage must be between 0 and 100")
+	}
+	chunks := make(map[int]int, len(replicas))
+	for id, rep := range replicas {
+		chunks[id] = rep
+	}
+	failures := sc.NoFailures()
+	numUniqueChunks := len(chunks)
+	numFails := TotalReplicas(chunks) * m.Percent / 100
+
+	for i := 0; i < numFails; i++ {
+		for {
+			fail := rnd.Intn(numUniqueChunks) + 1
+			chunks[fail]--
+			if replication := chunks[fail]; replication != 0 {
+				if replication > 0 {
+					// If this chunk is replicated, it counts as a failure when we decrement its replication.
+					// For those who are already failed, the replication will be negative, thus we continue to generate another random chunk id.
+					break
+				}
+				continue
+			}
+			sc.addChunkFailure(failures, fail)
+			break
+		}
+	}
+	return failures, nil
+}
+
+// ByzantineFailure makes the given percentage of the chunks, picked at random, Byzantine: their
+// sources serve well-formed but wrong data. The replicas are not used, since every replica of a
+// chunk is assumed to come from the same source. Set Scenario.CrossCheck to detect them.
+type ByzantineFailure struct {
+	Percent int
+}
+
+// Failures implements FailureModel.
+func (m ByzantineFailure) Failures(sc *Scenario, replicas map[int]int, rnd *rand.Rand) ([][]Failure, error) {
+	if m.Percent < 0 || m.Percent > 100 {
+		return nil, errors.New("fail percentage must be between 0 and 100")
+	}
+	failures := sc.NoFailures()
+	ids := rnd.Perm(sc.UniqueChunks())
+	for _, id := range ids[:sc.UniqueChunks()*m.Percent/100] {
+		sc.addFailure(failures, id+1, Byzantine)
+	}
+	return failures, nil
+}
+
+// NodeFailure places the replicas of every chunk on different nodes, and loses the given
+// percentage of the nodes. Note that the number of lost replicas may vary, as nodes may store a
+// different number of chunks.
+type NodeFailure struct {
+	Percent         int
+	Nodes           int
+	RandomPlacement bool // Shuffle the replicas between the nodes, instead of placing them round-robin
+}
+
+// Failures implements FailureModel.
+func (m NodeFailure) Failures(sc *Scenario, replicas map[int]int, rnd *rand.Rand) ([][]Failure, error) {
+	if m.Percent < 0 || m.Percent > 100 {
+		return nil, errors.New("fail percentage must be between 0 and 100")
+	}
+	nodes := m.Nodes
+	failures := sc.NoFailures()
+	nodeToChunk := make(map[int][]int)
+	chunkToNode := make(map[int][]int)
+	numUniqueChunks := len(replicas)
+	totalChunks := 0
+
+	// Create empty slices
+	for i := 1; i <= nodes; i++ {
+		nodeToChunk[i] = make([]int, 0)
+	}
+	for i := 1; i <= numUniqueChunks; i++ {
+		chunkToNode[i] = make([]int, 0)
+	}
+
+	// Iterate through each unique chunk, and each replications of it.
+	currNode := 1
+	for i := 1; i <= numUniqueChunks; i++ {
+		startCurrNode := currNode
+		totalChunks += replicas[i]
+		// Iterate through the replications
+		for j := 0; j < replicas[i]; j++ {
+			// Check if this chunk is already assigned to the current node.
+			// If it's already assigned, we try the next node, until we exhausted all possibilities.
+			if !containsInt(nodeToChunk[currNode], i) {
+				nodeToChunk[currNode] = append(nodeToChunk[currNode], i)
+				chunkToNode[i] = append(chunkToNode[i], currNode)
+			} else {
+				j--
+			}
+			currNode = currNode%nodes + 1
+			if currNode == startCurrNode && len(chunkToNode[i]) < replicas[i] {
+				return nil, errors.New("unable to assign chunk, replication factor is higher than the number of nodes")
+			}
+		}
+	}
+
+	if m.RandomPlacement {
+		for i := 0; i < totalChunks*1000; i++ {
+			// Randomly select a chunk and a node that is storing that chunk
+			toSwapChunk := rnd.Intn(numUniqueChunks) + 1
+			if len(chunkToNode[toSwapChunk]) == 0 {
+				continue
+			}
+			toSwapNodeIndex := rnd.Intn(len(chunkToNode[toSwapChunk]))
+			toSwapNode := chunkToNode[toSwapChunk][toSwapNodeIndex]
+
+			// Select another node that is not storing the chunk.
+			for {
+				anotherNode := rnd.Intn(nodes) + 1
+				if anotherNode == toSwapNode || containsInt(nodeToChunk[anotherNode], toSwapChunk) {
+					continue
+				}
+
+				var anotherChunk, anotherChunkIndex int
+				var foundSwap bool
+
+				// Select a chunk that the first node is not storing
+				for j := 0; j < len(nodeToChunk[anotherNode])*3; j++ {
+					anotherChunkIndex = rnd.Intn(len(nodeToChunk[anotherNode]))
+					anotherChunk = nodeToChunk[anotherNode][anotherChunkIndex]
+					if !containsInt(nodeToChunk[toSwapNode], anotherChunk) {
+						foundSwap = true
+						break
+					}
+				}
+
+				if foundSwap {
+					var toSwapChunkIndex, anotherNodeIndex int
+					for j := 0; j < len(chunkToNode[anotherChunk]); j++ {
+						if chunkToNode[anotherChunk][j] == anotherNode {
+							anotherNodeIndex = j
+							break
+						}
+					}
+					for j := 0; j < len(nodeToChunk[toSwapNode]); j++ {
+						if nodeToChunk[toSwapNode][j] == toSwapChunk {
+							toSwapChunkIndex = j
+							break
+						}
+					}
+					chunkToNode[toSwapChunk][toSwapNodeIndex], chunkToNode[anotherChunk][anotherNodeIndex] = chunkToNode[anotherChunk][anotherNodeIndex], chunkToNode[toSwapChunk][toSwapNodeIndex]
+					nodeToChunk[toSwapNode][toSwapChunkIndex], nodeToChunk[anotherNode][anotherChunkIndex] = nodeToChunk[anotherNode][anotherChunkIndex], nodeToChunk[toSwapNode][toSwapChunkIndex]
+					break
+				}
+			}
+		}
+	}
+
+	numFails := nodes * m.Percent / 100
+	failed := make(map[int]bool)
+
+	// Iterate through the number of failed nodes
+	for i := 0; i < numFails; i++ {
+		fail := rnd.Intn(nodes) + 1
+		// If this node is already failed, choose a new one.
+		if failed[fail] {
+			i--
+			continue
+		}
+		failed[fail] = true
+		// Find all chunks this node is storing
+		for j := 0; j < len(nodeToChunk[fail]); j++ {
+			chunkId := nodeToChunk[fail][j]
+			// Find all nodes that is storing this chunk
+			for k := 0; k < len(chunkToNode[chunkId]); k++ {
+				// Iterate until we find the newly failed node
+				if chunkToNode[chunkId][k] == fail {
+					// If the newly failed node is the only one to store the chunk, the chunk will now be unavailable
+					if len(chunkToNode[chunkId]) == 1 {
+						chunkToNode[chunkId] = nil
+						sc.addChunkFailure(failures, chunkId)
+					} else {
+						chunkToNode[chunkId] = append(chunkToNode[chunkId][0:k], chunkToNode[chunkId][k+1:]...)
+					}
+					break // We can break out to the next chunk as the node will only store one replica of the chunk.
+				}
+			}
+		}
+		// The node is not storing any chunks as it is unavailable.
+		nodeToChunk[fail] = nil
+	}
+	return failures, nil
+}
+
+// TotalReplicas returns the sum of the replicas of every chunk.
+func TotalReplicas(chunks map[int]int) int {
+	total := 0
+	for _, rep := range chunks {
+		total += rep
+	}
+	return total
+}
+
+func containsInt(haystack []int, needle int) bool {
+	for _, val := range haystack {
+		if val == needle {
+			return true
+		}
+	}
+	return false
+}
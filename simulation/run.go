@@ -0,0 +1,195 @@
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/relab/snarl-mw21/utils"
+)
+
+// Result is the outcome of downloading the file of a scenario.
+type Result struct {
+	Run           int           `json:"run"`
+	FailedChunks  int           `json:"failedChunks"`  // Chunks without any available replica
+	Recovered     bool          `json:"recovered"`     // The whole file was downloaded and matched the original
+	MissingData   int           `json:"missingData"`   // Data blocks that were neither downloaded nor repaired
+	RepairedData  int           `json:"repairedData"`  // Data blocks that were repaired
+	ChunksFetched int64         `json:"chunksFetched"` // Chunks successfully retrieved from the getter
+	BytesFetched  int64         `json:"bytesFetched"`  // Bytes successfully retrieved from the getter
+	Latency       time.Duration `json:"latency"`       // Time to download and repair the file
+	Error         string        `json:"error,omitempty"`
+
+	CrossCheck *entangler.CrossCheckStats `json:"crossCheck,omitempty"` // Only if sc.CrossCheck is set
+}
+
+// Summary aggregates the results of an experiment.
+type Summary struct {
+	Runs             int           `json:"runs"`
+	RecoveryRate     float64       `json:"recoveryRate"`
+	MeanFailed       float64       `json:"meanFailed"`
+	MeanBytesFetched float64       `json:"meanBytesFetched"`
+	LatencyMin       time.Duration `json:"latencyMin"`
+	LatencyP50       time.Duration `json:"latencyP50"`
+	LatencyP90       time.Duration `json:"latencyP90"`
+	LatencyP99       time.Duration `json:"latencyP99"`
+	LatencyMax       time.Duration `json:"latencyMax"`
+}
+
+// countingGetter counts the chunks and bytes retrieved from a getter.
+type countingGetter struct {
+	chunks, bytes int64 // First in the struct, to be aligned for atomic access
+	storage.Getter
+}
+
+func (g *countingGetter) Get(ctx context.Context, ref storage.Reference) (storage.ChunkData, error) {
+	data, err := g.Getter.Get(ctx, ref)
+	if err == nil {
+		atomic.AddInt64(&g.chunks, 1)
+		atomic.AddInt64(&g.bytes, int64(len(data)))
+	}
+	return data, err
+}
+
+// Experiment draws new failures for the scenario runs times, and downloads the file each time.
+// The replicas of every chunk are given by placement, and the lost chunks by failures.
+func Experiment(sc *Scenario, placement PlacementModel, failures FailureModel, runs int, seed int64) ([]*Result, error) {
+	rnd := rand.New(rand.NewSource(seed))
+	replicas := placement.Replicas(sc)
+	results := make([]*Result, runs)
+	for i := 0; i < runs; i++ {
+		fails, err := failures.Failures(sc, replicas, rnd)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = Run(sc.WithFailures(fails, ""))
+		results[i].Run = i + 1
+	}
+	return results, nil
+}
+
+// Run downloads the file of the scenario from memory, where the chunks in sc.Failures fail, and
+// compares the result with the original.
+func Run(sc *Scenario) *Result {
+	dataFails, parityFails := GenerateFailStructures(sc.Roots[0], sc.Failures)
+	utils.LogPrint("Datafails: %v\nParityFails: %v\n", sc.Failures[sc.Alpha], parityFails)
+	return RunGetter(sc, swarmconnector.NewMemoryGetter(sc.Roots[0], sc.Roots[1:], dataFails, parityFails))
+}
+
+// RunGetter downloads the file of the scenario with getter, and compares the result with the
+// original. The failed chunks of the result are those in sc.Failures, whether getter uses them or not.
+func RunGetter(sc *Scenario, g storage.Getter) *Result {
+	result := &Result{}
+	for _, fails := range sc.Failures {
+		result.FailedChunks += len(fails)
+	}
+
+	dataTree := sc.Roots[0]
+	getter := &countingGetter{Getter: g}
+
+	start := time.Now()
+	chunker := swarmconnector.ChunkerOptions{Encrypted: sc.Encrypted, Pyramid: sc.Pyramid}
+	lattice, err := entangler.NewSwarmLatticeChunker(context.Background(), sc.Alpha, sc.S, sc.P, sc.Filesize, getter,
+		dataTree.Key, sc.ParityAddrs(), chunk.DefaultSize, chunker)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	lattice.CrossCheck = sc.CrossCheck
+
+	var downloadedTree *swarmconnector.TreeChunk
+	if utils.GLOBAL_RepairAll {
+		lattice.RepairAll()
+		err = fmt.Errorf("the tree is not downloaded when repairing all blocks")
+	} else {
+		downloadedTree, err = swarmconnector.BuildCompleteTree(context.Background(), getter,
+			dataTree.Key, swarmconnector.BuildTreeOptions{Pyramid: sc.Pyramid}, lattice)
+	}
+	result.Latency = time.Since(start)
+	result.ChunksFetched, result.BytesFetched = atomic.LoadInt64(&getter.chunks), atomic.LoadInt64(&getter.bytes)
+	if sc.CrossCheck {
+		stats := lattice.CrossCheckStats()
+		result.CrossCheck = &stats
+	}
+
+	parityblocks := 0
+	for i := 0; i < len(lattice.Blocks); i++ {
+		b := lattice.Blocks[i]
+		if b.IsParity {
+			if b.DownloadStatus == entangler.DownloadSuccess {
+				parityblocks++
+			}
+		} else if !b.HasData(true) {
+			result.MissingData++
+		} else if b.RepairStatus == entangler.RepairSuccess {
+			result.RepairedData++
+		}
+	}
+
+	if err == nil {
+		flatDownload := downloadedTree.FlattenTreeWindow(sc.S, sc.P)
+		flatOriginal := dataTree.FlattenTreeWindow(sc.S, sc.P)
+		if len(flatOriginal) != len(flatDownload) {
+			result.Error = "Length of original tree did not match downloaded tree. || "
+		}
+		for j := 0; j < utils.Min(len(flatOriginal), len(flatDownload)); j++ {
+			if !bytes.Equal(flatOriginal[j].Key, flatDownload[j].Key) {
+				result.Error += fmt.Sprintf("Keys did not match. Canonical position: %v || ", j+1)
+			}
+			if !bytes.Equal(flatOriginal[j].Data, flatDownload[j].Data) {
+				result.Error += fmt.Sprintf("Data did not match. Canonical position: %v || ", j+1)
+			}
+		}
+		result.Recovered = result.Error == ""
+	} else {
+		result.Error = err.Error()
+	}
+
+	var dlStatus string
+	if result.Recovered {
+		dlStatus = "Download complete."
+	} else if result.MissingData == 0 {
+		dlStatus = "Download complete (b)."
+	} else {
+		dlStatus = "Download FAILED."
+	}
+	utils.LogPrint("%v Datablocks: %d/%d, Parityblocks: %d/%d\n", dlStatus, lattice.NumDataBlocks-result.MissingData,
+		lattice.NumDataBlocks, parityblocks, len(lattice.Blocks)-lattice.NumDataBlocks)
+	utils.LogPrint("%d,%d\n", start.UnixNano(), start.Add(result.Latency).UnixNano())
+	return result
+}
+
+// Summarize aggregates the recovery rate, the fetched bytes and the latency distribution of results.
+func Summarize(results []*Result) *Summary {
+	s := &Summary{Runs: len(results)}
+	if len(results) == 0 {
+		return s
+	}
+	latencies := make([]time.Duration, len(results))
+	for i, r := range results {
+		if r.Recovered {
+			s.RecoveryRate++
+		}
+		s.MeanFailed += float64(r.FailedChunks)
+		s.MeanBytesFetched += float64(r.BytesFetched)
+		latencies[i] = r.Latency
+	}
+	n := float64(len(results))
+	s.RecoveryRate, s.MeanFailed, s.MeanBytesFetched = s.RecoveryRate/n, s.MeanFailed/n, s.MeanBytesFetched/n
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) time.Duration {
+		return latencies[int(p*float64(len(latencies)-1))]
+	}
+	s.LatencyMin, s.LatencyP50, s.LatencyP90 = latencies[0], percentile(0.5), percentile(0.9)
+	s.LatencyP99, s.LatencyMax = percentile(0.99), latencies[len(latencies)-1]
+	return s
+}
@@ -0,0 +1,308 @@
+// Package simulation runs failure experiments on entangled files held in memory.
+//
+// A Scenario entangles a file of random data. A PlacementModel decides how many replicas of every
+// chunk are stored, and a FailureModel decides which chunks are lost. Run downloads the file of a
+// scenario with its failures, and reports whether it could be recovered.
+package simulation
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/repair"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/relab/snarl-mw21/utils"
+)
+
+// Scenario is an entangled file of random data, together with the failures of a download.
+//
+// Chunks are identified in two ways. Within a tree, a chunk has its canonical index, as in
+// swarmconnector.TreeChunk. Across the trees, a chunk has a chunk ID: the data tree comes first
+// with IDs 1 to DataRootIndex, followed by the parity trees in class order.
+type Scenario struct {
+	Alpha            int
+	S                int
+	P                int
+	Filesize         uint64
+	DataRootIndex    int
+	ParityRootIndex  int
+	Description      string
+	Failures         [][]Failure // Failures of every parity tree in class order, followed by the failures of the data tree
+	Roots            []*swarmconnector.TreeChunk
+	TranslateFlatten map[int]int // Translates Canon index to Block position, i.e. 129 -> 176, 176 -> 129
+	LeafToCanonMap   map[int]int
+	ParityTreeNodes  map[int]int // Assumes that all parity trees will be equal. Key: Canon index, Value: Num Children
+	ShouldFail       bool
+	CrossCheck       bool // Cross-check the repairs of the download, see entangler.Lattice
+	Encrypted        bool
+	Pyramid          bool
+	data             []byte // Entangled instead of random data, see NewDataScenario
+}
+
+// NewScenario entangles size bytes of random data.
+func NewScenario(size uint64, alpha, s, p int) (*Scenario, error) {
+	sc := &Scenario{Filesize: size, Alpha: alpha, S: s, P: p}
+	return sc, sc.setupTrees()
+}
+
+// NewEncryptedScenario is the same as NewScenario, but the data is encrypted.
+func NewEncryptedScenario(size uint64, alpha, s, p int) (*Scenario, error) {
+	sc := &Scenario{Filesize: size, Alpha: alpha, S: s, P: p, Encrypted: true}
+	return sc, sc.setupTrees()
+}
+
+// NewPyramidScenario is the same as NewScenario, but the data is chunked with storage.PyramidSplit.
+func NewPyramidScenario(size uint64, alpha, s, p int) (*Scenario, error) {
+	sc := &Scenario{Filesize: size, Alpha: alpha, S: s, P: p, Pyramid: true}
+	return sc, sc.setupTrees()
+}
+
+// NewDataScenario is the same as NewScenario, but entangles the given data.
+func NewDataScenario(data []byte, alpha, s, p int) (*Scenario, error) {
+	sc := &Scenario{Filesize: uint64(len(data)), Alpha: alpha, S: s, P: p, data: data}
+	return sc, sc.setupTrees()
+}
+
+func (sc *Scenario) setupTrees() error {
+	tangler := entangler.NewEntangler(sc.P, sc.P, sc.S, sc.Alpha, chunk.DefaultSize)
+
+	// Setup temp directory
+	dir, err := ioutil.TempDir("", "test-entangler")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// 1. Create random data in memory
+	generate := utils.GenerateRandomData
+	if sc.Encrypted {
+		generate = utils.GenerateRandomEncryptedData
+	} else if sc.Pyramid {
+		generate = utils.GenerateRandomPyramidData
+	} else if sc.data != nil {
+		generate = func(size int, hasher, dir string) (storage.Address, *storage.LazyChunkReader, storage.Getter, error) {
+			return utils.StoreData(sc.data, hasher)
+		}
+	}
+	addr, reader, getter, err := generate(int(sc.Filesize), storage.DefaultHash, dir)
+	if err != nil {
+		return err
+	}
+
+	// 2. Build Merkle tree
+	treeRoot, err := swarmconnector.BuildCompleteTree(reader.Context(), getter,
+		storage.Reference(addr), swarmconnector.BuildTreeOptions{Pyramid: sc.Pyramid}, repair.NewMockRepair(getter))
+	if err != nil {
+		return err
+	}
+
+	// 3. Flatten tree
+	flatTree := treeRoot.FlattenTreeWindow(sc.S, sc.P)
+
+	resultChan := make(chan *entangler.EntangledBlock)
+	done := make(chan struct{})
+
+	// Setup for step 6. The local store of the parity trees must be closed before dir is removed.
+	sc.TranslateFlatten = make(map[int]int)
+	swarm := swarmconnector.NewSwarmConnector(dir, "testing", dir)
+	if swarm == nil {
+		return errors.New("could not create the local store of the parity trees")
+	}
+	defer swarm.LStore.Close()
+	files := make([]*os.File, sc.Alpha)
+	buffers := make([]*bufio.Writer, sc.Alpha)
+	entangledBlocks := make([]*entangler.EntangledBlock, 0)
+	for i := 0; i < sc.Alpha; i++ {
+		files[i], _ = os.Create(filepath.Join(dir, strconv.Itoa(i)))
+		buffers[i] = bufio.NewWriter(files[i])
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer close(resultChan)
+	ResultLoop:
+		for {
+			select {
+			case block := <-resultChan:
+				if block.LeftIndex < 1 {
+					continue
+				}
+				if block.Replace {
+					for i := 0; i < len(entangledBlocks); i++ {
+						if entangledBlocks[i].LeftIndex == block.LeftIndex &&
+							entangledBlocks[i].RightIndex == block.RightIndex {
+							entangledBlocks[i].Data = block.Data
+							entangledBlocks[i].Replace = true
+							break
+						}
+					}
+				} else {
+					entangledBlocks = append(entangledBlocks, block)
+				}
+			case <-done:
+				break ResultLoop
+			}
+		}
+		wg.Done()
+	}()
+
+	// 4. Entangle the tree
+	for i := 0; i < len(flatTree); i++ {
+		sc.TranslateFlatten[i+1] = flatTree[i].Index
+		tangler.Entangle(flatTree[i].StoredData()[swarmconnector.ChunkSizeOffset:], i+1, resultChan)
+	}
+
+	// 5. Wrap the lattice(s)
+	tangler.WrapLattice(resultChan)
+	done <- struct{}{}
+	wg.Wait()
+
+	// 6. Put the entangled data into files (One per alpha)
+	for i := 0; i < sc.Alpha; i++ {
+		ebSorted := make(map[int][]byte)
+		for k := 0; k < len(entangledBlocks); k++ {
+			if int(entangledBlocks[k].Class) != i {
+				continue
+			}
+			ebSorted[entangledBlocks[k].LeftIndex-1] = entangledBlocks[k].Data
+		}
+		for k := 0; k < len(entangledBlocks); k++ {
+			buffers[i].Write(ebSorted[k])
+		}
+		buffers[i].Flush()
+		files[i].Close()
+	}
+
+	// 7. Build Merkle Tree
+	entangledTrees := make([]*swarmconnector.TreeChunk, sc.Alpha)
+	for i := 0; i < sc.Alpha; i++ {
+		reader, err := os.Open(filepath.Join(dir, strconv.Itoa(i)))
+		if err != nil {
+			return err
+		}
+		fileState, _ := reader.Stat()
+
+		addr, wait, err := swarm.FileStore.Store(context.Background(), reader,
+			fileState.Size(), false)
+		if err == nil {
+			err = wait(context.Background())
+		}
+		reader.Close()
+		if err != nil {
+			return err
+		}
+		entangledTrees[i], err = swarmconnector.BuildCompleteTree(context.Background(), swarm.LStore, storage.Reference(addr),
+			swarmconnector.BuildTreeOptions{}, repair.NewMockRepair(swarm.LStore))
+		if err != nil {
+			return err
+		}
+	}
+
+	sc.AddRoots(append([]*swarmconnector.TreeChunk{treeRoot}, entangledTrees...))
+	return nil
+}
+
+// AddRoots sets the data tree and the parity trees of the scenario, and indexes the parity trees.
+func (sc *Scenario) AddRoots(roots []*swarmconnector.TreeChunk) {
+	sc.Roots = roots
+	sc.DataRootIndex = roots[0].Index
+	sc.ParityRootIndex = roots[1].Index
+	sc.LeafToCanonMap = make(map[int]int)
+	sc.ParityTreeNodes = make(map[int]int) // For one parity tree. Remember that you will have the same indices for each Alpha.
+	nextChild := 1
+	roots[1].FilterChunks(func(tc *swarmconnector.TreeChunk) bool {
+		if len(tc.Children) == 0 {
+			sc.LeafToCanonMap[nextChild] = tc.Index
+			nextChild++
+		} else {
+			sc.ParityTreeNodes[tc.Index] = int(tc.SubtreeSize / chunk.DefaultSize)
+		}
+		return false
+	})
+}
+
+// WithFailures sets the failures of the scenario. The description is only used if the scenario has none.
+func (sc *Scenario) WithFailures(failures [][]Failure, description string) *Scenario {
+	sc.Failures = failures
+	if sc.Description == "" {
+		sc.Description = description
+	}
+	return sc
+}
+
+// ParityAddrs returns the root addresses of the parity trees in class order.
+func (sc *Scenario) ParityAddrs() [][]byte {
+	addrs := make([][]byte, len(sc.Roots)-1)
+	for i, root := range sc.Roots[1:] {
+		addrs[i] = root.Key
+	}
+	return addrs
+}
+
+// UniqueChunks returns the number of chunks in the data tree and the parity trees.
+func (sc *Scenario) UniqueChunks() int {
+	return sc.DataRootIndex + sc.Alpha*sc.ParityRootIndex
+}
+
+// Canon translates the block.Position to which leaf it is in the Entangled Tree
+// Particularly useful for testing unavailble parities.
+func (sc *Scenario) Canon(fail Failure, leaves ...int) []Failure {
+	fails := make([]Failure, len(leaves))
+	for i := 0; i < len(leaves); i++ {
+		fails[i] = Failure{Index: sc.LeafToCanonMap[leaves[i]], Delay: fail.Delay, Class: fail.Class}
+	}
+	return fails
+}
+
+// LatticeIndex translates the block.Position to which node it is in the Merkle tree
+// I.e Merkle node 129 is translated to block.Position 176
+func (sc *Scenario) LatticeIndex(fail Failure, blocks ...int) []Failure {
+	fails := make([]Failure, len(blocks))
+	for i := 0; i < len(blocks); i++ {
+		fails[i] = Failure{Index: sc.TranslateFlatten[blocks[i]], Delay: fail.Delay, Class: fail.Class}
+	}
+	return fails
+}
+
+// TranslateLatticePosToMerklePos translates the block positions of the failures to canonical indexes in place.
+func (sc *Scenario) TranslateLatticePosToMerklePos(latticefails ...Failure) []Failure {
+	for i := 0; i < len(latticefails); i++ {
+		latticefails[i].Index = sc.TranslateFlatten[latticefails[i].Index]
+	}
+	return latticefails
+}
+
+// NoFailures returns an empty failure list for every tree of the scenario.
+func (sc *Scenario) NoFailures() [][]Failure {
+	failures := make([][]Failure, sc.Alpha+1)
+	for i := range failures {
+		failures[i] = []Failure{}
+	}
+	return failures
+}
+
+// addChunkFailure makes the chunk with the given chunk ID unavailable in failures.
+func (sc *Scenario) addChunkFailure(failures [][]Failure, id int) {
+	sc.addFailure(failures, id, Unavailable)
+}
+
+// addFailure adds the failure of the chunk with the given chunk ID to failures. fail returns the
+// failure of the canonical index of the chunk within its tree.
+func (sc *Scenario) addFailure(failures [][]Failure, id int, fail func(index int) Failure) {
+	if id <= sc.DataRootIndex {
+		failures[sc.Alpha] = append(failures[sc.Alpha], fail(id))
+		return
+	}
+	class := (id - sc.DataRootIndex - 1) / sc.ParityRootIndex
+	failures[class] = append(failures[class], fail(id-sc.DataRootIndex-class*sc.ParityRootIndex))
+}
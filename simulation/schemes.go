@@ -0,0 +1,83 @@
+package simulation
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/relab/snarl-mw21/redundancy"
+)
+
+// SchemeResult is the result of a file encoded with a redundancy scheme in one run.
+type SchemeResult struct {
+	Run         int    `json:"run"`
+	Scheme      string `json:"scheme"`
+	Blocks      int    `json:"blocks"`       // Data and redundancy blocks stored
+	Lost        int    `json:"lost"`         // Blocks on failed nodes
+	Recovered   bool   `json:"recovered"`    // Every data block was recovered
+	MissingData int    `json:"missing_data"` // Data blocks that could not be recovered
+}
+
+// CompareSchemes encodes a file of random data with every scheme, and places the blocks on random
+// nodes. Every run fails failPercent of the nodes, the same nodes for every scheme, and decodes the
+// blocks that are left. The results are ordered by run, then by scheme.
+func CompareSchemes(schemes []redundancy.Scheme, dataBlocks, blockSize, nodes, failPercent, runs int,
+	seed int64) ([]*SchemeResult, error) {
+	if nodes < 1 || dataBlocks < 1 {
+		return nil, errors.New("needs at least one node and one data block")
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	data := make([][]byte, dataBlocks)
+	for i := range data {
+		data[i] = make([]byte, blockSize)
+		rnd.Read(data[i])
+	}
+
+	encoded := make([][][]byte, len(schemes))
+	placement := make([][]int, len(schemes))
+	for i, scheme := range schemes {
+		redundant, err := scheme.Encode(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", scheme.Name(), err)
+		}
+		encoded[i] = append(append([][]byte(nil), data...), redundant...)
+		placement[i] = make([]int, len(encoded[i]))
+		for b := range placement[i] {
+			placement[i][b] = rnd.Intn(nodes)
+		}
+	}
+
+	results := make([]*SchemeResult, 0, runs*len(schemes))
+	for run := 1; run <= runs; run++ {
+		failed := make(map[int]bool)
+		for _, node := range rnd.Perm(nodes)[:nodes*failPercent/100] {
+			failed[node] = true
+		}
+		for i, scheme := range schemes {
+			res := &SchemeResult{Run: run, Scheme: scheme.Name(), Blocks: len(encoded[i])}
+			blocks := make([][]byte, len(encoded[i]))
+			for b, node := range placement[i] {
+				if failed[node] {
+					res.Lost++
+				} else {
+					blocks[b] = encoded[i][b]
+				}
+			}
+			err := scheme.Decode(blocks, dataBlocks)
+			if err != nil && !errors.Is(err, redundancy.ErrUnrecoverable) {
+				return nil, fmt.Errorf("%s: %v", scheme.Name(), err)
+			}
+			for b := 0; b < dataBlocks; b++ {
+				if blocks[b] == nil {
+					res.MissingData++
+				} else if !bytes.Equal(blocks[b], data[b]) {
+					return nil, fmt.Errorf("%s: data block %d decoded wrong", scheme.Name(), b)
+				}
+			}
+			res.Recovered = res.MissingData == 0
+			results = append(results, res)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,212 @@
+package simulation
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/relab/snarl-mw21/redundancy"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestScenario(t *testing.T) *Scenario {
+	sc, err := NewScenario(128*chunk.DefaultSize, 3, 5, 5)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return sc
+}
+
+func TestRun(t *testing.T) {
+	sc := newTestScenario(t)
+
+	result := Run(sc.WithFailures(sc.NoFailures(), "NoFailure"))
+	assert.True(t, result.Recovered, result.Error)
+	assert.Zero(t, result.RepairedData)
+	assert.Greater(t, result.BytesFetched, int64(0))
+
+	failures := sc.NoFailures()
+	failures[sc.Alpha] = UnavailableList(5, 6)
+	failures[1] = sc.Canon(Unavailable(0), 3)
+	result = Run(sc.WithFailures(failures, "DataFailure"))
+	assert.True(t, result.Recovered, result.Error)
+	assert.Equal(t, 3, result.FailedChunks)
+	assert.Equal(t, 2, result.RepairedData)
+}
+
+func TestPlacement(t *testing.T) {
+	sc := newTestScenario(t)
+
+	replicas := UniformPlacement{Replication: 2}.Replicas(sc)
+	assert.Len(t, replicas, sc.UniqueChunks())
+	assert.Equal(t, 2*sc.UniqueChunks(), TotalReplicas(replicas))
+
+	replicas = ProportionalPlacement{LeafReplication: 1, Replication: 8}.Replicas(sc)
+	assert.Len(t, replicas, sc.UniqueChunks())
+	assert.Equal(t, 1, replicas[1], "Leaves should have the minimum replication.")
+	assert.Greater(t, replicas[sc.DataRootIndex], 1, "The data root should have more replicas than the leaves.")
+}
+
+func TestFailureModels(t *testing.T) {
+	sc := newTestScenario(t)
+	replicas := UniformPlacement{Replication: 1}.Replicas(sc)
+
+	failures, err := ChunkFailure{Percent: 10}.Failures(sc, replicas, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	total := 0
+	for _, fails := range failures {
+		total += len(fails)
+	}
+	assert.Equal(t, sc.UniqueChunks()*10/100, total, "Wrong number of failed chunks.")
+	assert.Equal(t, sc.UniqueChunks(), TotalReplicas(replicas), "The replicas should not be modified.")
+
+	failures, err = ByzantineFailure{Percent: 10}.Failures(sc, replicas, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	total = 0
+	for _, fails := range failures {
+		for _, fail := range fails {
+			assert.Equal(t, Byzantine(fail.Index), fail)
+		}
+		total += len(fails)
+	}
+	assert.Equal(t, sc.UniqueChunks()*10/100, total, "Wrong number of Byzantine chunks.")
+
+	_, err = NodeFailure{Percent: 10, Nodes: 1}.Failures(sc, UniformPlacement{Replication: 2}.Replicas(sc), rand.New(rand.NewSource(1)))
+	assert.Error(t, err, "Two replicas can not be placed on one node.")
+
+	failures, err = NodeFailure{Percent: 100, Nodes: 10}.Failures(sc, replicas, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.Len(t, failures[sc.Alpha], sc.DataRootIndex, "Every data chunk should fail when every node fails.")
+}
+
+func TestNetwork(t *testing.T) {
+	sc := newTestScenario(t)
+	n := NewNetwork(64, 3, rand.New(rand.NewSource(1)))
+
+	replicas := n.Replicas(sc)
+	assert.Len(t, replicas, sc.UniqueChunks())
+	for id, rep := range replicas {
+		assert.Greater(t, rep, 0, "Chunk %d is not stored by any node.", id)
+	}
+	for _, fails := range n.Failures() {
+		assert.Empty(t, fails)
+	}
+
+	root := sc.Roots[0].Key
+	getter := n.Getter()
+	_, err := getter.Get(context.Background(), root)
+	assert.NoError(t, err)
+
+	for _, i := range n.StoredBy(sc.DataRootIndex) {
+		n.FailNode(i)
+	}
+	assert.Contains(t, n.Failures()[sc.Alpha], Unavailable(sc.DataRootIndex))
+	_, err = n.Getter().Get(context.Background(), root)
+	assert.Error(t, err, "The data root should be unavailable when its neighbourhood is down.")
+
+	n.Restore()
+	assert.Equal(t, len(n.Nodes), n.FailNeighbourhood(root, 0))
+	assert.Len(t, n.Failures()[sc.Alpha], sc.DataRootIndex, "Every data chunk should fail when every node fails.")
+
+	results, err := Experiment(sc, n, NeighbourhoodFailure{Network: n}, 1, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.True(t, results[0].Recovered, results[0].Error)
+	assert.Zero(t, results[0].FailedChunks)
+}
+
+// fixed is a distribution of durations that are always the same.
+type fixed time.Duration
+
+func (d fixed) Sample(*rand.Rand, time.Duration) time.Duration { return time.Duration(d) }
+
+func TestChurnGetter(t *testing.T) {
+	sc := newTestScenario(t)
+	n := NewNetwork(64, 3, rand.New(rand.NewSource(1)))
+	n.Place(sc)
+
+	churn := Churn{Session: fixed(time.Hour), Downtime: Exponential{Mean: 1000 * time.Hour}}
+	g := NewChurnGetter(n, churn, rand.New(rand.NewSource(1)))
+	var now time.Duration
+	g.Clock = func() time.Duration { return now }
+
+	result := RunGetter(sc.WithFailures(sc.NoFailures(), "NoChurn"), g)
+	assert.True(t, result.Recovered, result.Error)
+
+	root := sc.Roots[0].Key
+	now = 2 * time.Hour
+	_, err := g.Get(context.Background(), root)
+	assert.Error(t, err, "Every node should be down after its first session.")
+	result = RunGetter(sc, g)
+	assert.False(t, result.Recovered)
+	for i := range n.Nodes {
+		assert.False(t, g.Up(i, now))
+	}
+
+	d := Diurnal{Distribution: fixed(time.Hour), Amplitude: 0.5}
+	assert.Equal(t, time.Hour, d.Sample(nil, 0))
+	assert.Equal(t, 90*time.Minute, d.Sample(nil, 6*time.Hour))
+	assert.Equal(t, 30*time.Minute, d.Sample(nil, 18*time.Hour))
+}
+
+func TestExperiment(t *testing.T) {
+	sc := newTestScenario(t)
+	placement, failures := UniformPlacement{Replication: 1}, ChunkFailure{Percent: 10}
+
+	first, err := Experiment(sc, placement, failures, 2, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	second, err := Experiment(sc, placement, failures, 2, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for i := range first {
+		assert.Equal(t, i+1, first[i].Run)
+		assert.Equal(t, first[i].FailedChunks, second[i].FailedChunks, "The same seed should give the same failures.")
+	}
+
+	s := Summarize(first)
+	assert.Equal(t, 2, s.Runs)
+	assert.True(t, s.LatencyMin <= s.LatencyP50 && s.LatencyP50 <= s.LatencyMax)
+}
+
+func TestCompareSchemes(t *testing.T) {
+	schemes := []redundancy.Scheme{
+		redundancy.Entanglement{Alpha: 3, S: 5, P: 5},
+		redundancy.ReedSolomon{K: 10, M: 4},
+		redundancy.Replication{Copies: 3},
+	}
+	results, err := CompareSchemes(schemes, 100, 64, 50, 10, 3, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.Len(t, results, 3*len(schemes))
+	for i, r := range results {
+		assert.Equal(t, i/len(schemes)+1, r.Run)
+		assert.Equal(t, schemes[i%len(schemes)].Name(), r.Scheme)
+		assert.Equal(t, r.Recovered, r.MissingData == 0)
+	}
+	assert.Equal(t, 400, results[0].Blocks)
+	assert.Equal(t, 140, results[1].Blocks)
+	assert.Equal(t, 300, results[2].Blocks)
+
+	// Without failures, nothing is lost.
+	results, err = CompareSchemes(schemes, 100, 64, 50, 0, 1, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, r := range results {
+		assert.Equal(t, 0, r.Lost)
+		assert.True(t, r.Recovered)
+	}
+}
@@ -0,0 +1,324 @@
+// Package snarl gives access to entangled Swarm content through the standard library interfaces.
+package snarl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/swarmconnector"
+)
+
+// DefaultName is the name of the default entry of a manifest, the entry with an empty path.
+// It makes http.FS serve the default entry for the directory.
+const DefaultName = "index.html"
+
+// FS is a read-only file system of the files of entangled Swarm collections. The files are
+// read on demand, and chunks that are not available are repaired through their lattices.
+// Manifests are not part of the file system.
+type FS struct {
+	ctx       context.Context
+	getter    storage.Getter
+	cacheSize int
+	root      *node
+}
+
+var (
+	_ fs.FS        = (*FS)(nil)
+	_ fs.ReadDirFS = (*FS)(nil)
+	_ fs.StatFS    = (*FS)(nil)
+)
+
+// node is a file or directory of the file system.
+type node struct {
+	name       string
+	file       *entangler.EntangledFile // Nil for directories
+	collection *entangler.Collection
+	children   map[string]*node
+}
+
+// New mounts the collection as a file system. The chunks are retrieved with getter, and every
+// open file keeps at most cacheSize decoded chunks.
+func New(ctx context.Context, getter storage.Getter, collection *entangler.Collection, cacheSize int) *FS {
+	fsys := &FS{ctx: ctx, getter: getter, cacheSize: cacheSize, root: newDir(".")}
+	fsys.root.add(collection)
+	return fsys
+}
+
+// Mount mounts the collection index at indexPath, as written by the entangle command. If indexPath
+// is a directory, every collection index in it is mounted in a directory named after the index
+// without its .json extension.
+func Mount(ctx context.Context, getter storage.Getter, indexPath string, cacheSize int) (*FS, error) {
+	names, collections, err := readCollections(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	if names == nil {
+		return New(ctx, getter, collections[0], cacheSize), nil
+	}
+	fsys := &FS{ctx: ctx, getter: getter, cacheSize: cacheSize, root: newDir(".")}
+	for i, name := range names {
+		dir := newDir(name)
+		dir.add(collections[i])
+		fsys.root.children[name] = dir
+	}
+	return fsys, nil
+}
+
+// ReadCollections reads the collection index at indexPath, or every collection index in it if
+// indexPath is a directory.
+func ReadCollections(indexPath string) ([]*entangler.Collection, error) {
+	_, collections, err := readCollections(indexPath)
+	return collections, err
+}
+
+// readCollections is the same as ReadCollections, but also returns the names of the indexes
+// without their .json extension if indexPath is a directory.
+func readCollections(indexPath string) ([]string, []*entangler.Collection, error) {
+	if fi, err := os.Stat(indexPath); err != nil {
+		return nil, nil, err
+	} else if !fi.IsDir() {
+		collection, err := entangler.ReadCollection(indexPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, []*entangler.Collection{collection}, nil
+	}
+	info, err := ioutil.ReadDir(indexPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	names := make([]string, 0)
+	var collections []*entangler.Collection
+	for _, fi := range info {
+		if fi.IsDir() || filepath.Ext(fi.Name()) != ".json" {
+			continue
+		}
+		collection, err := entangler.ReadCollection(filepath.Join(indexPath, fi.Name()))
+		if err != nil {
+			return nil, nil, err
+		}
+		names = append(names, strings.TrimSuffix(fi.Name(), ".json"))
+		collections = append(collections, collection)
+	}
+	return names, collections, nil
+}
+
+func newDir(name string) *node {
+	return &node{name: name, children: make(map[string]*node)}
+}
+
+// add adds the files of the collection below n, creating the directories of their paths.
+func (n *node) add(collection *entangler.Collection) {
+	var defaults []*entangler.EntangledFile
+	for _, file := range collection.Files {
+		if file.IsManifest() {
+			continue
+		}
+		if file.Path == "" || strings.HasSuffix(file.Path, "/") {
+			defaults = append(defaults, file)
+			continue
+		}
+		n.addFile(collection, file, file.Path)
+	}
+	// Default entries do not replace a file with the same name.
+	for _, file := range defaults {
+		if _, err := n.lookup(cleanPath(file.Path + DefaultName)); err != nil {
+			n.addFile(collection, file, file.Path+DefaultName)
+		}
+	}
+}
+
+func (n *node) addFile(collection *entangler.Collection, file *entangler.EntangledFile, name string) {
+	parts := strings.Split(cleanPath(name), "/")
+	dir := n
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := dir.children[part]
+		if !ok || child.file != nil {
+			child = newDir(part)
+			dir.children[part] = child
+		}
+		dir = child
+	}
+	base := parts[len(parts)-1]
+	dir.children[base] = &node{name: base, file: file, collection: collection}
+}
+
+// cleanPath returns the manifest path as a path of the file system.
+func cleanPath(name string) string {
+	return path.Clean("/" + name)[1:]
+}
+
+// lookup returns the node at the slash-separated path name.
+func (n *node) lookup(name string) (*node, error) {
+	if name == "." {
+		return n, nil
+	}
+	cur := n
+	for _, part := range strings.Split(name, "/") {
+		child, ok := cur.children[part]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		cur = child
+	}
+	return cur, nil
+}
+
+func (fsys *FS) lookup(op, name string) (*node, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	n, err := fsys.root.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return n, nil
+}
+
+// Open opens the named file or directory. Files implement io.Seeker and io.ReaderAt as well.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	n, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if n.file == nil {
+		return &dir{node: n, entries: n.entries()}, nil
+	}
+	c := n.collection
+	chunker := n.file.Chunker()
+	lattice, err := entangler.NewSwarmLatticeConfig(fsys.ctx, n.file.Lattice(c.Lattice()), n.file.Size, fsys.getter,
+		n.file.DataRoot, n.file.ParityAddrs(), chunker)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	r, err := lattice.NewReader(fsys.cacheSize)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &file{node: n, LazyReader: r, lattice: lattice}, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	n, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if n.file != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return n.entries(), nil
+}
+
+// Stat returns the FileInfo of the named file without retrieving any chunks.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	n, err := fsys.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// entries returns the children of a directory sorted by name.
+func (n *node) entries() []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(n.children))
+	for _, child := range n.children {
+		entries = append(entries, child)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries
+}
+
+// node implements fs.FileInfo and fs.DirEntry.
+
+func (n *node) Name() string { return n.name }
+
+func (n *node) Size() int64 {
+	if n.file == nil {
+		return 0
+	}
+	return int64(n.file.Size)
+}
+
+func (n *node) Mode() fs.FileMode {
+	if n.file == nil {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (n *node) ModTime() time.Time { return time.Time{} }
+
+func (n *node) IsDir() bool { return n.file == nil }
+
+// Sys returns the entangled file, or nil for a directory.
+func (n *node) Sys() interface{} {
+	if n.file == nil {
+		return nil
+	}
+	return n.file
+}
+
+func (n *node) Type() fs.FileMode { return n.Mode().Type() }
+
+func (n *node) Info() (fs.FileInfo, error) { return n, nil }
+
+// file is an open file of the file system.
+type file struct {
+	node *node
+	*swarmconnector.LazyReader
+	lattice *entangler.Lattice
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.node, nil }
+
+// RepairedChunks returns the number of data chunks of the file that have been repaired
+// through its lattice since it was opened.
+func (f *file) RepairedChunks() int {
+	return f.lattice.RepairedDataBlocks()
+}
+
+func (f *file) Close() error { return nil }
+
+// dir is an open directory of the file system.
+type dir struct {
+	node    *node
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.node, nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.node.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error { return nil }
+
+// ReadDir implements fs.ReadDirFile.
+func (d *dir) ReadDir(count int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(rest) {
+		count = len(rest)
+	}
+	d.offset += count
+	return rest[:count], nil
+}
@@ -0,0 +1,128 @@
+package snarl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethersphere/swarm/api"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/entangler"
+	"github.com/relab/snarl-mw21/simulation"
+	"github.com/relab/snarl-mw21/swarmconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+// multiGetter retrieves chunks from the first getter that has them.
+type multiGetter []storage.Getter
+
+func (g multiGetter) Get(ctx context.Context, ref storage.Reference) (storage.ChunkData, error) {
+	for _, getter := range g {
+		if data, err := getter.Get(ctx, ref); err == nil {
+			return data, nil
+		}
+	}
+	return nil, chunk.ErrChunkNotFound
+}
+
+// testCollection entangles a file for every path, and fails the second leaf of every file.
+func testCollection(t *testing.T, paths ...string) (*entangler.Collection, multiGetter, map[string][]byte) {
+	collection := &entangler.Collection{Alpha: 3, S: 5, P: 5,
+		Files: []*entangler.EntangledFile{{ContentType: api.ManifestType}}}
+	var getter multiGetter
+	contents := make(map[string][]byte)
+	for i, path := range paths {
+		ts, err := simulation.NewScenario(uint64(64+i)*chunk.DefaultSize, collection.Alpha, collection.S, collection.P)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		failures := ts.NoFailures()
+		failures[ts.Alpha] = simulation.UnavailableList(2)
+		dataFails, parityFails := simulation.GenerateFailStructures(ts.Roots[0], failures)
+		getter = append(getter, swarmconnector.NewMemoryGetter(ts.Roots[0], ts.Roots[1:], dataFails, parityFails))
+
+		file := &entangler.EntangledFile{Path: path, Size: ts.Filesize, DataRoot: ts.Roots[0].Key}
+		for _, addr := range ts.ParityAddrs() {
+			file.ParityRoots = append(file.ParityRoots, hexutil.Bytes(addr))
+		}
+		collection.Files = append(collection.Files, file)
+
+		var data []byte
+		ts.Roots[0].FilterChunks(func(tc *swarmconnector.TreeChunk) bool {
+			if tc.SubtreeSize <= uint64(len(tc.Data)) {
+				data = append(data, tc.Data[swarmconnector.ChunkSizeOffset:]...)
+			}
+			return false
+		})
+		if path == "" {
+			path = DefaultName
+		}
+		contents[path] = data
+	}
+	return collection, getter, contents
+}
+
+func TestFS(t *testing.T) {
+	collection, getter, contents := testCollection(t, "", "a.txt", "dir/b.txt", "dir/sub/c.txt")
+	fsys := New(context.Background(), getter, collection, 16)
+
+	if err := fstest.TestFS(fsys, "index.html", "a.txt", "dir/b.txt", "dir/sub/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	for path, data := range contents {
+		read, err := fs.ReadFile(fsys, path)
+		assert.NoError(t, err)
+		assert.Equal(t, data, read, "The repaired file should match the original. Path: %s", path)
+	}
+
+	info, err := fs.Stat(fsys, "dir/b.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(contents["dir/b.txt"])), info.Size())
+	entries, err := fs.ReadDir(fsys, "dir")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "b.txt", entries[0].Name())
+	assert.True(t, entries[1].IsDir())
+
+	f, err := fsys.Open("a.txt")
+	assert.NoError(t, err)
+	_, err = f.(io.Seeker).Seek(10, io.SeekStart)
+	assert.NoError(t, err)
+	rest, err := ioutil.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, contents["a.txt"][10:], rest)
+	assert.NoError(t, f.Close())
+
+	_, err = fsys.Open("missing.txt")
+	assert.True(t, errors.Is(err, fs.ErrNotExist), "Missing files should not exist.")
+}
+
+func TestMount(t *testing.T) {
+	dir := t.TempDir()
+	first, firstGetter, _ := testCollection(t, "a.txt")
+	second, secondGetter, _ := testCollection(t, "b.txt")
+	assert.NoError(t, first.Write(filepath.Join(dir, "first.json")))
+	assert.NoError(t, second.Write(filepath.Join(dir, "second.json")))
+
+	fsys, err := Mount(context.Background(), append(firstGetter, secondGetter...), dir, 0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := fstest.TestFS(fsys, "first/a.txt", "second/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err = Mount(context.Background(), firstGetter, filepath.Join(dir, "first.json"), 0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err = fs.Stat(fsys, "a.txt")
+	assert.NoError(t, err)
+}
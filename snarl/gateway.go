@@ -0,0 +1,124 @@
+package snarl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/entangler"
+)
+
+// GatewayPrefix is the path below which a Gateway serves collections.
+const GatewayPrefix = "/snarl/"
+
+// RepairedChunksHeader is the trailer with the number of data chunks repaired to serve a file.
+// The chunks are repaired while the body is streamed, so the number is only known after it, and
+// it is not sent for responses without a body.
+const RepairedChunksHeader = "X-Snarl-Repaired-Chunks"
+
+// Gateway serves the files of entangled collections over HTTP at /snarl/<manifest>/<path>, and
+// repairs missing chunks through their lattices. It supports Range requests, and the ETag of a
+// file is the address of its content.
+type Gateway struct {
+	collections map[string]*FS // By manifest address in hex
+}
+
+// NewGateway returns a gateway of the collections. The chunks are retrieved with getter, and every
+// request keeps at most cacheSize decoded chunks.
+func NewGateway(ctx context.Context, getter storage.Getter, cacheSize int, collections ...*entangler.Collection) *Gateway {
+	g := &Gateway{collections: make(map[string]*FS)}
+	for _, c := range collections {
+		g.collections[fmt.Sprintf("%x", []byte(c.Manifest))] = New(ctx, getter, c, cacheSize)
+	}
+	return g
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, GatewayPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, GatewayPrefix), "/", 2)
+	fsys, ok := g.collections[strings.ToLower(strings.TrimPrefix(parts[0], "0x"))]
+	if !ok {
+		http.Error(w, "unknown manifest", http.StatusNotFound)
+		return
+	}
+	var name string
+	if len(parts) == 2 {
+		name = parts[1]
+	}
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += DefaultName
+	}
+	name = cleanPath(name)
+
+	f, err := fsys.Open(name)
+	if err == nil {
+		var info fs.FileInfo
+		if info, err = f.Stat(); err != nil {
+			f.Close()
+		} else if info.IsDir() {
+			f.Close()
+			f, err = fsys.Open(path.Join(name, DefaultName))
+		}
+	}
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+		return
+	}
+	defer f.Close()
+	sf, ok := f.(*file)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	etag := fmt.Sprintf("%q", fmt.Sprintf("%x", []byte(sf.node.file.DataRoot)))
+	w.Header().Set("ETag", etag)
+	if sf.node.file.ContentType != "" {
+		w.Header().Set("Content-Type", sf.node.file.ContentType)
+	}
+
+	if r.Method == http.MethodHead {
+		http.ServeContent(w, r, sf.node.name, time.Time{}, sf)
+		return
+	}
+	w.Header().Set("Trailer", RepairedChunksHeader)
+	http.ServeContent(&trailerWriter{ResponseWriter: w, chunked: r.ProtoMajor < 2}, r, sf.node.name, time.Time{}, sf)
+	w.Header().Set(RepairedChunksHeader, strconv.Itoa(sf.RepairedChunks()))
+}
+
+// trailerWriter makes the trailers of a response to a GET request reach the client. HTTP/1.x
+// only has trailers in a chunked body, so if chunked is set, the Content-Length of a body is
+// dropped. The trailers are not announced for a response without a body.
+type trailerWriter struct {
+	http.ResponseWriter
+	chunked bool
+}
+
+func (w *trailerWriter) WriteHeader(code int) {
+	if code == http.StatusOK || code == http.StatusPartialContent {
+		if w.chunked {
+			w.Header().Del("Content-Length")
+		}
+	} else {
+		w.Header().Del("Trailer")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
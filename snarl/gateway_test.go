@@ -0,0 +1,78 @@
+package snarl
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGateway(t *testing.T) {
+	collection, getter, contents := testCollection(t, "", "a.txt")
+	collection.Manifest = hexutil.Bytes{0xab, 0xcd}
+	server := httptest.NewServer(NewGateway(context.Background(), getter, 16, collection))
+	defer server.Close()
+
+	do := func(method, path string, header ...string) (*http.Response, []byte) {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return resp, body
+	}
+	get := func(path string, header ...string) (*http.Response, []byte) {
+		return do(http.MethodGet, path, header...)
+	}
+
+	resp, body := get("/snarl/abcd/a.txt")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, contents["a.txt"], body)
+	assert.Equal(t, "1", resp.Trailer.Get(RepairedChunksHeader), "The failed chunk should be repaired.")
+	etag := resp.Header.Get("ETag")
+	assert.Equal(t, fmt.Sprintf("%q", fmt.Sprintf("%x", []byte(collection.Files[2].DataRoot))), etag)
+
+	resp, body = get("/snarl/0xABCD/a.txt", "Range", "bytes=10-19")
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, contents["a.txt"][10:20], body)
+	assert.Equal(t, "0", resp.Trailer.Get(RepairedChunksHeader), "Chunks outside of the range should not be repaired.")
+
+	// A HEAD request does not read the content, and keeps the length of the body it would have.
+	resp, body = do(http.MethodHead, "/snarl/abcd/a.txt")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, body)
+	assert.Empty(t, resp.Header.Get(RepairedChunksHeader))
+	assert.Empty(t, resp.Header.Get("Trailer"))
+	assert.Equal(t, int64(len(contents["a.txt"])), resp.ContentLength)
+
+	resp, body = get("/snarl/abcd/a.txt", "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Empty(t, body)
+	assert.Empty(t, resp.Header.Get("Trailer"))
+	assert.Empty(t, resp.Trailer.Get(RepairedChunksHeader))
+
+	resp, body = get("/snarl/abcd/")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, contents[DefaultName], body)
+
+	resp, _ = get("/snarl/abcd/missing.txt")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = get("/snarl/ffff/a.txt")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -82,6 +82,34 @@ func hasSiblingsAtSameHeight(depth, maxDepth float64, numLeaves, prevDepthCounte
 type BuildTreeOptions struct {
 	EmptyLeaves bool
 	EagerRepair bool
+	Pyramid     bool            // Tree was built by storage.PyramidSplit
+	ChunkSize   int             // Bytes of data in a full chunk, chunk.DefaultSize if 0
+	shape       []ChunkMetadata // Canonical shape of a pyramid tree
+}
+
+// chunkSize returns the number of bytes of data in a full chunk of the tree.
+func (o BuildTreeOptions) chunkSize() uint64 {
+	if o.ChunkSize == 0 {
+		return chunk.DefaultSize
+	}
+	return uint64(o.ChunkSize)
+}
+
+// branches returns the branching factor of the tree with the given reference size.
+func (o BuildTreeOptions) branches(refSize int) uint64 {
+	return o.chunkSize() / uint64(refSize)
+}
+
+// payloadLength returns the length of the decrypted payload of the encrypted chunk with
+// the given canonical index and subtree size at level.
+func (o BuildTreeOptions) payloadLength(index, level int, size uint64) int {
+	if o.shape != nil {
+		if children := len(o.shape[index-1].Children); children > 0 {
+			return children * EncryptedRefSize
+		}
+		return int(size)
+	}
+	return GetChildLength(level, size, EncryptedRefSize)
 }
 
 // BuildCompleteTree reconstruct the Pyramid tree with a canonical naming on all
@@ -89,14 +117,39 @@ type BuildTreeOptions struct {
 // and helpful in the repair process.
 func BuildCompleteTree(ctx context.Context, getter storage.Getter, rootAddr storage.Reference,
 	options BuildTreeOptions, repairer repair.Repairer) (*TreeChunk, error) {
-	addr := utils.RemoveDecryptionKeyFromChunkHash(rootAddr, len(rootAddr))
+	tc, options, err := rootTreeChunk(ctx, getter, rootAddr, options, repairer)
+	if err != nil {
+		return nil, err
+	}
+	ctxWithCancel, cancel := context.WithCancel(ctx)
+	// Build Merkle tree by traversing child nodes recursively
+	err = tc.walkTreeChunk(ctxWithCancel, cancel, getter, 0, options, repairer)
+
+	return tc, err
+}
+
+// rootTreeChunk retrieves, or repairs, the root chunk of the tree at rootAddr. The returned
+// options carry the shape of the tree if it was built by storage.PyramidSplit.
+func rootTreeChunk(ctx context.Context, getter storage.Getter, rootAddr storage.Reference,
+	options BuildTreeOptions, repairer repair.Repairer) (*TreeChunk, BuildTreeOptions, error) {
+	if err := (ChunkerOptions{Encrypted: IsEncryptedRef(rootAddr), Pyramid: options.Pyramid,
+		ChunkSize: options.ChunkSize}).Validate(); err != nil {
+		return nil, options, err
+	}
+	addr := utils.RemoveDecryptionKeyFromChunkHash(rootAddr, chunk.AddressLength)
 
 	var rootChunk []byte
 	var rootIndex int = repairer.GetRootIndex()
 	var err error
+	indexFromSize := rootIndex == -1
 	if rootIndex == -1 {
 		rootChunk, err = getter.Get(ctx, addr)
-		rootIndex = GetTreeIndexChunkData(rootChunk)
+		if err == nil && IsEncryptedRef(rootAddr) {
+			rootChunk, err = decryptRootSpan(rootChunk, rootAddr)
+		}
+		if err == nil {
+			rootIndex = GetTreeIndexByChunkSize(RawChunkSize(rootChunk), options.chunkSize(), options.branches(len(rootAddr)))
+		}
 	} else {
 		rootChunk, err = repairer.GetChunk(addr, rootIndex)
 	}
@@ -104,17 +157,36 @@ func BuildCompleteTree(ctx context.Context, getter storage.Getter, rootAddr stor
 	if err != nil {
 		rootChunk, err = repairer.RepairChunk(rootIndex)
 		if err != nil {
-			return nil, err
+			return nil, options, err
 		}
 	}
 
-	depth := GetDepthCanonicalIndex(rootIndex)
-	tc := NewTreeChunk(depth, rootIndex, rootAddr, rootChunk, nil)
-	ctxWithCancel, cancel := context.WithCancel(ctx)
-	// Build Merkle tree by traversing child nodes recursively
-	err = tc.walkTreeChunk(ctxWithCancel, cancel, getter, 0, options, repairer)
+	if options.Pyramid {
+		// The canonical indexes of a pyramid tree follow the shape PyramidSplit gives a file of this size.
+		options.shape, err = GenerateTreeMetadata(RawChunkSize(rootChunk),
+			ChunkerOptions{Encrypted: IsEncryptedRef(rootAddr), Pyramid: true})
+		if err != nil {
+			return nil, options, err
+		}
+		if indexFromSize {
+			rootIndex = len(options.shape)
+		}
+	}
 
-	return tc, err
+	var tc *TreeChunk
+	if IsEncryptedRef(rootAddr) {
+		// The span of the root chunk is in plaintext at this point.
+		size := RawChunkSize(rootChunk)
+		level := treeLevel(size, chunk.DefaultSize, EncryptedChunkMaxBranch)
+		tc, err = newEncryptedTreeChunk(level+1, rootIndex, level, rootAddr, rootChunk, size,
+			options.payloadLength(rootIndex, level, size), nil)
+		if err != nil {
+			return nil, options, err
+		}
+	} else {
+		tc = NewTreeChunk(GetDepthCanonicalIndex(rootIndex), rootIndex, rootAddr, rootChunk, nil)
+	}
+	return tc, options, nil
 }
 
 // GetChildrenFromNet gets child chunks based on their canonical index.
@@ -204,16 +276,50 @@ func (tc *TreeChunk) getChildFromNet(index float64, requestChan chan storage.Ref
 }
 
 // childOffset returns the offset for the parent's child.
-func (tc *TreeChunk) childOffset() int {
+func (tc *TreeChunk) childOffset(options BuildTreeOptions) int {
 	if len(tc.Children) > 1 {
-		return GetChildOffsetByStandardSize(tc.SubtreeSize)
+		return GetChildOffsetByChunkSize(tc.SubtreeSize, options.chunkSize(), options.branches(len(tc.Key)))
 	}
 	// Have only one child; the size of parent and child is equal.
+	return tc.treeIndex(options)
+}
+
+// treeIndex returns the number of chunks in the subtree of tc.
+func (tc *TreeChunk) treeIndex(options BuildTreeOptions) int {
+	switch {
+	case tc.IsEncrypted():
+		return subtreeIndex(tc.level, tc.SubtreeSize, chunk.DefaultSize, EncryptedChunkMaxBranch)
+	case options.chunkSize() != chunk.DefaultSize:
+		return GetTreeIndexByChunkSize(tc.SubtreeSize, options.chunkSize(), options.branches(chunk.AddressLength))
+	}
 	return GetTreeIndexBySize(tc.SubtreeSize)
 }
 
+// newChild creates the TreeChunk for child number childNum of tc from the retrieved chunk data.
+func (tc *TreeChunk) newChild(childNum, index int, ref, data []byte, options BuildTreeOptions) (*TreeChunk, error) {
+	if !tc.IsEncrypted() {
+		return NewTreeChunk(tc.Depth-1, index, ref, data, tc), nil
+	}
+	// The span of an encrypted chunk is only readable with its key, and chunks repaired
+	// by the lattice carry the plaintext span. The size is therefore taken from the parent.
+	var size uint64
+	var level int
+	if options.shape != nil {
+		size = options.shape[index-1].Size
+		level = treeLevel(size, chunk.DefaultSize, EncryptedChunkMaxBranch)
+	} else {
+		size = tc.childSize(childNum)
+		level = subtreeLevel(tc.level, size, chunk.DefaultSize, EncryptedChunkMaxBranch)
+	}
+	return newEncryptedTreeChunk(tc.Depth-1, index, level, ref, data, size,
+		options.payloadLength(index, level, size), tc)
+}
+
 // childIndex returns the index for childNum.
-func (tc *TreeChunk) childIndex(lastChild bool, parentOffset int, offset int, childNum int) int {
+func (tc *TreeChunk) childIndex(lastChild bool, parentOffset int, offset int, childNum int, options BuildTreeOptions) int {
+	if options.shape != nil {
+		return options.shape[tc.Index-1].Children[childNum-1]
+	}
 	if lastChild {
 		return tc.Index - 1
 	}
@@ -230,6 +336,40 @@ func nextParentOffset(lastChild bool, hasChildren bool, lastOffset, childIndex,
 	return childIndex - offset + lastChildOffset
 }
 
+// retrieveChild retrieves child number childNum of tc, and repairs it if it is not available.
+// It also returns the parent offset of the child's own children.
+func (tc *TreeChunk) retrieveChild(childNum, parentOffset, offset int, options BuildTreeOptions,
+	repairer repair.Repairer) (*TreeChunk, int, error) {
+	lenKey := len(tc.Key)
+	childHashStart := ChunkSizeOffset + (childNum-1)*lenKey
+	childHashEnd := childHashStart + lenKey
+	// True if this will be the last child of tc
+	lastChild := len(tc.Data) == childHashEnd
+	childIndex := tc.childIndex(lastChild, parentOffset, offset, childNum, options)
+	childRef := tc.Data[childHashStart:childHashEnd]
+	childAddr := utils.RemoveDecryptionKeyFromChunkHash(childRef, chunk.AddressLength)
+
+	// Try to retrieve chunk normally
+	child, err := repairer.GetChunk(childAddr, childIndex)
+	if err != nil {
+		// Try to repair chunk since it was not directly available
+		child, err = repairer.RepairChunk(childIndex)
+	}
+	if err == nil && len(child) == 0 {
+		err = errors.New("empty child")
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	childChunk, err := tc.newChild(childNum, childIndex, childRef, child, options)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hasChildren := childChunk.SubtreeSize > uint64(len(childChunk.Data))
+	return childChunk, nextParentOffset(lastChild, hasChildren, childChunk.treeIndex(options), childIndex, offset), nil
+}
+
 // walkTreeChunk takes a tree chunk and walks down all its branches.
 // The function returns on the first error encountered (if any), not performing further processing.
 func (tc *TreeChunk) walkTreeChunk(ctx context.Context, cancel context.CancelFunc,
@@ -239,49 +379,32 @@ func (tc *TreeChunk) walkTreeChunk(ctx context.Context, cancel context.CancelFun
 		return nil
 	}
 
-	lenKey := len(tc.Key)
-
 	numChildren := len(tc.Children)
+	if options.shape != nil && len(options.shape[tc.Index-1].Children) != numChildren {
+		return errors.New("tree does not have the shape of a pyramid chunked file")
+	}
 
 	// Index offset for each child
-	offset := tc.childOffset()
+	offset := tc.childOffset(options)
 
 	// Goroutines processing child nodes send their results here
 	res := make(chan error, numChildren)
 
-	for i, j := ChunkSizeOffset, 1; j <= numChildren; i, j = i+lenKey, j+1 {
-		go func(childHashStart, childNum int) {
+	for j := 1; j <= numChildren; j++ {
+		go func(childNum int) {
 			// Error occurred or we are finished
 			if err := ctx.Err(); err != nil {
 				res <- err
 				return
 			}
 
-			childHashEnd := childHashStart + lenKey
-			// True if this will be the last child of tc
-			lastChild := len(tc.Data) == childHashEnd
-			childIndex := tc.childIndex(lastChild, parentOffset, offset, childNum)
-			childAddr := utils.RemoveDecryptionKeyFromChunkHash(tc.Data[childHashStart:childHashEnd], lenKey)
-
-			// Try to retrieve chunk normally
-			child, err := repairer.GetChunk(childAddr, childIndex)
-			if err != nil {
-				// Try to repair chunk since it was not directly available
-				child, err = repairer.RepairChunk(childIndex)
-			}
-			if err == nil && len(child) == 0 {
-				err = errors.New("empty child")
-			}
+			childChunk, nextParent, err := tc.retrieveChild(childNum, parentOffset, offset, options, repairer)
 			if err != nil {
 				cancel()
 				res <- err
 				return // Do not continue as we need the entire thing
 			}
-
-			hasChildren := RawChunkSize(child) > uint64(len(child))
-			nextParent := nextParentOffset(lastChild, hasChildren, GetTreeIndexChunkData(child), childIndex, offset)
-
-			childChunk := NewTreeChunk(tc.Depth-1, childIndex, childAddr, child, tc)
+			hasChildren := childChunk.SubtreeSize > uint64(len(childChunk.Data))
 
 			// Tree chunk
 			if hasChildren {
@@ -292,11 +415,12 @@ func (tc *TreeChunk) walkTreeChunk(ctx context.Context, cancel context.CancelFun
 			} else if options.EmptyLeaves {
 				// Do not put payload data into memory.
 				childChunk.Data = nil
+				childChunk.EncryptedData = nil
 			}
 
 			tc.Children[childNum-1] = childChunk
 			res <- nil
-		}(i, j)
+		}(j)
 	}
 
 	for i := 0; i < numChildren; i++ {
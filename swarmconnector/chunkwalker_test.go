@@ -3,6 +3,7 @@ package swarmconnector
 import (
 	"context"
 	"fmt"
+	"io"
 	"math"
 	"testing"
 
@@ -113,6 +114,36 @@ func TestGetTreeIndexBySize(t *testing.T) {
 	}
 }
 
+func TestGetTreeIndexBySizeBranches(t *testing.T) {
+	cd := uint64(chunk.DefaultSize)
+	sizes := []uint64{1, cd, cd + 1, 127 * cd, 128 * cd, 128*cd + 1, 257 * cd, 128 * 128 * cd,
+		128*128*cd + 1337, 128*128*cd + 129*cd, 5 * 128 * 128 * cd, 104857600, 1048576000}
+	for _, size := range sizes {
+		assert.Equal(t, GetTreeIndexBySize(size), GetTreeIndexBySizeBranches(size, ChunkMaxBranch), "Wrong index. Size: %d", size)
+		if size > cd {
+			assert.Equal(t, GetChildOffsetByStandardSize(size), GetChildOffsetBySizeBranches(size, ChunkMaxBranch), "Wrong offset. Size: %d", size)
+		}
+	}
+
+	encrypted := []struct {
+		size       uint64
+		canonIndex int
+	}{
+		{100, 1},
+		{cd, 1},
+		{cd + 1, 3},
+		{64 * cd, 65},
+		{65 * cd, 68},
+		{64*cd + 1, 67},
+		{256 * cd, 261},
+		{64 * 64 * cd, 4161},
+		{64*64*cd + 1, 4163},
+	}
+	for _, test := range encrypted {
+		assert.Equal(t, test.canonIndex, GetTreeIndexBySizeBranches(test.size, EncryptedChunkMaxBranch), "Wrong index. Size: %d", test.size)
+	}
+}
+
 func TestGetTreeIndex(t *testing.T) {
 	tests := []struct {
 		length     int
@@ -357,3 +388,79 @@ func TestGetChildFromNet(t *testing.T) {
 		assert.Equal(t, treeRoot.Index, test.canonIndex, "Got %d, Expected %d. Incorrect index for chunk with hash %v. Test number %d. Data: %v, Length: %d, Size: %d", treeRoot.Index, test.canonIndex, treeRoot.Key, testNum, treeRoot.Data, len(treeRoot.Data), treeRoot.SubtreeSize)
 	}
 }
+
+func TestBuildCompleteTreeEncrypted(t *testing.T) {
+	cd := chunk.DefaultSize
+	sizes := []int{100, cd, cd + 1, 64 * cd, 65 * cd, 256*cd + 10}
+	dir := t.TempDir()
+
+	for _, size := range sizes {
+		addr, reader, getter, err := utils.GenerateRandomEncryptedData(size, storage.DefaultHash, dir)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		treeRoot, err := BuildCompleteTree(reader.Context(), getter, storage.Reference(addr),
+			BuildTreeOptions{}, repair.NewMockRepair(getter))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		assert.Equal(t, GetTreeIndexBySizeBranches(uint64(size), EncryptedChunkMaxBranch), treeRoot.Index, "Wrong root index. Size: %d", size)
+		assert.Equal(t, uint64(size), treeRoot.SubtreeSize, "Wrong subtree size. Size: %d", size)
+
+		expected := make([]byte, size)
+		if _, err := reader.ReadAt(expected, 0); err != nil && err != io.EOF {
+			t.Fatal(err.Error())
+		}
+		leaves := treeRoot.FilterChunks(func(tc *TreeChunk) bool { return len(tc.Children) == 0 })
+		got := make([]byte, 0, size)
+		for _, leaf := range leaves {
+			assert.Equal(t, chunk.DefaultSize+ChunkSizeOffset, len(leaf.StoredData()), "Wrong stored length. Size: %d", size)
+			got = append(got, leaf.Data[ChunkSizeOffset:]...)
+		}
+		assert.Equal(t, expected, got, "Decrypted data does not match. Size: %d", size)
+	}
+}
+
+func TestBuildCompleteTreePyramid(t *testing.T) {
+	cd := chunk.DefaultSize
+	sizes := []int{100, cd, cd + 1, 128 * cd, 128*cd + 1, 129 * cd, 256*cd + 10}
+	dir := t.TempDir()
+
+	for _, size := range sizes {
+		addr, reader, getter, err := utils.GenerateRandomPyramidData(size, storage.DefaultHash, dir)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		chunker, err := DetectChunker(reader.Context(), getter, storage.Reference(addr))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		shape, err := GenerateTreeMetadata(uint64(size), chunker)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		treeRoot, err := BuildCompleteTree(reader.Context(), getter, storage.Reference(addr),
+			BuildTreeOptions{Pyramid: true}, repair.NewMockRepair(getter))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		assert.Equal(t, len(shape), treeRoot.Index, "Wrong root index. Size: %d", size)
+
+		// The canonical index is the position in post-order.
+		for i, tc := range treeRoot.FlattenTree() {
+			assert.Equal(t, i+1, tc.Index, "Wrong canonical index. Size: %d", size)
+		}
+
+		expected := make([]byte, size)
+		if _, err := reader.ReadAt(expected, 0); err != nil && err != io.EOF {
+			t.Fatal(err.Error())
+		}
+		leaves := treeRoot.FilterChunks(func(tc *TreeChunk) bool { return len(tc.Children) == 0 })
+		got := make([]byte, 0, size)
+		for _, leaf := range leaves {
+			got = append(got, leaf.Data[ChunkSizeOffset:]...)
+		}
+		assert.Equal(t, expected, got, "Data does not match. Size: %d", size)
+	}
+}
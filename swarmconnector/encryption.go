@@ -0,0 +1,118 @@
+package swarmconnector
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/encryption"
+	"github.com/relab/snarl-mw21/utils"
+	"golang.org/x/crypto/sha3"
+)
+
+// The span and payload of an encrypted chunk use separate counters, the same way
+// Swarm's hasherStore encrypts them. Encryption and decryption are the same transform.
+func newSpanEncryption(key []byte) encryption.Encryption {
+	return encryption.New(key, 0, uint32(chunk.DefaultSize/EncryptedRefSize), sha3.NewLegacyKeccak256)
+}
+
+func newDataEncryption(key []byte) encryption.Encryption {
+	return encryption.New(key, chunk.DefaultSize, 0, sha3.NewLegacyKeccak256)
+}
+
+// EncryptSpan encrypts the 8 byte span of a chunk with the key of its reference.
+func EncryptSpan(span, key []byte) ([]byte, error) {
+	if len(span) != ChunkSizeOffset {
+		return nil, errors.New("invalid span length")
+	}
+	return newSpanEncryption(key).Encrypt(span)
+}
+
+// DecryptSpan decrypts the 8 byte span of an encrypted chunk with the key of its reference.
+func DecryptSpan(span, key []byte) ([]byte, error) {
+	if len(span) != ChunkSizeOffset {
+		return nil, errors.New("invalid span length")
+	}
+	return newSpanEncryption(key).Decrypt(span)
+}
+
+// DecryptPayload decrypts the payload of an encrypted chunk and strips the padding,
+// leaving the first length bytes.
+func DecryptPayload(payload, key []byte, length int) ([]byte, error) {
+	if len(payload) != chunk.DefaultSize || length > len(payload) {
+		return nil, errors.New("invalid encrypted chunk length")
+	}
+	data, err := newDataEncryption(key).Decrypt(payload)
+	if err != nil {
+		return nil, err
+	}
+	return data[:length], nil
+}
+
+// decryptRootSpan returns a copy of the encrypted root chunk with its span in plaintext.
+func decryptRootSpan(data, ref []byte) ([]byte, error) {
+	if len(data) < ChunkSizeOffset {
+		return nil, errors.New("invalid encrypted chunk length")
+	}
+	span, err := DecryptSpan(data[:ChunkSizeOffset], ref[chunk.AddressLength:])
+	if err != nil {
+		return nil, err
+	}
+	return append(span, data[ChunkSizeOffset:]...), nil
+}
+
+// PlainLength returns the length of the payload of a decrypted chunk with size bytes in its
+// subtree. It follows storage.hasherStore, which does not need to know the level of the chunk.
+func PlainLength(size uint64, refSize int) int {
+	for size > chunk.DefaultSize {
+		size = (size + chunk.DefaultSize - 1) / chunk.DefaultSize * uint64(refSize)
+	}
+	return int(size)
+}
+
+// GetPlainChunk retrieves the chunk of ref and decrypts it if ref carries a decryption key.
+func GetPlainChunk(ctx context.Context, getter storage.Getter, ref []byte) ([]byte, error) {
+	data, err := getter.Get(ctx, utils.RemoveDecryptionKeyFromChunkHash(ref, chunk.AddressLength))
+	if err != nil || !IsEncryptedRef(ref) {
+		return data, err
+	}
+	data, err = decryptRootSpan(data, ref)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := DecryptPayload(data[ChunkSizeOffset:], ref[chunk.AddressLength:],
+		PlainLength(RawChunkSize(data), EncryptedRefSize))
+	if err != nil {
+		return nil, err
+	}
+	return append(data[:ChunkSizeOffset], payload...), nil
+}
+
+// newEncryptedTreeChunk creates a TreeChunk from an encrypted chunk, where size is the
+// plaintext size of its subtree. Data holds the decrypted chunk and EncryptedData the
+// chunk as stored in Swarm. The span of data is not used, so it may be either encrypted
+// or plaintext. length is the length of the decrypted payload.
+func newEncryptedTreeChunk(depth, index, level int, ref, data []byte, size uint64, length int, parent *TreeChunk) (*TreeChunk, error) {
+	if len(data) < ChunkSizeOffset {
+		return nil, errors.New("invalid encrypted chunk length")
+	}
+	key := ref[chunk.AddressLength:]
+	span := make([]byte, ChunkSizeOffset)
+	binary.LittleEndian.PutUint64(span, size)
+	encryptedSpan, err := EncryptSpan(span, key)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := DecryptPayload(data[ChunkSizeOffset:], key, length)
+	if err != nil {
+		return nil, err
+	}
+
+	tc := NewTreeChunk(depth, index, ref, append(span, payload...), parent)
+	tc.level = level
+	tc.Length = len(data)
+	tc.EncryptedData = append(encryptedSpan, data[ChunkSizeOffset:]...)
+	return tc, nil
+}
@@ -1,13 +1,17 @@
 package swarmconnector
 
 import (
-	"bytes"
+	"container/list"
 	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 	"math"
+	"sync"
 
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/storage"
-	"github.com/relab/snarl-mw21/repair"
 	"github.com/relab/snarl-mw21/utils"
 )
 
@@ -50,30 +54,143 @@ type ChunkMetadata struct {
 	Children []int
 }
 
+// ChunkerOptions describes how the Merkle tree of a file was built.
+type ChunkerOptions struct {
+	Encrypted bool `json:"encrypted,omitempty"` // References are 64 bytes and chunks are encrypted
+	Pyramid   bool `json:"pyramid,omitempty"`   // Tree was built by storage.PyramidSplit instead of storage.TreeSplit
+	ChunkSize int  `json:"chunkSize,omitempty"` // Bytes of data in a full chunk, chunk.DefaultSize if 0
+}
+
+// minChunkSize is the smallest chunk size a tree can have, see ChunkerOptions.Validate.
+const minChunkSize = 4 * chunk.AddressLength
+
+// PayloadSize returns the number of bytes of data in a full chunk.
+func (o ChunkerOptions) PayloadSize() int {
+	if o.ChunkSize == 0 {
+		return chunk.DefaultSize
+	}
+	return o.ChunkSize
+}
+
+// RefSize returns the length of the references in intermediate chunks.
+func (o ChunkerOptions) RefSize() int {
+	if o.Encrypted {
+		return EncryptedRefSize
+	}
+	return chunk.AddressLength
+}
+
+// Branches returns the branching factor of the tree.
+func (o ChunkerOptions) Branches() uint64 {
+	return uint64(o.PayloadSize() / o.RefSize())
+}
+
+// Validate reports whether a tree can be built with the options. Chunks can not hold more than
+// chunk.DefaultSize bytes, as that is all the BMT hash covers, and must hold enough references
+// that an intermediate chunk is always shorter than its span, which is how leaves are told apart.
+// Only storage.TreeSplit trees of unencrypted chunks can have another chunk size.
+func (o ChunkerOptions) Validate() error {
+	switch size := o.PayloadSize(); {
+	case size == chunk.DefaultSize:
+		return nil
+	case size > chunk.DefaultSize || size < minChunkSize || size%chunk.AddressLength != 0:
+		return fmt.Errorf("invalid chunk size %d: must be a multiple of %d between %d and %d",
+			size, chunk.AddressLength, minChunkSize, chunk.DefaultSize)
+	case o.Encrypted || o.Pyramid:
+		return fmt.Errorf("chunk size %d is only supported for unencrypted trees built by storage.TreeSplit", size)
+	}
+	return nil
+}
+
+// TreeOptions returns the options to build the tree of a file chunked with o.
+func (o ChunkerOptions) TreeOptions() BuildTreeOptions {
+	return BuildTreeOptions{Pyramid: o.Pyramid, ChunkSize: o.ChunkSize}
+}
+
 func GenerateChunkMetadata(size uint64) ([]ChunkMetadata, error) {
-	b := make([]byte, size)
-	data := bytes.NewReader(b)
+	return GenerateTreeMetadata(size, ChunkerOptions{})
+}
 
-	testtag := chunk.NewTag(0, "test-tag", 0, false)
+// shapeCacheSize is the number of tree shapes kept by GenerateTreeMetadata.
+const shapeCacheSize = 16
 
-	putGetter := storage.NewHasherStore(utils.NewMapChunkStore(),
-		storage.MakeHashFunc(storage.DefaultHash), false, testtag)
+// shapes keeps the most recently generated tree shapes. A download, probe or update of a file
+// needs the shape of its data and parity trees, and detecting the chunker needs two more.
+var shapes = &shapeCache{entries: make(map[shapeKey]*list.Element), order: list.New()}
 
-	ctx := context.Background()
+type shapeKey struct {
+	size    uint64
+	options ChunkerOptions
+}
 
-	rootAddr, wait, err := storage.TreeSplit(ctx, data, int64(size), putGetter)
-	err = wait(ctx)
-	if err != nil {
-		return nil, err
+type cachedShape struct {
+	key   shapeKey
+	shape []ChunkMetadata
+}
+
+// shapeCache keeps the metadata of the most recently used tree shapes by size and chunker.
+type shapeCache struct {
+	lock    sync.Mutex
+	entries map[shapeKey]*list.Element
+	order   *list.List // Most recently used first
+}
+
+func (c *shapeCache) get(key shapeKey) ([]ChunkMetadata, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
 	}
+	c.order.MoveToFront(e)
+	return e.Value.(*cachedShape).shape, true
+}
 
-	treeRoot, err := BuildCompleteTree(ctx, putGetter, storage.Reference(rootAddr),
-		BuildTreeOptions{EmptyLeaves: true}, repair.NewMockRepair(putGetter))
-	if err != nil {
+func (c *shapeCache) add(key shapeKey, shape []ChunkMetadata) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cachedShape{key: key, shape: shape})
+	if c.order.Len() > shapeCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedShape).key)
+	}
+}
+
+// GenerateTreeMetadata returns the metadata of every chunk in the tree of a file with
+// the given size, in canonical order. Length is the length of the chunk as stored.
+// The shape is calculated from the size, the way the chunker of the options splits a file.
+// The metadata is shared between callers, and must not be modified.
+func GenerateTreeMetadata(size uint64, options ChunkerOptions) ([]ChunkMetadata, error) {
+	if err := options.Validate(); err != nil {
 		return nil, err
 	}
+	key := shapeKey{size: size, options: options}
+	if shape, ok := shapes.get(key); ok {
+		return shape, nil
+	}
+	var shape []ChunkMetadata
+	if options.Pyramid {
+		shape = pyramidShape(size, uint64(options.PayloadSize()), options.Branches())
+	} else {
+		shape = treeShape(size, uint64(options.PayloadSize()), options.Branches())
+	}
+	if options.Encrypted {
+		// Encrypted chunks are padded to a full chunk.
+		for i := range shape {
+			shape[i].Length = chunk.DefaultSize + ChunkSizeOffset
+		}
+	}
+	shapes.add(key, shape)
+	return shape, nil
+}
 
-	sizeList := make([]ChunkMetadata, treeRoot.Index)
+// Metadata returns the metadata of every chunk in the tree below tc, in canonical order.
+func (tc *TreeChunk) Metadata() []ChunkMetadata {
+	sizeList := make([]ChunkMetadata, tc.Index)
 	var currIndex int = 0
 	var walker func(*TreeChunk)
 	walker = func(parent *TreeChunk) {
@@ -99,9 +216,289 @@ func GenerateChunkMetadata(size uint64) ([]ChunkMetadata, error) {
 		currIndex++
 	}
 
-	walker(treeRoot)
+	walker(tc)
+
+	return sizeList
+}
+
+// treeShape returns the metadata GenerateTreeMetadata gives an unencrypted file with size bytes,
+// split by storage.TreeSplit into chunks with chunkSize bytes of data. The shape is calculated
+// instead of chunking the file, so it can be given for any chunk size.
+func treeShape(size, chunkSize, branches uint64) []ChunkMetadata {
+	shape := make([]ChunkMetadata, 0, GetTreeIndexByChunkSize(size, chunkSize, branches))
+	var walker func(level int, size uint64) int
+	walker = func(level int, size uint64) int {
+		if level == 0 {
+			shape = append(shape, ChunkMetadata{Size: size, Length: ChunkSizeOffset + int(size), Children: []int{}})
+			return len(shape)
+		}
+		// Every child but the last spans a full subtree at the level below.
+		var children []int
+		childSize := levelSize(level-1, chunkSize, branches)
+		for offset := uint64(0); offset < size; offset += childSize {
+			rest := size - offset
+			if rest > childSize {
+				rest = childSize
+			}
+			children = append(children, walker(subtreeLevel(level, rest, chunkSize, branches), rest))
+		}
+		shape = append(shape, ChunkMetadata{Size: size,
+			Length: ChunkSizeOffset + len(children)*chunk.AddressLength, Children: children})
+		index := len(shape)
+		for _, child := range children {
+			shape[child-1].Parent = index
+		}
+		return index
+	}
+	walker(treeLevel(size, chunkSize, branches), size)
+	return shape
+}
+
+// pyramidShape returns the metadata GenerateTreeMetadata gives an unencrypted file with size
+// bytes, split by storage.PyramidSplit. It follows how the pyramid chunker adds full chunks
+// to the levels of the tree, and how it builds the rightmost path once the data ends.
+func pyramidShape(size, chunkSize, branches uint64) []ChunkMetadata {
+	type node struct {
+		size     uint64
+		children []*node
+	}
+	// levels[0] holds the chunks above the leaves, as storage.PyramidChunker.chunkLevel.
+	levels := make([][]*node, branches)
+	depth := func() (d int) {
+		for _, l := range levels {
+			if l == nil {
+				return
+			}
+			d++
+		}
+		return
+	}
+	cleanLevels := func() {
+		for i, l := range levels {
+			if l == nil {
+				levels = append(levels[:i], append(levels[i+1:], nil)...)
+			}
+		}
+	}
+	var root *node
+	buildTree := func(parent *node, last bool, lonely *node) {
+		if len(parent.children) > 0 {
+			levels[0] = append(levels[0], parent)
+		}
+		compress := false
+		endLvl := len(levels)
+		for lvl := range levels {
+			if uint64(len(levels[lvl])) >= branches {
+				endLvl = lvl + 1
+				compress = true
+				for uprLvl := endLvl; uprLvl < len(levels); uprLvl++ {
+					if uint64(len(levels[uprLvl])) >= branches-1 {
+						endLvl++
+					}
+				}
+				break
+			}
+		}
+		if !compress && !last {
+			return
+		}
+		for lvl := 0; lvl < endLvl; lvl++ {
+			count := len(levels[lvl])
+			if count == 1 && last {
+				root = levels[lvl][0]
+				return
+			}
+			for start := 0; start < count; start += int(branches) {
+				end := start + int(branches)
+				if end > count {
+					end = count
+				}
+				n := &node{children: append([]*node(nil), levels[lvl][start:end]...)}
+				for _, child := range n.children {
+					n.size += child.size
+				}
+				// A single leaf on the last branch replaces the chunk above it.
+				if lonely != nil {
+					n.children[len(n.children)-1] = lonely
+				}
+				levels[lvl+1] = append(levels[lvl+1], n)
+			}
+			if compress {
+				levels[lvl] = nil
+			}
+		}
+	}
+
+	parent := &node{}
+	for rest := size; ; {
+		read := chunkSize
+		if rest < read {
+			read = rest
+		}
+		rest -= read
+		if read == 0 {
+			cleanLevels()
+			if len(parent.children) == 1 && depth() == 0 {
+				root = parent.children[0]
+			} else {
+				buildTree(parent, true, nil)
+			}
+			break
+		}
+		leaf := &node{size: read}
+		parent.children = append(parent.children, leaf)
+		parent.size += read
+		if read < chunkSize {
+			cleanLevels()
+			if len(parent.children) > 1 {
+				buildTree(parent, true, nil)
+			} else if depth() == 0 {
+				root = leaf
+			} else {
+				buildTree(parent, true, leaf)
+			}
+			break
+		}
+		if uint64(len(parent.children)) == branches {
+			buildTree(parent, false, nil)
+			parent = &node{}
+		}
+	}
+
+	// Number the chunks in post-order, which is their canonical index.
+	var shape []ChunkMetadata
+	var walker func(n *node) int
+	walker = func(n *node) int {
+		children := make([]int, len(n.children))
+		for i, child := range n.children {
+			children[i] = walker(child)
+		}
+		length := ChunkSizeOffset + int(n.size)
+		if len(children) > 0 {
+			length = ChunkSizeOffset + len(children)*chunk.AddressLength
+		}
+		shape = append(shape, ChunkMetadata{Size: n.size, Length: length, Children: children})
+		index := len(shape)
+		for _, child := range children {
+			shape[child-1].Parent = index
+		}
+		return index
+	}
+	if root != nil {
+		walker(root)
+	}
+	return shape
+}
 
-	return sizeList, nil
+// DetectChunker reports how the tree below rootAddr was built. Only the rightmost path of
+// the tree differs between storage.TreeSplit and storage.PyramidSplit, so the chunks on that
+// path are compared with the shape each chunker gives a file of the same size.
+func DetectChunker(ctx context.Context, getter storage.Getter, rootAddr storage.Reference) (ChunkerOptions, error) {
+	options := ChunkerOptions{Encrypted: IsEncryptedRef(rootAddr)}
+	data, err := GetPlainChunk(ctx, getter, rootAddr)
+	if err != nil {
+		return options, err
+	}
+	size := RawChunkSize(data)
+	treeShape, err := GenerateTreeMetadata(size, options)
+	if err != nil {
+		return options, err
+	}
+	pyramidShape, err := GenerateTreeMetadata(size, ChunkerOptions{Encrypted: options.Encrypted, Pyramid: true})
+	if err != nil {
+		return options, err
+	}
+
+	ref := rootAddr
+	treeIndex, pyramidIndex := len(treeShape), len(pyramidShape)
+	for {
+		tm, pm := treeShape[treeIndex-1], pyramidShape[pyramidIndex-1]
+		numChildren := 0
+		if RawChunkSize(data) > uint64(len(data)) {
+			numChildren = (len(data) - ChunkSizeOffset) / len(ref)
+		}
+		treeMatch := tm.Size == RawChunkSize(data) && len(tm.Children) == numChildren
+		pyramidMatch := pm.Size == RawChunkSize(data) && len(pm.Children) == numChildren
+		switch {
+		case treeMatch && !pyramidMatch:
+			return options, nil
+		case pyramidMatch && !treeMatch:
+			options.Pyramid = true
+			return options, nil
+		case !treeMatch:
+			return options, errors.New("tree was not built by a known chunker")
+		case numChildren == 0:
+			// Both chunkers give the file the same shape.
+			return options, nil
+		}
+
+		start := ChunkSizeOffset + (numChildren-1)*len(ref)
+		ref = data[start : start+len(ref)]
+		if data, err = GetPlainChunk(ctx, getter, ref); err != nil {
+			return options, err
+		}
+		treeIndex, pyramidIndex = tm.Children[numChildren-1], pm.Children[numChildren-1]
+	}
+}
+
+// BuildTreeChunks returns every chunk of an unencrypted tree with the given shape, as given by
+// GenerateTreeMetadata, in canonical order. leaves holds the data of the leaves from left to right,
+// including the span.
+func BuildTreeChunks(shape []ChunkMetadata, leaves [][]byte) ([]chunk.Chunk, error) {
+	hasher := storage.MakeHashFunc(storage.DefaultHash)()
+	chunks := make([]chunk.Chunk, len(shape))
+	var leaf int
+	for i, meta := range shape {
+		var data []byte
+		if len(meta.Children) == 0 {
+			if leaf >= len(leaves) {
+				return nil, errors.New("too few leaves for the shape of the tree")
+			}
+			data = leaves[leaf]
+			leaf++
+		} else {
+			// Children come before their parent in canonical order.
+			data = make([]byte, ChunkSizeOffset, ChunkSizeOffset+len(meta.Children)*chunk.AddressLength)
+			binary.LittleEndian.PutUint64(data, meta.Size)
+			for _, child := range meta.Children {
+				data = append(data, chunks[child-1].Address()...)
+			}
+		}
+		addr, err := utils.GetAddrOfRawData(data, hasher)
+		if err != nil {
+			return nil, err
+		}
+		chunks[i] = chunk.NewChunk(addr, data)
+	}
+	if leaf != len(leaves) {
+		return nil, errors.New("too many leaves for the shape of the tree")
+	}
+	return chunks, nil
+}
+
+// SplitTree splits size bytes read from r into a tree of unencrypted chunks the way storage.TreeSplit
+// does, with the chunk size of options. It returns the chunks in canonical order, the root last.
+func SplitTree(r io.Reader, size uint64, options ChunkerOptions) ([]chunk.Chunk, error) {
+	if options.Encrypted || options.Pyramid {
+		return nil, errors.New("only unencrypted trees of storage.TreeSplit can be split")
+	}
+	shape, err := GenerateTreeMetadata(size, options)
+	if err != nil {
+		return nil, err
+	}
+	var leaves [][]byte
+	for _, meta := range shape {
+		if len(meta.Children) > 0 {
+			continue
+		}
+		leaf := make([]byte, ChunkSizeOffset+meta.Size)
+		binary.LittleEndian.PutUint64(leaf, meta.Size)
+		if _, err := io.ReadFull(r, leaf[ChunkSizeOffset:]); err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, leaf)
+	}
+	return BuildTreeChunks(shape, leaves)
 }
 
 // GetLeavesCanonIndex returns the number of leaves a regular tree has, based on the canonical index.
@@ -1,9 +1,18 @@
 package swarmconnector
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
 	"testing"
 
 	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/repair"
+	"github.com/relab/snarl-mw21/utils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -117,6 +126,125 @@ func TestGenerateChunkMetadataSizeLength(t *testing.T) {
 	}
 }
 
+func TestGenerateTreeMetadataEncrypted(t *testing.T) {
+	cd := uint64(chunk.DefaultSize)
+	tests := []struct {
+		maxIndex int
+		size     uint64
+	}{
+		{1, 100},
+		{3, cd + 1},
+		{65, 64 * cd},
+		{68, 65 * cd},
+		{261, 256 * cd},
+	}
+
+	for _, test := range tests {
+		sizeList, err := GenerateTreeMetadata(test.size, ChunkerOptions{Encrypted: true})
+		assert.Nil(t, err, "Error not nil. %v", err)
+		assert.Equal(t, test.maxIndex, len(sizeList), "Number of elements do not match.")
+		assert.Equal(t, test.size, sizeList[len(sizeList)-1].Size, "Wrong size of root.")
+		for i := 0; i < len(sizeList); i++ {
+			assert.Equal(t, chunk.DefaultSize+ChunkSizeOffset, sizeList[i].Length, "Encrypted chunks are padded. i: %v", i)
+		}
+	}
+}
+
+func TestGenerateTreeMetadataPyramid(t *testing.T) {
+	cd := uint64(chunk.DefaultSize)
+	sizes := []uint64{100, cd, cd + 1, 128 * cd, 128*cd + 1, 129 * cd, 256*cd + 10, 128*128*cd + cd}
+
+	for _, size := range sizes {
+		for _, encrypted := range []bool{false, true} {
+			sizeList, err := GenerateTreeMetadata(size, ChunkerOptions{Encrypted: encrypted, Pyramid: true})
+			assert.Nil(t, err, "Error not nil. %v", err)
+			root := sizeList[len(sizeList)-1]
+			assert.Equal(t, size, root.Size, "Wrong size of root. Size: %d", size)
+			assert.Equal(t, 0, root.Parent, "Root has a parent. Size: %d", size)
+			for i := 0; i < len(sizeList); i++ {
+				if len(sizeList[i].Children) == 0 {
+					continue
+				}
+				var childSizes uint64
+				for _, child := range sizeList[i].Children {
+					assert.Less(t, child, i+1, "Child after parent in canonical order. Size: %d, i: %v", size, i)
+					assert.Equal(t, i+1, sizeList[child-1].Parent, "Wrong parent. Size: %d, i: %v", size, i)
+					childSizes += sizeList[child-1].Size
+				}
+				assert.Equal(t, sizeList[i].Size, childSizes, "Children do not add up. Size: %d, i: %v", size, i)
+			}
+		}
+	}
+}
+
+func TestGenerateTreeMetadataCache(t *testing.T) {
+	cd := uint64(chunk.DefaultSize)
+	for _, options := range []ChunkerOptions{{}, {Pyramid: true}, {Encrypted: true}} {
+		shape, err := GenerateTreeMetadata(300*cd+5, options)
+		assert.Nil(t, err, "Error not nil. %v", err)
+		cached, err := GenerateTreeMetadata(300*cd+5, options)
+		assert.Nil(t, err, "Error not nil. %v", err)
+		assert.Equal(t, shape, cached, "Cached shape differs. %+v", options)
+		chunked, err := chunkedTreeMetadata(300*cd+5, options)
+		assert.Nil(t, err, "Error not nil. %v", err)
+		assert.Equal(t, chunked, cached, "Cached shape differs from the chunked one. %+v", options)
+	}
+
+	for size := uint64(1); size <= 2*shapeCacheSize; size++ {
+		if _, err := GenerateTreeMetadata(size*cd, ChunkerOptions{}); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	assert.Equal(t, shapeCacheSize, shapes.order.Len(), "Cache is not bounded.")
+	assert.Equal(t, shapeCacheSize, len(shapes.entries), "Cache is not bounded.")
+	_, ok := shapes.get(shapeKey{size: 2 * shapeCacheSize * cd})
+	assert.True(t, ok, "Most recent shape is not cached.")
+}
+
+func TestGenerateTreeMetadataChunkSize(t *testing.T) {
+	cd := uint64(chunk.DefaultSize)
+	// The calculated shape is the one storage.TreeSplit gives.
+	for _, size := range []uint64{100, cd, cd + 1, 128 * cd, 128*cd + 1, 129 * cd, 256*cd + 10, 128*128*cd + cd} {
+		sizeList, err := GenerateTreeMetadata(size, ChunkerOptions{})
+		assert.Nil(t, err, "Error not nil. %v", err)
+		assert.Equal(t, sizeList, treeShape(size, cd, ChunkMaxBranch), "Wrong shape. Size: %d", size)
+	}
+
+	for _, options := range []ChunkerOptions{{ChunkSize: 100}, {ChunkSize: 64}, {ChunkSize: 8192},
+		{ChunkSize: 1024, Encrypted: true}, {ChunkSize: 1024, Pyramid: true}} {
+		assert.NotNil(t, options.Validate(), "Invalid chunk size accepted. %+v", options)
+	}
+
+	const chunkSize = 256
+	options := ChunkerOptions{ChunkSize: chunkSize}
+	for _, size := range []uint64{100, chunkSize, chunkSize + 1, 8 * chunkSize, 8*chunkSize + 1, 65 * chunkSize, 512*chunkSize + 10} {
+		data := utils.GenerateRandomBytes(int(size), int64(size))
+		chunks, err := SplitTree(bytes.NewReader(data), size, options)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		assert.Equal(t, GetTreeIndexByChunkSize(size, chunkSize, options.Branches()), len(chunks), "Wrong number of chunks. Size: %d", size)
+
+		store := utils.NewMapChunkStore()
+		store.Put(context.Background(), chunk.ModePutUpload, chunks...)
+		getter := storage.NewHasherStore(store, storage.MakeHashFunc(storage.DefaultHash), false,
+			chunk.NewTag(0, "test-tag", 0, false))
+		tree, err := BuildCompleteTree(context.Background(), getter, storage.Reference(chunks[len(chunks)-1].Address()),
+			options.TreeOptions(), repair.NewMockRepair(getter))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		var leaves []byte
+		for _, tc := range tree.FlattenTree() {
+			assert.Equal(t, chunks[tc.Index-1].Address(), chunk.Address(tc.Key), "Wrong canonical index. Size: %d", size)
+			if len(tc.Children) == 0 {
+				leaves = append(leaves, tc.Data[ChunkSizeOffset:]...)
+			}
+		}
+		assert.Equal(t, data, leaves, "Wrong data. Size: %d", size)
+	}
+}
+
 func TestGetDepthCanonicalIndex(t *testing.T) {
 	tests := []struct {
 		maxIndex int
@@ -177,3 +305,119 @@ func TestGetLeavesCanonIndex(t *testing.T) {
 			test.maxIndex, leaves, test.leaves)
 	}
 }
+
+func TestGenerateTreeMetadataChunked(t *testing.T) {
+	cd := uint64(chunk.DefaultSize)
+	sizes := []uint64{1, 100, cd - 1, cd, cd + 1, 2 * cd, 63 * cd, 64 * cd, 64*cd + 1, 65 * cd, 127 * cd, 128 * cd,
+		128*cd + 1, 129 * cd, 129*cd + 7, 255 * cd, 256 * cd, 256*cd + 10, 257 * cd, 64 * 64 * cd, 64*64*cd + 1,
+		64*65*cd + cd, 128*128*cd - 1, 128 * 128 * cd, 128*128*cd + 1, 128*128*cd + cd, 128*128*cd + 128*cd + 1,
+		2*128*128*cd + 3*cd}
+	for _, size := range sizes {
+		for _, options := range []ChunkerOptions{{}, {Pyramid: true}, {Encrypted: true}, {Encrypted: true, Pyramid: true}} {
+			if options.Encrypted && size > 64*65*cd {
+				continue // Every encrypted chunk is stored, so large files take long to chunk.
+			}
+			shape, err := GenerateTreeMetadata(size, options)
+			assert.Nil(t, err, "Error not nil. %v", err)
+			chunked, err := chunkedTreeMetadata(size, options)
+			if err == errNoRoot {
+				continue // The pyramid chunker gives some sizes no root.
+			}
+			assert.Nil(t, err, "Error not nil. %v. Size: %d, %+v", err, size, options)
+			assert.Equal(t, chunked, shape, "Calculated shape differs from the chunked one. Size: %d, %+v", size, options)
+		}
+	}
+}
+
+// zeroReader reads zeros.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// errNoRoot is returned by chunkedTreeMetadata when the chunker gives an empty root address.
+var errNoRoot = errors.New("chunker gave no root")
+
+// recordingPutter keeps the plaintext of every chunk put through it, so trees of encrypted
+// chunks can be read without telling leaves and intermediate chunks apart by their span.
+type recordingPutter struct {
+	storage.Putter
+	lock   sync.Mutex
+	chunks map[string][]byte
+}
+
+func (p *recordingPutter) Put(ctx context.Context, data storage.ChunkData) (storage.Reference, error) {
+	ref, err := p.Putter.Put(ctx, data)
+	if err == nil {
+		p.lock.Lock()
+		p.chunks[string(ref)] = data
+		p.lock.Unlock()
+	}
+	return ref, err
+}
+
+// chunkedTreeMetadata chunks a file of zeros with size bytes with the Swarm chunker of the options,
+// and returns the metadata of the chunks of its tree.
+func chunkedTreeMetadata(size uint64, options ChunkerOptions) ([]ChunkMetadata, error) {
+	data := io.LimitReader(zeroReader{}, int64(size))
+	testtag := chunk.NewTag(0, "test-tag", 0, false)
+	putGetter := storage.NewHasherStore(utils.NewMapChunkStore(),
+		storage.MakeHashFunc(storage.DefaultHash), options.Encrypted, testtag)
+	putter := &recordingPutter{Putter: putGetter, chunks: make(map[string][]byte)}
+	ctx := context.Background()
+
+	var rootAddr storage.Address
+	var wait func(context.Context) error
+	var err error
+	if options.Pyramid {
+		rootAddr, wait, err = storage.PyramidSplit(ctx, data, putter, putGetter, testtag)
+	} else {
+		rootAddr, wait, err = storage.TreeSplit(ctx, data, int64(size), putter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = wait(ctx); err != nil {
+		return nil, err
+	}
+	if bytes.Equal(rootAddr, make([]byte, len(rootAddr))) {
+		return nil, errNoRoot
+	}
+	return recordedTreeShape(putter.chunks, storage.Reference(rootAddr))
+}
+
+// recordedTreeShape walks the recorded tree below ref and numbers the chunks in post-order,
+// which is their canonical index. It does not use GenerateTreeMetadata.
+func recordedTreeShape(chunks map[string][]byte, ref storage.Reference) ([]ChunkMetadata, error) {
+	var index int
+	var walker func(ref storage.Reference, parent *TreeChunk) (*TreeChunk, error)
+	walker = func(ref storage.Reference, parent *TreeChunk) (*TreeChunk, error) {
+		data, ok := chunks[string(ref)]
+		if !ok {
+			return nil, fmt.Errorf("chunk %x was not put", []byte(ref))
+		}
+		tc := NewTreeChunk(0, 0, ref, data, parent)
+		if IsEncryptedRef(ref) {
+			tc.Length = chunk.DefaultSize + ChunkSizeOffset
+		}
+		for i := range tc.Children {
+			start := ChunkSizeOffset + i*len(ref)
+			var err error
+			if tc.Children[i], err = walker(data[start:start+len(ref)], tc); err != nil {
+				return nil, err
+			}
+		}
+		index++
+		tc.Index = index
+		return tc, nil
+	}
+	root, err := walker(ref, nil)
+	if err != nil {
+		return nil, err
+	}
+	return root.Metadata(), nil
+}
@@ -11,6 +11,12 @@ import (
 	"github.com/relab/snarl-mw21/utils"
 )
 
+// parityChunk is a chunk of the parity tree of the given class.
+type parityChunk struct {
+	class int
+	tc    *TreeChunk
+}
+
 // MemoryGetter retrieves chunks from memory using the same interface as Swarms Get method.
 // It's constructor accepts a list of failed chunks - which can be used for testing purposes.
 
@@ -20,8 +26,14 @@ type MemoryGetter struct {
 	dataChunks     *TreeChunk
 	dataMap        map[string]*TreeChunk
 	parityChunks   []*TreeChunk
+	parityMap      map[string]parityChunk
 	failedChunks   map[string]BlockFailure
 	failedChildren []map[int]BlockFailure
+
+	// ParityRootsByAddress lets the roots of the parity trees be retrieved by their address, as from
+	// Swarm, to probe or update the parity trees. Otherwise a parity root can only be retrieved with the
+	// position of a leaf in the context, see Leafchunkid, and is invalid without it.
+	ParityRootsByAddress bool
 }
 
 func NewMemoryGetter(dataChunks *TreeChunk, parityChunks []*TreeChunk, failedChunks map[string]BlockFailure,
@@ -32,15 +44,25 @@ func NewMemoryGetter(dataChunks *TreeChunk, parityChunks []*TreeChunk, failedChu
 		for j := range c.Children {
 			walker(c.Children[j])
 		}
-		key := fmt.Sprintf("%x", c.Key)
+		key := fmt.Sprintf("%x", utils.RemoveDecryptionKeyFromChunkHash(c.Key, chunk.AddressLength))
 		dataMap[key] = c
 	}
 	walker(dataChunks)
 
+	parityMap := make(map[string]parityChunk)
+	for i := 0; i < len(parityChunks); i++ {
+		class := i
+		parityChunks[i].FilterChunks(func(c *TreeChunk) bool {
+			parityMap[fmt.Sprintf("%x", c.Key)] = parityChunk{class, c}
+			return false
+		})
+	}
+
 	return &MemoryGetter{
 		getLimit:       make(chan struct{}, getLimit),
 		dataChunks:     dataChunks,
 		parityChunks:   parityChunks,
+		parityMap:      parityMap,
 		failedChunks:   failedChunks,
 		failedChildren: failedChildren,
 		dataMap:        dataMap,
@@ -64,6 +86,10 @@ func (gc *MemoryGetter) Get(ctx context.Context, ref storage.Reference) (chunkda
 			time.Sleep(fail.Delay)
 		} else if fail.Class == Corrupt {
 			return utils.GenerateRandomBytes(chunk.DefaultSize, time.Now().UnixNano()), nil
+		} else if fail.Class == Byzantine {
+			if tc, ok := gc.dataMap[strRef]; ok {
+				return ByzantineData(tc.StoredData()), nil
+			}
 		}
 	} else {
 		for i := 0; i < len(gc.parityChunks); i++ {
@@ -75,11 +101,41 @@ func (gc *MemoryGetter) Get(ctx context.Context, ref storage.Reference) (chunkda
 					}
 					return tc.Data, nil
 				}
-				return nil, chunk.ErrChunkInvalid
+				if !gc.ParityRootsByAddress {
+					return nil, chunk.ErrChunkInvalid
+				}
 			}
 		}
+		// The other chunks of the parity trees are retrieved by address, which a Byzantine strand gets wrong.
+		if pc, ok := gc.parityMap[strRef]; ok {
+			if fail, ok := gc.parityFailure(pc); ok && fail.Class == Unavailable {
+				return nil, chunk.ErrChunkNotFound
+			} else if ok && fail.Class == Byzantine {
+				return ByzantineData(pc.tc.Data), nil
+			}
+			return pc.tc.Data, nil
+		}
+	}
+	tc, ok := gc.dataMap[strRef]
+	if !ok {
+		return nil, chunk.ErrChunkNotFound
 	}
-	return gc.dataMap[strRef].Data, nil
+	return tc.StoredData(), nil
+}
+
+// Has reports whether the chunk at addr is available. Chunks that are corrupt or delayed are
+// reported as available, since that can not be known without retrieving them.
+func (gc *MemoryGetter) Has(ctx context.Context, addr chunk.Address) (bool, error) {
+	strRef := addr.Hex()
+	if fail, ok := gc.failedChunks[strRef]; ok && fail.Class == Unavailable {
+		return false, nil
+	}
+	if pc, ok := gc.parityMap[strRef]; ok {
+		fail, failed := gc.parityFailure(pc)
+		return !failed || fail.Class != Unavailable, nil
+	}
+	_, ok := gc.dataMap[strRef]
+	return ok, nil
 }
 
 type BlockFailure struct {
@@ -94,4 +150,24 @@ const (
 	Delay = iota
 	Unavailable
 	Corrupt
+	Byzantine // Well-formed but wrong data, the same on every retrieval
 )
+
+// ByzantineData returns the data a Byzantine source serves instead of data: the span is kept, and
+// every bit of the payload is flipped. The same data always gives the same wrong data.
+func ByzantineData(data []byte) []byte {
+	wrong := make([]byte, len(data))
+	copy(wrong, data)
+	for i := ChunkSizeOffset; i < len(wrong); i++ {
+		wrong[i] ^= 0xff
+	}
+	return wrong
+}
+
+func (gc *MemoryGetter) parityFailure(pc parityChunk) (BlockFailure, bool) {
+	if pc.class >= len(gc.failedChildren) {
+		return BlockFailure{}, false
+	}
+	fail, ok := gc.failedChildren[pc.class][pc.tc.Index]
+	return fail, ok
+}
@@ -0,0 +1,173 @@
+package swarmconnector
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// PlacementPolicy decides the positions of the chunks of a tree in the lattice. Leaves are the only
+// chunks that can be recovered from a lattice window alone, so where the internal nodes are placed
+// decides how failures of a parent and its children combine.
+type PlacementPolicy interface {
+	// Place returns the lattice position of every chunk of the tree with the given shape, by canonical
+	// index: the chunk with index i is at position positions[i-1]. Chunks are only moved by swapping
+	// places in pairs, so positions also gives the chunk at every position. The root is never moved.
+	Place(shape []ChunkMetadata, s, p int) (positions []int)
+	// String returns the name of the policy, as read by ParsePlacement.
+	String() string
+}
+
+// ParsePlacement returns the placement policy with the given name: "window", which is also the
+// policy of an empty name, "spread", "subtree", or "random:seed".
+func ParsePlacement(name string) (PlacementPolicy, error) {
+	kind, param := name, ""
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		kind, param = name[:i], name[i+1:]
+	}
+	switch {
+	case (kind == "" || kind == "window") && param == "":
+		return WindowPlacement{}, nil
+	case kind == "spread" && param == "":
+		return SpreadPlacement{}, nil
+	case kind == "subtree" && param == "":
+		return SubtreePlacement{}, nil
+	case kind == "random" && param != "":
+		seed, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid placement policy %q: %v", name, err)
+		}
+		return RandomPlacement{Seed: seed}, nil
+	}
+	return nil, fmt.Errorf("unknown placement policy %q", name)
+}
+
+// WindowPlacement moves every internal node to the first leaf position at the end of a lattice
+// window that is more than a window away from its children, so a parent and its children are
+// never lost to the failures of the same window. It is the default policy.
+type WindowPlacement struct{}
+
+// Place implements PlacementPolicy.
+func (WindowPlacement) Place(shape []ChunkMetadata, s, p int) []int {
+	positions := canonicalPositions(len(shape))
+	windowSize := s * p
+	for _, node := range internalNodes(shape) {
+		lowestChild := shape[node].Children[0]
+		highestChild := shape[node].Children[len(shape[node].Children)-1]
+		for j := windowSize; j < len(shape); j += windowSize + s {
+			inWindow := j+1 > lowestChild-windowSize && j+1 < highestChild+windowSize
+			if !inWindow && isFreeLeaf(shape, positions, j) {
+				swapPositions(positions, node, j)
+				break
+			}
+		}
+	}
+	return positions
+}
+
+func (WindowPlacement) String() string { return "window" }
+
+// SpreadPlacement spaces the internal nodes evenly over the lattice, each at the free leaf position
+// closest to its share of the lattice, so they are as far from each other as they can be.
+type SpreadPlacement struct{}
+
+// Place implements PlacementPolicy.
+func (SpreadPlacement) Place(shape []ChunkMetadata, s, p int) []int {
+	positions := canonicalPositions(len(shape))
+	nodes := internalNodes(shape)
+	for i, node := range nodes {
+		target := (2*i + 1) * len(shape) / (2 * len(nodes))
+		for d := 0; d < len(shape); d++ {
+			if j := target - d; j >= 0 && isFreeLeaf(shape, positions, j) {
+				swapPositions(positions, node, j)
+				break
+			}
+			if j := target + d; j < len(shape) && isFreeLeaf(shape, positions, j) {
+				swapPositions(positions, node, j)
+				break
+			}
+		}
+	}
+	return positions
+}
+
+func (SpreadPlacement) String() string { return "spread" }
+
+// SubtreePlacement keeps the chunks in canonical order, where every internal node follows the
+// chunks of its subtree, so each subtree is a consecutive run of lattice positions.
+type SubtreePlacement struct{}
+
+// Place implements PlacementPolicy.
+func (SubtreePlacement) Place(shape []ChunkMetadata, s, p int) []int {
+	return canonicalPositions(len(shape))
+}
+
+func (SubtreePlacement) String() string { return "subtree" }
+
+// RandomPlacement swaps every internal node with a leaf picked at random, the same for the same seed.
+type RandomPlacement struct {
+	Seed int64
+}
+
+// Place implements PlacementPolicy.
+func (r RandomPlacement) Place(shape []ChunkMetadata, s, p int) []int {
+	positions := canonicalPositions(len(shape))
+	var leaves []int
+	for i, meta := range shape {
+		if len(meta.Children) == 0 {
+			leaves = append(leaves, i)
+		}
+	}
+	rnd := rand.New(rand.NewSource(r.Seed))
+	rnd.Shuffle(len(leaves), func(i, j int) { leaves[i], leaves[j] = leaves[j], leaves[i] })
+	for i, node := range internalNodes(shape) {
+		if i == len(leaves) {
+			break
+		}
+		swapPositions(positions, node, leaves[i])
+	}
+	return positions
+}
+
+func (r RandomPlacement) String() string { return fmt.Sprintf("random:%d", r.Seed) }
+
+// canonicalPositions returns the positions of n chunks that are not moved.
+func canonicalPositions(n int) []int {
+	positions := make([]int, n)
+	for i := range positions {
+		positions[i] = i + 1
+	}
+	return positions
+}
+
+// internalNodes returns the offsets in shape of the internal nodes other than the root, in canonical order.
+func internalNodes(shape []ChunkMetadata) (nodes []int) {
+	for i, meta := range shape {
+		if len(meta.Children) > 0 && meta.Parent != 0 {
+			nodes = append(nodes, i)
+		}
+	}
+	return nodes
+}
+
+// isFreeLeaf reports whether the chunk at offset i of shape is a leaf that has not been moved.
+func isFreeLeaf(shape []ChunkMetadata, positions []int, i int) bool {
+	return len(shape[i].Children) == 0 && positions[i] == i+1
+}
+
+// swapPositions swaps the positions of the chunks at offsets a and b of shape.
+func swapPositions(positions []int, a, b int) {
+	positions[a], positions[b] = b+1, a+1
+}
+
+// FlattenTreePlacement flattens the tree in the order of the lattice positions the policy gives its chunks.
+// s - Horizontal, p - Helical
+func (tc *TreeChunk) FlattenTreePlacement(policy PlacementPolicy, s, p int) []*TreeChunk {
+	positions := policy.Place(tc.Metadata(), s, p)
+	out := make([]*TreeChunk, len(positions))
+	for i, chunk := range tc.FlattenTree() {
+		out[positions[i]-1] = chunk
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package swarmconnector
+
+import (
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePlacement(t *testing.T) {
+	for _, name := range []string{"window", "spread", "subtree", "random:42", "random:-7"} {
+		policy, err := ParsePlacement(name)
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, name, policy.String())
+		}
+	}
+	policy, err := ParsePlacement("")
+	assert.NoError(t, err)
+	assert.Equal(t, WindowPlacement{}, policy)
+
+	for _, name := range []string{"foo", "random", "random:", "random:x", "window:1", "spread:2"} {
+		_, err := ParsePlacement(name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestPlacementPolicies(t *testing.T) {
+	policies := []PlacementPolicy{WindowPlacement{}, SpreadPlacement{}, SubtreePlacement{}, RandomPlacement{Seed: 1}}
+	for _, chunks := range []uint64{1, 2, 128, 129, 300, 4097} {
+		shape, err := GenerateChunkMetadata(chunks * chunk.DefaultSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, policy := range policies {
+			positions := policy.Place(shape, 5, 5)
+			if !assert.Equal(t, len(shape), len(positions), "%v with %d chunks", policy, chunks) {
+				continue
+			}
+			for i, pos := range positions {
+				// Chunks swap places in pairs, so the positions must undo themselves.
+				assert.Equal(t, i+1, positions[pos-1], "%v with %d chunks: position %d is not a swap", policy, chunks, pos)
+				if pos != i+1 {
+					moved, other := shape[i], shape[pos-1]
+					assert.True(t, len(moved.Children) == 0 || len(other.Children) == 0,
+						"%v with %d chunks: internal nodes %d and %d swapped", policy, chunks, i+1, pos)
+					assert.NotEqual(t, 0, moved.Parent, "%v with %d chunks: root was moved", policy, chunks)
+				}
+			}
+		}
+	}
+}
+
+func TestRandomPlacementSeed(t *testing.T) {
+	shape, err := GenerateChunkMetadata(300 * chunk.DefaultSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, RandomPlacement{Seed: 3}.Place(shape, 5, 5), RandomPlacement{Seed: 3}.Place(shape, 5, 5))
+	assert.NotEqual(t, RandomPlacement{Seed: 3}.Place(shape, 5, 5), RandomPlacement{Seed: 4}.Place(shape, 5, 5))
+}
@@ -0,0 +1,74 @@
+package swarmconnector
+
+import (
+	"context"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/utils"
+)
+
+// Prober checks whether a chunk is available without retrieving it.
+type Prober interface {
+	Has(ctx context.Context, addr chunk.Address) (bool, error)
+}
+
+// ChunkStatus is the availability of a chunk as found by ProbeTree.
+type ChunkStatus int
+
+const (
+	ChunkUnknown     ChunkStatus = iota // Not probed, since the parent chunk is unavailable
+	ChunkAvailable                      // The chunk can be retrieved
+	ChunkUnavailable                    // The chunk can not be retrieved
+	ChunkSkipped                        // Not probed, since the leaf was left out of the sample
+)
+
+// ProbeTree checks the availability of every chunk in the tree at rootAddr, where shape is the
+// metadata of the tree as given by GenerateTreeMetadata. Internal chunks are retrieved with getter,
+// as they hold the references of their children, while leaves are only probed with prober.
+// The status of the chunk with canonical index i is found at position i-1 of the result.
+func ProbeTree(ctx context.Context, getter storage.Getter, prober Prober, rootAddr []byte, shape []ChunkMetadata) []ChunkStatus {
+	return ProbeTreeSample(ctx, getter, prober, rootAddr, shape, nil)
+}
+
+// ProbeTreeSample is the same as ProbeTree, but only the leaves for which sample returns true are
+// probed. The others are given the status ChunkSkipped. If sample is nil, every leaf is probed.
+func ProbeTreeSample(ctx context.Context, getter storage.Getter, prober Prober, rootAddr []byte, shape []ChunkMetadata,
+	sample func(index int) bool) []ChunkStatus {
+	status := make([]ChunkStatus, len(shape))
+	if len(shape) == 0 {
+		return status
+	}
+
+	var probe func(index int, ref []byte)
+	probe = func(index int, ref []byte) {
+		meta := shape[index-1]
+		if len(meta.Children) == 0 {
+			if sample != nil && !sample(index) {
+				status[index-1] = ChunkSkipped
+				return
+			}
+			addr := utils.RemoveDecryptionKeyFromChunkHash(ref, chunk.AddressLength)
+			if has, err := prober.Has(ctx, addr); err == nil && has {
+				status[index-1] = ChunkAvailable
+			} else {
+				status[index-1] = ChunkUnavailable
+			}
+			return
+		}
+
+		data, err := GetPlainChunk(ctx, getter, ref)
+		if err != nil || len(data) < ChunkSizeOffset+len(meta.Children)*len(ref) {
+			status[index-1] = ChunkUnavailable
+			return
+		}
+		status[index-1] = ChunkAvailable
+		for i, child := range meta.Children {
+			start := ChunkSizeOffset + i*len(ref)
+			probe(child, data[start:start+len(ref)])
+		}
+	}
+	probe(len(shape), rootAddr)
+
+	return status
+}
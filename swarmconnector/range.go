@@ -0,0 +1,135 @@
+package swarmconnector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/repair"
+)
+
+// ErrInvalidRange is returned when a byte range is outside of the file.
+var ErrInvalidRange = errors.New("invalid byte range")
+
+// ReadRange writes the bytes from start up to, but not including, end of the file at rootAddr to w.
+// Only the chunks on the branches of the Merkle tree that cover the range are retrieved, and only
+// those chunks are repaired by the repairer if they are not available. An end beyond the size
+// of the file is cut to the size. It returns the number of bytes written.
+func ReadRange(ctx context.Context, getter storage.Getter, rootAddr storage.Reference,
+	options BuildTreeOptions, repairer repair.Repairer, start, end uint64, w io.Writer) (int64, error) {
+	tc, options, err := rootTreeChunk(ctx, getter, rootAddr, options, repairer)
+	if err != nil {
+		return 0, err
+	}
+	if end > tc.SubtreeSize {
+		end = tc.SubtreeSize
+	}
+	if start > end {
+		return 0, fmt.Errorf("%w: %d-%d of %d bytes", ErrInvalidRange, start, end, tc.SubtreeSize)
+	}
+	cw := &countingWriter{w: w}
+	err = tc.readRange(ctx, 0, options, repairer, nil, start, end, cw)
+	return cw.n, err
+}
+
+// readRange writes the bytes in [start, end) of the subtree of tc to w. The children that overlap
+// the range are retrieved concurrently, or taken from cache if it is not nil, and then read in order.
+func (tc *TreeChunk) readRange(ctx context.Context, parentOffset int, options BuildTreeOptions,
+	repairer repair.Repairer, cache *chunkCache, start, end uint64, w io.Writer) error {
+	if start >= end {
+		return nil
+	}
+	// This is a leaf node, since it contains all the data in its subtree
+	if tc.SubtreeSize <= uint64(len(tc.Data)) {
+		_, err := w.Write(tc.Data[ChunkSizeOffset+start : ChunkSizeOffset+end])
+		return err
+	}
+
+	numChildren := len(tc.Children)
+	if options.shape != nil && len(options.shape[tc.Index-1].Children) != numChildren {
+		return errors.New("tree does not have the shape of a pyramid chunked file")
+	}
+	offset := tc.childOffset(options)
+
+	type childRange struct {
+		childNum   int
+		start, end uint64 // Range within the subtree of the child
+		chunk      *TreeChunk
+		nextParent int
+		err        error
+	}
+	var children []*childRange
+	var childStart uint64
+	for childNum := 1; childNum <= numChildren && childStart < end; childNum++ {
+		size := tc.childRangeSize(childNum, parentOffset, offset, options)
+		if childStart+size > start {
+			cr := &childRange{childNum: childNum, end: size}
+			if start > childStart {
+				cr.start = start - childStart
+			}
+			if end < childStart+size {
+				cr.end = end - childStart
+			}
+			children = append(children, cr)
+		}
+		childStart += size
+	}
+
+	var wg sync.WaitGroup
+	for _, cr := range children {
+		wg.Add(1)
+		go func(cr *childRange) {
+			defer wg.Done()
+			if cr.err = ctx.Err(); cr.err == nil {
+				cr.chunk, cr.nextParent, cr.err = cache.retrieveChild(tc, cr.childNum, parentOffset, offset, options, repairer)
+			}
+		}(cr)
+	}
+	wg.Wait()
+
+	for _, cr := range children {
+		if cr.err != nil {
+			return cr.err
+		}
+		if err := cr.chunk.readRange(ctx, cr.nextParent, options, repairer, cache, cr.start, cr.end, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// childRangeSize returns the number of file bytes below child number childNum of tc.
+func (tc *TreeChunk) childRangeSize(childNum, parentOffset, offset int, options BuildTreeOptions) uint64 {
+	if options.shape != nil {
+		lastChild := childNum == len(tc.Children)
+		return options.shape[tc.childIndex(lastChild, parentOffset, offset, childNum, options)-1].Size
+	}
+	if tc.IsEncrypted() {
+		return tc.childSize(childNum)
+	}
+	// Every child but the last spans a full subtree; the smallest one that gives tc its number of children.
+	branches := options.branches(len(tc.Key))
+	size := options.chunkSize()
+	for (tc.SubtreeSize+size-1)/size > uint64(len(tc.Children)) {
+		size *= branches
+	}
+	if childOffset := uint64(childNum-1) * size; tc.SubtreeSize-childOffset < size {
+		return tc.SubtreeSize - childOffset
+	}
+	return size
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
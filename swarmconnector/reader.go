@@ -0,0 +1,193 @@
+package swarmconnector
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/repair"
+)
+
+// DefaultReaderCacheSize is the number of decoded chunks a LazyReader keeps by default.
+const DefaultReaderCacheSize = 64
+
+// LazyReader reads a file from Swarm on demand, in the same way as the LazyChunkReader of
+// storage.TreeJoin. Chunks that are not available are repaired by the repairer. Only the root
+// chunk is retrieved up front; the chunks below it are retrieved concurrently when a read covers
+// them, and the most recently used ones are kept in a cache. If the repairer is a repair.Releaser,
+// it is told to release every chunk that leaves the cache.
+// ReadAt is safe for concurrent use, while Read and Seek share the offset of the reader.
+type LazyReader struct {
+	ctx      context.Context
+	root     *TreeChunk
+	options  BuildTreeOptions
+	repairer repair.Repairer
+	cache    *chunkCache
+
+	lock sync.Mutex
+	off  int64
+}
+
+// NewLazyReader retrieves, or repairs, the root chunk of the file at rootAddr and returns a reader
+// of the file. The reader keeps at most cacheSize decoded chunks, or none if cacheSize is zero.
+func NewLazyReader(ctx context.Context, getter storage.Getter, rootAddr storage.Reference,
+	options BuildTreeOptions, repairer repair.Repairer, cacheSize int) (*LazyReader, error) {
+	root, options, err := rootTreeChunk(ctx, getter, rootAddr, options, repairer)
+	if err != nil {
+		return nil, err
+	}
+	return &LazyReader{
+		ctx:      ctx,
+		root:     root,
+		options:  options,
+		repairer: repairer,
+		cache:    newChunkCache(cacheSize, repairer),
+	}, nil
+}
+
+// Size returns the size of the file in bytes.
+func (r *LazyReader) Size() int64 {
+	return int64(r.root.SubtreeSize)
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *LazyReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= r.Size() {
+		return 0, io.EOF
+	}
+	end := uint64(off) + uint64(len(p))
+	if end > r.root.SubtreeSize {
+		end = r.root.SubtreeSize
+	}
+	w := &sliceWriter{buf: p}
+	if err := r.root.readRange(r.ctx, 0, r.options, r.repairer, r.cache, uint64(off), end, w); err != nil {
+		return w.n, err
+	}
+	if w.n < len(p) {
+		return w.n, io.EOF
+	}
+	return w.n, nil
+}
+
+// Read implements io.Reader.
+func (r *LazyReader) Read(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	n, err := r.ReadAt(p, r.off)
+	r.off += int64(n)
+	if err == io.EOF && n > 0 {
+		// Report the end of the file on the next read, as io.Reader prefers.
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (r *LazyReader) Seek(offset int64, whence int) (int64, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.Size()
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.off = offset
+	return offset, nil
+}
+
+// sliceWriter copies the bytes written to it into buf.
+type sliceWriter struct {
+	buf []byte
+	n   int
+}
+
+func (w *sliceWriter) Write(p []byte) (int, error) {
+	n := copy(w.buf[w.n:], p)
+	w.n += n
+	if n < len(p) {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
+
+// chunkCache keeps the most recently used chunks of a tree by their canonical index.
+type chunkCache struct {
+	size    int
+	release func(index int) // Called with the index of every chunk that leaves the cache, if not nil
+	lock    sync.Mutex
+	entries map[int]*list.Element
+	order   *list.List // Most recently used first
+}
+
+type cachedChunk struct {
+	index      int
+	chunk      *TreeChunk
+	nextParent int
+}
+
+// newChunkCache returns a cache of size chunks. A cache of size zero keeps no chunks, but still
+// releases the chunks it retrieves if the repairer is a repair.Releaser.
+func newChunkCache(size int, repairer repair.Repairer) *chunkCache {
+	if size < 0 {
+		size = 0
+	}
+	c := &chunkCache{size: size, entries: make(map[int]*list.Element), order: list.New()}
+	if r, ok := repairer.(repair.Releaser); ok {
+		c.release = r.Release
+	}
+	return c
+}
+
+// retrieveChild returns child number childNum of tc from the cache, or retrieves it and adds it
+// to the cache. A nil cache always retrieves the child.
+func (c *chunkCache) retrieveChild(tc *TreeChunk, childNum, parentOffset, offset int, options BuildTreeOptions,
+	repairer repair.Repairer) (*TreeChunk, int, error) {
+	if c == nil {
+		return tc.retrieveChild(childNum, parentOffset, offset, options, repairer)
+	}
+	index := tc.childIndex(childNum == len(tc.Children), parentOffset, offset, childNum, options)
+	c.lock.Lock()
+	if e, ok := c.entries[index]; ok {
+		c.order.MoveToFront(e)
+		cached := e.Value.(*cachedChunk)
+		c.lock.Unlock()
+		return cached.chunk, cached.nextParent, nil
+	}
+	c.lock.Unlock()
+
+	child, nextParent, err := tc.retrieveChild(childNum, parentOffset, offset, options, repairer)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	evicted := -1
+	c.lock.Lock()
+	if _, ok := c.entries[index]; !ok {
+		c.entries[index] = c.order.PushFront(&cachedChunk{index: index, chunk: child, nextParent: nextParent})
+		if c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			evicted = oldest.Value.(*cachedChunk).index
+			delete(c.entries, evicted)
+		}
+	}
+	c.lock.Unlock()
+	// The repairer may have to wait for a repair to finish, so it is not called with the cache locked.
+	if evicted != -1 && c.release != nil {
+		c.release(evicted)
+	}
+	return child, nextParent, nil
+}
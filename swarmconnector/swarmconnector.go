@@ -2,8 +2,8 @@ package swarmconnector
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"io"
 	"os"
 	"time"
 
@@ -13,6 +13,7 @@ import (
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/storage"
 	"github.com/ethersphere/swarm/storage/localstore"
+	"github.com/relab/snarl-mw21/config"
 	"github.com/relab/snarl-mw21/repair"
 	"github.com/relab/snarl-mw21/utils"
 	"github.com/zloylos/grsync"
@@ -40,6 +41,11 @@ type SwarmConnector struct {
 	SnarlChunkPath string
 }
 
+// NewSwarmConnectorConfig is the same as NewSwarmConnector with the paths and key of c.
+func NewSwarmConnectorConfig(c config.Connection) *SwarmConnector {
+	return NewSwarmConnector(c.ChunkDBPath, c.BzzKey, c.SnarlDBPath)
+}
+
 func NewSwarmConnector(ChunkDBPath, bzzKey, SnarlDBPath string) *SwarmConnector {
 	if ChunkDBPath != SnarlDBPath {
 		SyncDB = func() { syncLocalDB(ChunkDBPath, SnarlDBPath) }
@@ -89,29 +95,145 @@ func NewSwarmConnector(ChunkDBPath, bzzKey, SnarlDBPath string) *SwarmConnector
 	}
 }
 
+// BuildMultiTrees builds the Merkle trees of the file or collection at addr.
+// See BuildCollection.
 func (sc *SwarmConnector) BuildMultiTrees(addr []byte) ([]*TreeChunk, error) {
-	// Check if its a manifest we are looking at
-	manifestlist, err := sc.Swarmapi.GetManifestList(sc.Ctx, nil, addr, "")
-
-	if err == nil {
-		treechunks := make([]*TreeChunk, 0)
-		for i := 0; i < len(manifestlist.Entries); i++ {
-			rootAddr, err := hexutil.Decode("0x" + manifestlist.Entries[i].Hash)
-			if err != nil {
-				continue
-			}
-			rootchunks, err := sc.BuildMultiTrees(rootAddr)
-			if err != nil {
-				return nil, err
-			}
-			treechunks = append(treechunks, rootchunks...)
+	entries, err := sc.BuildCollection(addr)
+	if err != nil {
+		return nil, err
+	}
+	trees := make([]*TreeChunk, len(entries))
+	for i := 0; i < len(entries); i++ {
+		trees[i] = entries[i].Tree
+	}
+	return trees, nil
+}
+
+// CollectionEntry is a file or a manifest of a Swarm collection, with the Merkle tree of its content.
+type CollectionEntry struct {
+	Path        string
+	ContentType string
+	Addr        []byte
+	Chunker     ChunkerOptions
+	Tree        *TreeChunk
+}
+
+// IsManifest reports whether the entry is a manifest of the collection.
+func (ce *CollectionEntry) IsManifest() bool {
+	return ce.ContentType == api.ManifestType
+}
+
+// BuildCollection builds the Merkle trees of the manifest at addr and of every file and
+// manifest below it. The manifest at addr is the first entry. If addr is not a manifest,
+// the only entry is the file itself.
+func (sc *SwarmConnector) BuildCollection(addr []byte) ([]*CollectionEntry, error) {
+	walker, err := sc.Swarmapi.NewManifestWalker(sc.Ctx, addr, nil, nil)
+	if err != nil {
+		entry, err := sc.buildEntry("", "", addr)
+		if err != nil {
+			return nil, err
 		}
-		return treechunks, errors.New("Manifestlist")
+		return []*CollectionEntry{entry}, nil
 	}
 
-	tree, err := BuildCompleteTree(sc.Ctx, sc.LStore, addr, BuildTreeOptions{}, repair.NewMockRepair(sc.LStore))
+	root, err := sc.buildEntry("", api.ManifestType, addr)
+	if err != nil {
+		return nil, err
+	}
+	entries := []*CollectionEntry{root}
+	seen := map[string]struct{}{hexutil.Encode(addr): {}}
+	err = walker.Walk(func(me *api.ManifestEntry) error {
+		if me.Hash == "" {
+			return nil
+		}
+		ref, err := hexutil.Decode("0x" + me.Hash)
+		if err != nil {
+			return err
+		}
+		// The same content may be found at multiple paths, but only needs protection once.
+		if _, ok := seen[hexutil.Encode(ref)]; ok {
+			return nil
+		}
+		seen[hexutil.Encode(ref)] = struct{}{}
+		entry, err := sc.buildEntry(me.Path, me.ContentType, ref)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
 
-	return []*TreeChunk{tree}, err
+func (sc *SwarmConnector) buildEntry(path, contentType string, addr []byte) (*CollectionEntry, error) {
+	chunker, err := DetectChunker(sc.Ctx, sc.LStore, addr)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := BuildCompleteTree(sc.Ctx, sc.LStore, addr, BuildTreeOptions{Pyramid: chunker.Pyramid}, repair.NewMockRepair(sc.LStore))
+	if err != nil {
+		return nil, err
+	}
+	return &CollectionEntry{Path: path, ContentType: contentType, Addr: addr, Chunker: chunker, Tree: tree}, nil
+}
+
+// StoreLocal chunks size bytes of data straight into the local chunk store and returns the root
+// address. If pin is true, the chunks are pinned so they are never garbage collected.
+func (sc *SwarmConnector) StoreLocal(data io.Reader, size int64, pin bool) ([]byte, error) {
+	addr, wait, err := sc.FileStore.Store(sc.Ctx, data, size, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := wait(sc.Ctx); err != nil {
+		return nil, err
+	}
+	if pin {
+		if err := sc.PinLocal(addr); err != nil {
+			return nil, err
+		}
+	}
+	return addr, nil
+}
+
+// PinLocal pins every chunk of the tree at addr in the local chunk store.
+func (sc *SwarmConnector) PinLocal(addr []byte) error {
+	chunker, err := DetectChunker(sc.Ctx, sc.LStore, addr)
+	if err != nil {
+		return err
+	}
+	tree, err := BuildCompleteTree(sc.Ctx, sc.LStore, addr, BuildTreeOptions{EmptyLeaves: true, Pyramid: chunker.Pyramid},
+		repair.NewMockRepair(sc.LStore))
+	if err != nil {
+		return err
+	}
+	addrs := make([]chunk.Address, 0, tree.Index)
+	tree.FilterChunks(func(tc *TreeChunk) bool {
+		addrs = append(addrs, utils.RemoveDecryptionKeyFromChunkHash(tc.Key, chunk.AddressLength))
+		return false
+	})
+	return sc.LStore.Set(sc.Ctx, chunk.ModeSetPin, addrs...)
+}
+
+// PutLocal stores the chunks in the local chunk store, from where they are synced to the network.
+// If pin is true, the chunks are pinned so they are never garbage collected.
+func (sc *SwarmConnector) PutLocal(chunks []chunk.Chunk, pin bool) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+	if _, err := sc.LStore.Put(sc.Ctx, chunk.ModePutUpload, chunks...); err != nil {
+		return err
+	}
+	if !pin {
+		return nil
+	}
+	addrs := make([]chunk.Address, len(chunks))
+	for i := 0; i < len(chunks); i++ {
+		addrs[i] = chunks[i].Address()
+	}
+	return sc.LStore.Set(sc.Ctx, chunk.ModeSetPin, addrs...)
 }
 
 // GetChunk retrieves chunks from the localstore.
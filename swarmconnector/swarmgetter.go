@@ -113,6 +113,36 @@ func (gc *SnarlGetter) Get(ctx context.Context, ref storage.Reference) (chunkdat
 	return
 }
 
+// Has reports whether the chunk at addr is available, without retrieving it. The local store is
+// checked first, before a HEAD request is issued to the local swarm node.
+func (gc *SnarlGetter) Has(ctx context.Context, addr chunk.Address) (bool, error) {
+	if has, err := gc.chunkstore.Has(ctx, addr); err == nil && has {
+		return true, nil
+	}
+
+	uri := fmt.Sprintf("%v/%v/%x", gc.endpoint, "bzz-chunk:", addr)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, uri, nil)
+	if err != nil {
+		return false, err
+	}
+
+	gc.acquire()
+	defer gc.release()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("http status error: %s", resp.Status)
+}
+
 func (gc *SnarlGetter) acquire() {
 	gc.getLimit <- struct{}{}
 }
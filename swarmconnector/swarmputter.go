@@ -8,7 +8,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/storage"
 )
@@ -21,6 +23,7 @@ type SnarlPutter struct {
 }
 
 const putLimit int = 20
+const pinHeader = "x-swarm-pin"
 
 func NewSnarlPutter(chunkStore storage.ChunkStore, tag *chunk.Tag, endpoint string) *SnarlPutter {
 	return &SnarlPutter{storage.NewHasherStore(chunkStore,
@@ -46,8 +49,13 @@ func (sp *SnarlPutter) UploadChunk(addr, data []byte) ([]byte, error) {
 	return dat, err
 }
 
-func (sp *SnarlPutter) UploadFile(data io.Reader) ([]byte, *chunk.Tag, error) {
+// UploadFile uploads the data as a file. If toEncrypt is true, the node encrypts the chunks and
+// the content hash in the manifest will hold the decryption key.
+func (sp *SnarlPutter) UploadFile(data io.Reader, toEncrypt bool) ([]byte, *chunk.Tag, error) {
 	uri := fmt.Sprintf("%v/%v/", sp.endpoint, "bzz:")
+	if toEncrypt {
+		uri += "encrypt"
+	}
 	sp.putLimit <- struct{}{}
 	resp, err := http.Post(uri, "text/plain", data)
 	<-sp.putLimit
@@ -66,6 +74,66 @@ func (sp *SnarlPutter) UploadFile(data io.Reader) ([]byte, *chunk.Tag, error) {
 	return respByte, tag, err
 }
 
+// UploadRaw uploads size bytes of data without wrapping them in a manifest, and returns the root
+// address of the chunk tree. If pin is true, the node pins the chunks so they are never garbage collected.
+func (sp *SnarlPutter) UploadRaw(data io.Reader, size int64, pin bool) ([]byte, *chunk.Tag, error) {
+	uri := fmt.Sprintf("%v/%v/", sp.endpoint, "bzz-raw:")
+	req, err := http.NewRequest(http.MethodPost, uri, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if pin {
+		req.Header.Set(pinHeader, "true")
+	}
+	sp.putLimit <- struct{}{}
+	resp, err := http.DefaultClient.Do(req)
+	<-sp.putLimit
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("http status error: %s", resp.Status)
+	}
+	tag, err := sp.GetChunkTag(resp.Header.Get("x-swarm-tag"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	respByte, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	addr, err := hexutil.Decode("0x" + strings.TrimSpace(string(respByte)))
+	return addr, tag, err
+}
+
+// Pin pins the content at addr on the node, so its chunks are never garbage collected.
+// raw must be true unless addr is a manifest.
+func (sp *SnarlPutter) Pin(addr []byte, raw bool) error {
+	uri := fmt.Sprintf("%v/%v/%x", sp.endpoint, "bzz-pin:", addr)
+	if raw {
+		uri += "?raw=true"
+	}
+	sp.putLimit <- struct{}{}
+	resp, err := http.Post(uri, "text/plain", nil)
+	<-sp.putLimit
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http status error: %s", resp.Status)
+	}
+	return nil
+}
+
 func (sp *SnarlPutter) GetChunkTag(id string) (*chunk.Tag, error) {
 	var uri string
 	if _, err := strconv.ParseUint(id, 10, 32); err == nil {
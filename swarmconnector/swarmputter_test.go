@@ -0,0 +1,46 @@
+package swarmconnector
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadRawAndPin(t *testing.T) {
+	data := []byte("parity data")
+	var pinned []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/bzz-raw:"):
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Equal(t, data, body, "Wrong body")
+			assert.Equal(t, int64(len(data)), r.ContentLength, "Missing content length")
+			assert.Equal(t, "true", r.Header.Get(pinHeader), "Missing pin header")
+			w.Header().Set("x-swarm-tag", "42")
+			w.Write([]byte("0102ff\n"))
+		case strings.HasPrefix(r.URL.Path, "/bzz-tag:"):
+			assert.Equal(t, "42", r.URL.Query().Get("Id"), "Wrong tag id")
+			w.Write([]byte("{}"))
+		case strings.HasPrefix(r.URL.Path, "/bzz-pin:"):
+			pinned = append(pinned, r.URL.Path+"?"+r.URL.RawQuery)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	sp := &SnarlPutter{endpoint: server.URL, putLimit: make(chan struct{}, putLimit)}
+	addr, tag, err := sp.UploadRaw(bytes.NewReader(data), int64(len(data)), true)
+	assert.Nil(t, err, "Error not nil. %v", err)
+	assert.NotNil(t, tag, "Missing tag")
+	assert.Equal(t, []byte{1, 2, 255}, addr, "Wrong root address")
+
+	assert.Nil(t, sp.Pin(addr, true))
+	assert.Nil(t, sp.Pin(addr, false))
+	assert.Equal(t, []string{"/bzz-pin:/0102ff?raw=true", "/bzz-pin:/0102ff?"}, pinned)
+}
@@ -0,0 +1,175 @@
+package swarmconnector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/config"
+)
+
+// Trace is a recorded download: the file and lattice it was for, and every request to the getter
+// with its response, in the order the requests were made.
+type Trace struct {
+	Lattice     config.Lattice  `json:"lattice"`
+	Size        uint64          `json:"size"`
+	DataRoot    hexutil.Bytes   `json:"dataRoot"`
+	ParityRoots []hexutil.Bytes `json:"parityRoots"`
+	Chunker     ChunkerOptions  `json:"chunker"` // How the tree of the file was built
+	Requests    []TraceRequest  `json:"requests"`
+}
+
+// TraceRequest is a request to the getter and its response.
+type TraceRequest struct {
+	Address  hexutil.Bytes `json:"address"`
+	Leaf     bool          `json:"leaf,omitempty"`     // The request was for the leaf at Position below Address
+	Position int           `json:"position,omitempty"` // Leaf position, see Leafchunkid
+	Start    time.Duration `json:"start"`              // Since the recording started
+	Latency  time.Duration `json:"latency"`
+	Data     hexutil.Bytes `json:"data,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// ParityAddrs returns the parity roots of the traced file.
+func (t *Trace) ParityAddrs() [][]byte {
+	addrs := make([][]byte, len(t.ParityRoots))
+	for i, root := range t.ParityRoots {
+		addrs[i] = root
+	}
+	return addrs
+}
+
+// WriteFile writes the trace as JSON to path.
+func (t *Trace) WriteFile(path string) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// ReadTrace reads a trace written by Trace.WriteFile.
+func ReadTrace(path string) (*Trace, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t := new(Trace)
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("invalid trace %s: %v", path, err)
+	}
+	return t, nil
+}
+
+// traceKey identifies a request, as the leaf positions of the parity trees share their root address.
+type traceKey struct {
+	addr     string
+	leaf     bool
+	position int
+}
+
+func requestKey(ctx context.Context, ref storage.Reference) traceKey {
+	position, leaf := ctx.Value(Leafchunkid).(int)
+	return traceKey{fmt.Sprintf("%x", ref), leaf, position}
+}
+
+// Recorder is a getter that records the requests to the getter it wraps in a trace.
+type Recorder struct {
+	storage.Getter
+	start time.Time
+	lock  sync.Mutex
+	trace *Trace
+}
+
+// NewRecorder returns a recorder that adds the requests to getter to trace.
+func NewRecorder(getter storage.Getter, trace *Trace) *Recorder {
+	return &Recorder{Getter: getter, start: time.Now(), trace: trace}
+}
+
+// Get implements storage.Getter.
+func (r *Recorder) Get(ctx context.Context, ref storage.Reference) (storage.ChunkData, error) {
+	key := requestKey(ctx, ref)
+	start := time.Now()
+	data, err := r.Getter.Get(ctx, ref)
+	req := TraceRequest{Address: append([]byte(nil), ref...), Leaf: key.leaf, Position: key.position,
+		Start: start.Sub(r.start), Latency: time.Since(start)}
+	if err != nil {
+		req.Error = err.Error()
+	} else {
+		req.Data = append([]byte(nil), data...)
+	}
+
+	r.lock.Lock()
+	r.trace.Requests = append(r.trace.Requests, req)
+	r.lock.Unlock()
+	return data, err
+}
+
+// Trace returns the trace being recorded.
+func (r *Recorder) Trace() *Trace {
+	return r.trace
+}
+
+// ReplayGetter is a getter that gives the responses of a trace. The responses to the same request
+// are given in the order they were recorded, and the last one is repeated if the request is made
+// more often than in the trace. Requests that are not in the trace fail with chunk.ErrChunkNotFound.
+type ReplayGetter struct {
+	Latency    bool // Wait the recorded latency before every response
+	lock       sync.Mutex
+	responses  map[traceKey][]TraceRequest
+	served     map[traceKey]int
+	unrecorded int
+}
+
+// NewReplayGetter returns a getter that replays trace.
+func NewReplayGetter(trace *Trace) *ReplayGetter {
+	responses := make(map[traceKey][]TraceRequest)
+	for _, req := range trace.Requests {
+		key := traceKey{fmt.Sprintf("%x", []byte(req.Address)), req.Leaf, req.Position}
+		responses[key] = append(responses[key], req)
+	}
+	return &ReplayGetter{responses: responses, served: make(map[traceKey]int)}
+}
+
+// Get implements storage.Getter.
+func (g *ReplayGetter) Get(ctx context.Context, ref storage.Reference) (storage.ChunkData, error) {
+	key := requestKey(ctx, ref)
+	g.lock.Lock()
+	recorded := g.responses[key]
+	if len(recorded) == 0 {
+		g.unrecorded++
+		g.lock.Unlock()
+		return nil, chunk.ErrChunkNotFound
+	}
+	i := g.served[key]
+	if i < len(recorded)-1 {
+		g.served[key]++
+	}
+	g.lock.Unlock()
+
+	req := recorded[i]
+	if g.Latency {
+		time.Sleep(req.Latency)
+	}
+	if req.Error == chunk.ErrChunkNotFound.Error() {
+		return nil, chunk.ErrChunkNotFound
+	} else if req.Error != "" {
+		return nil, errors.New(req.Error)
+	}
+	return append([]byte(nil), req.Data...), nil
+}
+
+// Unrecorded returns the number of requests that were not in the trace, which is 0 if the replay
+// made the same requests as the recording.
+func (g *ReplayGetter) Unrecorded() int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.unrecorded
+}
@@ -13,15 +13,17 @@ import (
 
 // TreeChunk represents a node in the merkle tree.
 type TreeChunk struct {
-	Depth       int
-	BranchCount int64
-	Length      int
-	SubtreeSize uint64
-	Data        []byte
-	Key         []byte // Address of chunk
-	Index       int    // Position of chunk
-	Children    []*TreeChunk
-	Parent      *TreeChunk
+	Depth         int
+	BranchCount   int64
+	Length        int
+	SubtreeSize   uint64
+	Data          []byte
+	EncryptedData []byte // Chunk as stored in Swarm. Only set for encrypted content
+	Key           []byte // Address of chunk
+	Index         int    // Position of chunk
+	Children      []*TreeChunk
+	Parent        *TreeChunk
+	level         int // Level in the tree as given by storage.TreeSplit. Only set for encrypted content
 }
 
 // NewTreeChunk creates a reference to a new TreeChunk struct
@@ -43,6 +45,35 @@ func NewTreeChunk(depth, index int, key, data []byte, parent *TreeChunk) *TreeCh
 	}
 }
 
+// StoredData returns the chunk as it is stored in Swarm. This is the data that should be entangled.
+func (tc *TreeChunk) StoredData() []byte {
+	if tc.EncryptedData != nil {
+		return tc.EncryptedData
+	}
+	return tc.Data
+}
+
+// byzantine returns a copy of tc with the data a Byzantine source serves instead, see ByzantineData.
+func (tc *TreeChunk) byzantine() *TreeChunk {
+	wrong := *tc
+	wrong.Data = ByzantineData(tc.Data)
+	return &wrong
+}
+
+// IsEncrypted reports whether the chunk is part of encrypted content.
+func (tc *TreeChunk) IsEncrypted() bool {
+	return IsEncryptedRef(tc.Key)
+}
+
+// childSize returns the size of the subtree below child number childNum of an encrypted chunk.
+func (tc *TreeChunk) childSize(childNum int) uint64 {
+	size := levelSize(tc.level-1, chunk.DefaultSize, EncryptedChunkMaxBranch)
+	if offset := uint64(childNum-1) * size; tc.SubtreeSize-offset < size {
+		return tc.SubtreeSize - offset
+	}
+	return size
+}
+
 // SetChildren sets the children of the given chunk
 func (tc *TreeChunk) SetChildren(children []*TreeChunk) {
 	tc.Children = children
@@ -77,6 +108,9 @@ func (tc *TreeChunk) GetChildFromMemWithFail(index int, failedChunks map[int]Blo
 	if child == nil {
 		return nil, errors.New("could not find child")
 	}
+	if fail, ok := failedChunks[tc.Index]; ok && fail.Class == Byzantine {
+		return child.byzantine(), nil
+	}
 	return child, nil
 }
 
@@ -104,6 +138,12 @@ func (tc *TreeChunk) getChildFromMemWithFail(index float64, failedChunks map[int
 				} else if fail.Class == Corrupt {
 					tc.Data = utils.GenerateRandomBytes(chunk.DefaultSize, time.Now().UnixNano())
 					return tc
+				} else if fail.Class == Byzantine {
+					// A wrong chunk on the branch leads to a wrong leaf.
+					if leaf := tc.Children[i].getChildFromMemWithFail(index-prevSubChildren, failedChunks); leaf != nil {
+						return leaf.byzantine()
+					}
+					return nil
 				}
 			}
 			return tc.Children[i].getChildFromMemWithFail(index-prevSubChildren, failedChunks)
@@ -151,42 +191,11 @@ func (tc *TreeChunk) FlattenTree() (out []*TreeChunk) {
 	return
 }
 
-// FlattenTreeWindow flattens the tree in a way that takes care not to put dependencies inside lattice windows.
+// FlattenTreeWindow flattens the tree in a way that takes care not to put dependencies inside lattice windows,
+// see WindowPlacement.
 // s - Horizontal, p - Helical
 func (tc *TreeChunk) FlattenTreeWindow(s, p int) (out []*TreeChunk) {
-	out = make([]*TreeChunk, tc.Index)
-	var walker func(*TreeChunk)
-	var currIndex int = 0
-	internalNodes := make([]*TreeChunk, 0)
-	walker = func(parent *TreeChunk) {
-		if len(parent.Children) > 0 {
-			for j := range parent.Children {
-				walker(parent.Children[j])
-			}
-			if parent.Index != tc.Index {
-				internalNodes = append(internalNodes, parent)
-			}
-		}
-		out[currIndex] = parent
-		currIndex++
-	}
-	walker(tc)
-	windowSize := s * p // s - Horizontal, p - Helical
-	for i := 0; i < len(internalNodes); i++ {
-		im := internalNodes[i]
-		lowestChild := im.Children[0].Index
-		highestChild := im.Children[len(im.Children)-1].Index
-		for j := windowSize; j < tc.Index; j += windowSize + s {
-			inWindow := out[j].Index > lowestChild-windowSize && out[j].Index < highestChild+windowSize
-			if !inWindow && len(out[j].Children) == 0 {
-				// Swap position of im and the data
-				out[j], out[im.Index-1] = out[im.Index-1], out[j]
-				break
-			}
-		}
-	}
-
-	return
+	return tc.FlattenTreePlacement(WindowPlacement{}, s, p)
 }
 
 // FilterChunks can be used if you only want to retrieve some chunks of the tree. I.e only leaves or intermediate.
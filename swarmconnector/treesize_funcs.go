@@ -5,17 +5,20 @@ import (
 
 	"github.com/ethersphere/swarm/chunk"
 	"github.com/ethersphere/swarm/storage"
+	"github.com/ethersphere/swarm/storage/encryption"
 )
 
 const (
-	ChunkSizeOffset = 8
-	ChunkMaxBranch  = chunk.DefaultSize / chunk.AddressLength
-	StdSizeLevel1   = chunk.DefaultSize * ChunkMaxBranch
-	StdSizeLevel2   = StdSizeLevel1 * ChunkMaxBranch
-	StdSizeLevel3   = StdSizeLevel2 * ChunkMaxBranch
-	StdSizeLevel4   = StdSizeLevel3 * ChunkMaxBranch
-	StdSizeLevel5   = StdSizeLevel4 * ChunkMaxBranch
-	StdSizeLevel6   = StdSizeLevel5 * ChunkMaxBranch
+	ChunkSizeOffset         = 8
+	ChunkMaxBranch          = chunk.DefaultSize / chunk.AddressLength
+	EncryptedRefSize        = chunk.AddressLength + encryption.KeyLength
+	EncryptedChunkMaxBranch = chunk.DefaultSize / EncryptedRefSize
+	StdSizeLevel1           = chunk.DefaultSize * ChunkMaxBranch
+	StdSizeLevel2           = StdSizeLevel1 * ChunkMaxBranch
+	StdSizeLevel3           = StdSizeLevel2 * ChunkMaxBranch
+	StdSizeLevel4           = StdSizeLevel3 * ChunkMaxBranch
+	StdSizeLevel5           = StdSizeLevel4 * ChunkMaxBranch
+	StdSizeLevel6           = StdSizeLevel5 * ChunkMaxBranch
 )
 
 const (
@@ -131,3 +134,100 @@ func getChildSize(numLeaves float64) float64 {
 	}
 	return math.Pow(ChunkMaxBranch, depth)
 }
+
+// IsEncryptedRef reports whether the reference carries a decryption key.
+func IsEncryptedRef(ref []byte) bool {
+	return len(ref) == EncryptedRefSize
+}
+
+// GetBranches returns the branching factor of a tree with the given reference size.
+func GetBranches(refSize int) uint64 {
+	return uint64(chunk.DefaultSize / refSize)
+}
+
+// levelSize returns the number of bytes covered by a full subtree at the given level, in a tree
+// of chunks with chunkSize bytes of data. Level 0 is a single leaf chunk.
+func levelSize(level int, chunkSize, branches uint64) uint64 {
+	size := chunkSize
+	for i := 0; i < level; i++ {
+		size *= branches
+	}
+	return size
+}
+
+// treeLevel returns the level storage.TreeSplit gives the root of a tree with size bytes.
+func treeLevel(size, chunkSize, branches uint64) (level int) {
+	for treeSize := chunkSize; treeSize < size; treeSize *= branches {
+		level++
+	}
+	return level
+}
+
+// subtreeLevel returns the level of a subtree with size bytes that hangs below a node
+// at parentLevel. Mirrors how storage.TreeChunker.split lowers the depth of short subtrees.
+func subtreeLevel(parentLevel int, size, chunkSize, branches uint64) int {
+	level := parentLevel - 1
+	for level > 0 && size < levelSize(level-1, chunkSize, branches) {
+		level--
+	}
+	return level
+}
+
+// fullTreeIndex returns the number of chunks in a full subtree at the given level.
+func fullTreeIndex(level int, branches uint64) int {
+	if level < 0 {
+		return 0
+	}
+	index := 1
+	for i := 0; i < level; i++ {
+		index = 1 + int(branches)*index
+	}
+	return index
+}
+
+// subtreeIndex returns the number of chunks in a subtree with size bytes at the given level.
+func subtreeIndex(level int, size, chunkSize, branches uint64) int {
+	if level == 0 {
+		return 1
+	}
+	childSize := levelSize(level-1, chunkSize, branches)
+	index := 1 + int(size/childSize)*fullTreeIndex(level-1, branches)
+	if rest := size % childSize; rest != 0 {
+		index += subtreeIndex(subtreeLevel(level, rest, chunkSize, branches), rest, chunkSize, branches)
+	}
+	return index
+}
+
+// GetTreeIndexBySizeBranches calculates the canonical index of the root of a tree with
+// size bytes and the given branching factor.
+func GetTreeIndexBySizeBranches(size, branches uint64) int {
+	return GetTreeIndexByChunkSize(size, chunk.DefaultSize, branches)
+}
+
+// GetTreeIndexByChunkSize is the same as GetTreeIndexBySizeBranches for a tree of chunks
+// with chunkSize bytes of data.
+func GetTreeIndexByChunkSize(size, chunkSize, branches uint64) int {
+	return subtreeIndex(treeLevel(size, chunkSize, branches), size, chunkSize, branches)
+}
+
+// GetChildOffsetBySizeBranches is the same as GetChildOffsetByStandardSize for a tree
+// with the given branching factor.
+func GetChildOffsetBySizeBranches(size, branches uint64) int {
+	return GetChildOffsetByChunkSize(size, chunk.DefaultSize, branches)
+}
+
+// GetChildOffsetByChunkSize is the same as GetChildOffsetBySizeBranches for a tree of chunks
+// with chunkSize bytes of data.
+func GetChildOffsetByChunkSize(size, chunkSize, branches uint64) int {
+	return fullTreeIndex(treeLevel(size, chunkSize, branches)-1, branches)
+}
+
+// GetChildLength returns the length of the payload of a chunk with size bytes at the given level.
+// Intermediate chunks hold one reference per child.
+func GetChildLength(level int, size uint64, refSize int) int {
+	if level == 0 {
+		return int(size)
+	}
+	childSize := levelSize(level-1, chunk.DefaultSize, GetBranches(refSize))
+	return int((size+childSize-1)/childSize) * refSize
+}
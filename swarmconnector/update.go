@@ -0,0 +1,137 @@
+package swarmconnector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/repair"
+	"github.com/relab/snarl-mw21/utils"
+)
+
+// Range is the bytes from Start up to, but not including, End of a file.
+type Range struct {
+	Start, End uint64
+}
+
+// overlaps reports whether any of the ranges overlaps the bytes from start up to end.
+func overlaps(ranges []Range, start, end uint64) bool {
+	for _, r := range ranges {
+		if r.Start < end && start < r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// ChunkUpdate is a chunk of a tree that is changed by UpdateTree.
+type ChunkUpdate struct {
+	Index int         // Canonical index of the chunk
+	Old   chunk.Chunk // The chunk before the update
+	New   chunk.Chunk // The chunk after the update
+}
+
+// UpdateTree changes the leaves of the file at rootAddr that overlap any of the ranges, and returns every
+// chunk that changes with them, children before their parents, so the new root is the last one. update
+// is called with the offset in the file and a copy of the content of each of those leaves, which it
+// changes in place; the size of the file stays the same. Only the chunks on the branches of the Merkle
+// tree that cover the ranges are retrieved, and only those chunks are repaired by the repairer if they
+// are not available. Encrypted content can not be updated, as its chunks are encrypted with new keys.
+func UpdateTree(ctx context.Context, getter storage.Getter, rootAddr storage.Reference, options BuildTreeOptions,
+	repairer repair.Repairer, ranges []Range, update func(offset uint64, data []byte)) ([]*ChunkUpdate, error) {
+	if IsEncryptedRef(rootAddr) {
+		return nil, errors.New("encrypted content can not be updated")
+	}
+	tc, options, err := rootTreeChunk(ctx, getter, rootAddr, options, repairer)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range ranges {
+		if r.Start > r.End || r.End > tc.SubtreeSize {
+			return nil, fmt.Errorf("%w: %d-%d of %d bytes", ErrInvalidRange, r.Start, r.End, tc.SubtreeSize)
+		}
+	}
+	updates := make([]*ChunkUpdate, 0)
+	_, err = tc.updateTree(ctx, 0, options, repairer, 0, ranges, update, &updates)
+	return updates, err
+}
+
+// updateTree changes the leaves below tc that overlap the ranges, where start is the offset of tc in
+// the file, and appends the chunks that change to updates. It returns the new address of tc.
+func (tc *TreeChunk) updateTree(ctx context.Context, parentOffset int, options BuildTreeOptions,
+	repairer repair.Repairer, start uint64, ranges []Range, update func(uint64, []byte), updates *[]*ChunkUpdate) ([]byte, error) {
+	data := make([]byte, len(tc.Data))
+	copy(data, tc.Data)
+
+	// This is a leaf node, since it contains all the data in its subtree
+	if tc.SubtreeSize <= uint64(len(tc.Data)) {
+		update(start, data[ChunkSizeOffset:])
+	} else if err := tc.updateChildren(ctx, parentOffset, options, repairer, start, ranges, update, updates, data); err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(data, tc.Data) {
+		return tc.Key, nil
+	}
+	addr, err := utils.GetAddrOfRawData(data, storage.MakeHashFunc(storage.DefaultHash)())
+	if err != nil {
+		return nil, err
+	}
+	*updates = append(*updates, &ChunkUpdate{Index: tc.Index, Old: chunk.NewChunk(tc.Key, tc.Data), New: chunk.NewChunk(addr, data)})
+	return addr, nil
+}
+
+// updateChildren updates the children of tc that overlap the ranges, and writes their new addresses into
+// data, the new content of tc. The children are retrieved concurrently, and then updated in order.
+func (tc *TreeChunk) updateChildren(ctx context.Context, parentOffset int, options BuildTreeOptions,
+	repairer repair.Repairer, start uint64, ranges []Range, update func(uint64, []byte), updates *[]*ChunkUpdate, data []byte) error {
+	if options.shape != nil && len(options.shape[tc.Index-1].Children) != len(tc.Children) {
+		return errors.New("tree does not have the shape of a pyramid chunked file")
+	}
+	offset := tc.childOffset(options)
+
+	type childUpdate struct {
+		childNum   int
+		start      uint64 // Offset of the child in the file
+		chunk      *TreeChunk
+		nextParent int
+		err        error
+	}
+	var children []*childUpdate
+	childStart := start
+	for childNum := 1; childNum <= len(tc.Children); childNum++ {
+		size := tc.childRangeSize(childNum, parentOffset, offset, options)
+		if overlaps(ranges, childStart, childStart+size) {
+			children = append(children, &childUpdate{childNum: childNum, start: childStart})
+		}
+		childStart += size
+	}
+
+	var wg sync.WaitGroup
+	for _, cu := range children {
+		wg.Add(1)
+		go func(cu *childUpdate) {
+			defer wg.Done()
+			if cu.err = ctx.Err(); cu.err == nil {
+				cu.chunk, cu.nextParent, cu.err = tc.retrieveChild(cu.childNum, parentOffset, offset, options, repairer)
+			}
+		}(cu)
+	}
+	wg.Wait()
+
+	for _, cu := range children {
+		if cu.err != nil {
+			return cu.err
+		}
+		addr, err := cu.chunk.updateTree(ctx, cu.nextParent, options, repairer, cu.start, ranges, update, updates)
+		if err != nil {
+			return err
+		}
+		copy(data[ChunkSizeOffset+(cu.childNum-1)*len(tc.Key):], addr)
+	}
+	return nil
+}
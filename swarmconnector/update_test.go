@@ -0,0 +1,120 @@
+package swarmconnector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethersphere/swarm/chunk"
+	"github.com/ethersphere/swarm/storage"
+	"github.com/relab/snarl-mw21/repair"
+	"github.com/relab/snarl-mw21/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// splitChunks chunks data with the chunker of options, and returns the root address and a getter of the chunks.
+func splitChunks(t *testing.T, data []byte, options ChunkerOptions) (storage.Reference, storage.Getter) {
+	ctx := context.Background()
+	tag := chunk.NewTag(0, "test-tag", 0, false)
+	store := utils.NewMapChunkStore()
+	putGetter := storage.NewHasherStore(store, storage.MakeHashFunc(storage.DefaultHash), false, tag)
+
+	var rootAddr storage.Address
+	var wait func(context.Context) error
+	var err error
+	switch {
+	case options.ChunkSize != 0:
+		var chunks []chunk.Chunk
+		if chunks, err = SplitTree(bytes.NewReader(data), uint64(len(data)), options); err == nil {
+			_, err = store.Put(ctx, chunk.ModePutUpload, chunks...)
+			rootAddr, wait = storage.Address(chunks[len(chunks)-1].Address()), func(context.Context) error { return nil }
+		}
+	case options.Pyramid:
+		rootAddr, wait, err = storage.PyramidSplit(ctx, bytes.NewReader(data), putGetter, putGetter, tag)
+	default:
+		rootAddr, wait, err = storage.TreeSplit(ctx, bytes.NewReader(data), int64(len(data)), putGetter)
+	}
+	if err == nil {
+		err = wait(ctx)
+	}
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return storage.Reference(rootAddr), putGetter
+}
+
+// treeAddrs returns the addresses of every chunk of the tree at rootAddr.
+func treeAddrs(t *testing.T, getter storage.Getter, rootAddr storage.Reference, options ChunkerOptions) map[string]bool {
+	tree, err := BuildCompleteTree(context.Background(), getter, rootAddr, options.TreeOptions(), repair.NewMockRepair(getter))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	addrs := make(map[string]bool)
+	tree.FilterChunks(func(tc *TreeChunk) bool {
+		addrs[chunk.Address(tc.Key).Hex()] = true
+		return false
+	})
+	return addrs
+}
+
+func TestUpdateTree(t *testing.T) {
+	cd := uint64(chunk.DefaultSize)
+	tests := []struct {
+		name    string
+		options ChunkerOptions
+		size    uint64
+		ranges  []Range
+	}{
+		{"SingleChunk", ChunkerOptions{}, 100, []Range{{10, 20}}},
+		{"AcrossSubtrees", ChunkerOptions{}, 300 * cd, []Range{{128*cd - 10, 128*cd + 10}}},
+		{"Disjoint", ChunkerOptions{}, 300*cd + 5, []Range{{0, 1}, {200 * cd, 202 * cd}, {300*cd + 1, 300*cd + 5}}},
+		{"Pyramid", ChunkerOptions{Pyramid: true}, 300*cd + 5, []Range{{5 * cd, 6*cd + 1}, {300 * cd, 300*cd + 5}}},
+		{"ChunkSize", ChunkerOptions{ChunkSize: 256}, 100 * 256, []Range{{8*256 - 1, 8*256 + 1}, {99 * 256, 100 * 256}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := utils.GenerateRandomBytes(int(test.size), int64(test.size))
+			rootAddr, getter := splitChunks(t, data, test.options)
+
+			patched := make([]byte, len(data))
+			copy(patched, data)
+			for i, r := range test.ranges {
+				copy(patched[r.Start:r.End], utils.GenerateRandomBytes(int(r.End-r.Start), int64(i)))
+			}
+			updates, err := UpdateTree(context.Background(), getter, rootAddr, test.options.TreeOptions(),
+				repair.NewMockRepair(getter), test.ranges, func(offset uint64, payload []byte) {
+					copy(payload, patched[offset:])
+				})
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			// The new chunks are exactly those of the patched file that were not in the file.
+			expectedRoot, expectedGetter := splitChunks(t, patched, test.options)
+			if assert.NotEmpty(t, updates) {
+				assert.Equal(t, chunk.Address(expectedRoot), updates[len(updates)-1].New.Address())
+			}
+			before := treeAddrs(t, getter, rootAddr, test.options)
+			expected := make(map[string]bool)
+			for addr := range treeAddrs(t, expectedGetter, expectedRoot, test.options) {
+				if !before[addr] {
+					expected[addr] = true
+				}
+			}
+			updated := make(map[string]bool)
+			for _, u := range updates {
+				assert.True(t, before[u.Old.Address().Hex()], "Old chunk %d is not part of the tree.", u.Index)
+				updated[u.New.Address().Hex()] = true
+			}
+			assert.Equal(t, expected, updated)
+		})
+	}
+
+	data := utils.GenerateRandomBytes(int(2*cd), 1)
+	rootAddr, getter := splitChunks(t, data, ChunkerOptions{})
+	_, err := UpdateTree(context.Background(), getter, rootAddr, BuildTreeOptions{}, repair.NewMockRepair(getter),
+		[]Range{{2*cd - 1, 2*cd + 1}}, func(uint64, []byte) {})
+	assert.True(t, errors.Is(err, ErrInvalidRange), "Range past the end accepted. %v", err)
+}
@@ -11,17 +11,39 @@ import (
 	"github.com/ethersphere/swarm/storage"
 )
 
-const usePyramid = false
-
 // GenerateRandomData generates [size] random bytes
 func GenerateRandomData(size int, hasher, dir string) (rootAddr storage.Address, reader *storage.LazyChunkReader, getter storage.Getter, err error) {
+	return generateRandomData(size, hasher, false, false)
+}
+
+// GenerateRandomEncryptedData generates [size] random bytes and encrypts the chunks.
+// The returned root address includes the decryption key.
+func GenerateRandomEncryptedData(size int, hasher, dir string) (rootAddr storage.Address, reader *storage.LazyChunkReader, getter storage.Getter, err error) {
+	return generateRandomData(size, hasher, true, false)
+}
+
+// GenerateRandomPyramidData generates [size] random bytes and chunks them with storage.PyramidSplit.
+func GenerateRandomPyramidData(size int, hasher, dir string) (rootAddr storage.Address, reader *storage.LazyChunkReader, getter storage.Getter, err error) {
+	return generateRandomData(size, hasher, false, true)
+}
+
+// StoreData chunks the given bytes, the same way as GenerateRandomData.
+func StoreData(input []byte, hasher string) (rootAddr storage.Address, reader *storage.LazyChunkReader, getter storage.Getter, err error) {
+	return storeData(input, hasher, false, false)
+}
+
+func generateRandomData(size int, hasher string, toEncrypt, usePyramid bool) (rootAddr storage.Address, reader *storage.LazyChunkReader, getter storage.Getter, err error) {
+	return storeData(GenerateRandomBytes(size, time.Now().UnixNano()), hasher, toEncrypt, usePyramid)
+}
+
+func storeData(input []byte, hasher string, toEncrypt, usePyramid bool) (rootAddr storage.Address, reader *storage.LazyChunkReader, getter storage.Getter, err error) {
 	var data io.Reader
-	input := GenerateRandomBytes(size, time.Now().UnixNano())
+	size := len(input)
 	data = bytes.NewReader(input)
 
 	testtag := chunk.NewTag(0, "test-tag", 0, false)
 
-	putGetter := storage.NewHasherStore(NewMapChunkStore(), storage.MakeHashFunc(hasher), false, testtag)
+	putGetter := storage.NewHasherStore(NewMapChunkStore(), storage.MakeHashFunc(hasher), toEncrypt, testtag)
 
 	//var addr storage.Address
 	var wait func(context.Context) error